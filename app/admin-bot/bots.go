@@ -0,0 +1,324 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	sharedredis "shared/redis"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// commandTimeout — сколько admin-bot ждёт, пока воркер выполнит команду.
+// Дольше владелец ждать не будет: статус можно обновить в карточке бота.
+const commandTimeout = 10 * time.Second
+
+// ownedBot — бот владельца из таблицы bots.
+type ownedBot struct {
+	ID         int64
+	Token      string
+	TemplateID int64
+	IsActive   bool
+
+	// DeactivatedReason — почему бот отключился сам, пусто, если его
+	// отключил владелец
+	DeactivatedReason string
+}
+
+func getOwnedBots(userID int64) ([]ownedBot, error) {
+	rows, err := db.Query(`
+        SELECT split_part(bot_token, ':', 1)::bigint, bot_token, template_id, is_active, deactivated_reason
+        FROM bots WHERE user_id = $1
+        ORDER BY created_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bots []ownedBot
+	for rows.Next() {
+		var b ownedBot
+		if err := rows.Scan(&b.ID, &b.Token, &b.TemplateID, &b.IsActive, &b.DeactivatedReason); err != nil {
+			return nil, err
+		}
+		bots = append(bots, b)
+	}
+	return bots, rows.Err()
+}
+
+// getOwnedBot возвращает бота владельца или nil, если бот не найден.
+func getOwnedBot(userID, botID int64) (*ownedBot, error) {
+	b := ownedBot{ID: botID}
+	err := db.QueryRow(`
+        SELECT bot_token, template_id, is_active, deactivated_reason FROM bots
+        WHERE user_id = $1 AND split_part(bot_token, ':', 1)::bigint = $2`, userID, botID).Scan(
+		&b.Token, &b.TemplateID, &b.IsActive, &b.DeactivatedReason)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// botIDFromToken возвращает Telegram ID бота — числовую часть токена.
+func botIDFromToken(token string) int64 {
+	var id int64
+	fmt.Sscanf(strings.SplitN(token, ":", 2)[0], "%d", &id)
+	return id
+}
+
+// sendBotCommand отправляет команду воркерам и ждёт, пока один из них её
+// выполнит.
+func sendBotCommand(command sharedredis.Command, botID int64) (*sharedredis.BotStatus, error) {
+	// limiter создаётся, только если Redis доступен
+	if limiter == nil {
+		return nil, errors.New("redis is unavailable")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout+5*time.Second)
+	defer cancel()
+
+	id, err := sharedredis.SendCommand(ctx, sharedredis.Client, command, botID)
+	if err != nil {
+		return nil, err
+	}
+	return sharedredis.WaitCommand(ctx, sharedredis.Client, botID, id, commandTimeout)
+}
+
+// getBotStatus возвращает статус бота по отчётам воркеров или nil, если
+// статус неизвестен.
+func getBotStatus(botID int64) *sharedredis.BotStatus {
+	if limiter == nil {
+		return nil
+	}
+	status, err := sharedredis.GetBotStatus(context.Background(), sharedredis.Client, botID)
+	if err != nil {
+		log.Printf("Error getting bot status: %v", err)
+		return nil
+	}
+	return status
+}
+
+// describeBotStatus описывает статус бота для владельца. «Работает»
+// показывается, только если воркер подтвердил, что взял бота.
+func describeBotStatus(status *sharedredis.BotStatus) string {
+	switch {
+	case status == nil:
+		return "❔ Статус неизвестен"
+	case status.Pending:
+		return "⏳ Ожидает воркер"
+	case status.State == sharedredis.BotRunning:
+		return "🟢 Работает (" + status.Worker + ")"
+	case status.State == sharedredis.BotStopped:
+		return "⏸ Остановлен"
+	case status.State == sharedredis.BotFailed:
+		return "🔴 Ошибка запуска: " + status.Error
+	}
+	return "❔ Статус неизвестен"
+}
+
+// describeBotHealth описывает сбои бота по отчёту супервизора воркера.
+// Для здорового бота возвращает пустую строку.
+func describeBotHealth(health sharedredis.BotHealth) string {
+	var text string
+	switch health.State {
+	case sharedredis.HealthDegraded:
+		text = fmt.Sprintf("\n⚠️ Сбоев подряд: %d", health.Failures)
+	case sharedredis.HealthOpen:
+		text = "\n🔌 Обработка приостановлена после сбоев"
+		if !health.RetryAt.IsZero() {
+			text += ", перезапуск в " + health.RetryAt.Local().Format("15:04:05")
+		}
+	case sharedredis.HealthRecovering:
+		text = "\n🔁 Бот перезапущен после сбоев и проверяется"
+	default:
+		return ""
+	}
+	if health.Restarts > 0 {
+		text += fmt.Sprintf("\nПерезапусков: %d", health.Restarts)
+	}
+	if health.LastError != "" {
+		text += "\nПоследняя ошибка: " + health.LastError
+	}
+	return text
+}
+
+// startBot просит воркеры запустить только что созданного бота и сообщает
+// владельцу результат.
+func startBot(chatID int64, botToken string) {
+	status, err := sendBotCommand(sharedredis.CommandStartBot, botIDFromToken(botToken))
+	if err != nil {
+		log.Printf("Error starting bot %s: %v", maskToken(botToken), err)
+		sendMessage(chatID, "⚠️ Не удалось передать бота воркерам, он запустится при их перезапуске")
+		return
+	}
+	sendMessage(chatID, "Статус бота: "+describeBotStatus(status))
+}
+
+// ShowBotsList показывает ботов владельца со статусами.
+func ShowBotsList(chatID, userID int64) {
+	bots, err := getOwnedBots(userID)
+	if err != nil {
+		log.Printf("Database query error: %v", err)
+		sendMessage(chatID, "❌ Не удалось получить список ботов")
+		return
+	}
+	if len(bots) == 0 {
+		msg := tgbotapi.NewMessage(chatID, "У вас пока нет ботов.")
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("🤖 Добавить бота", "add_bot"),
+				tgbotapi.NewInlineKeyboardButtonData("⬅️ Назад", "main_menu"),
+			),
+		)
+		send(msg)
+		return
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, b := range bots {
+		label := maskToken(b.Token)
+		switch {
+		case b.DeactivatedReason != "":
+			label += " • ⛔ токен отклонён"
+		case !b.IsActive:
+			label += " • отключён"
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(label, fmt.Sprintf("bot_view:%d", b.ID)),
+		))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("⬅️ Назад", "main_menu"),
+	))
+
+	msg := tgbotapi.NewMessage(chatID, "🤖 Ваши боты:")
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	send(msg)
+}
+
+// ShowBotDetails показывает карточку бота со статусом от воркеров.
+func ShowBotDetails(chatID, userID, botID int64) {
+	b, err := getOwnedBot(userID, botID)
+	if err != nil {
+		log.Printf("Database query error: %v", err)
+		sendMessage(chatID, "❌ Не удалось загрузить бота")
+		return
+	}
+	if b == nil {
+		sendMessage(chatID, "Бот не найден")
+		return
+	}
+
+	var text strings.Builder
+	fmt.Fprintf(&text, "🤖 Бот %s\n\nШаблон ID: %d\n", maskToken(b.Token), b.TemplateID)
+	if b.IsActive {
+		status := getBotStatus(botID)
+		text.WriteString("Статус: " + describeBotStatus(status))
+		if status != nil {
+			text.WriteString(describeBotHealth(status.Health))
+		}
+		text.WriteString(describeWebhookHealth(botID))
+	} else if b.DeactivatedReason != "" {
+		text.WriteString("Статус: ⛔ Отключён, Telegram не принимает токен\nПричина: " + b.DeactivatedReason)
+	} else {
+		text.WriteString("Статус: ⏸ Отключён владельцем")
+	}
+
+	// С отклонённым токеном бот не запустится, поможет только новый токен
+	var toggle tgbotapi.InlineKeyboardButton
+	switch {
+	case b.IsActive:
+		toggle = tgbotapi.NewInlineKeyboardButtonData("⏸ Остановить", fmt.Sprintf("bot_stop:%d", botID))
+	case b.DeactivatedReason != "":
+		toggle = tgbotapi.NewInlineKeyboardButtonData("🔑 Заменить токен", fmt.Sprintf("bot_token:%d", botID))
+	default:
+		toggle = tgbotapi.NewInlineKeyboardButtonData("▶️ Запустить", fmt.Sprintf("bot_start:%d", botID))
+	}
+
+	rows := [][]tgbotapi.InlineKeyboardButton{
+		tgbotapi.NewInlineKeyboardRow(
+			toggle,
+			tgbotapi.NewInlineKeyboardButtonData("🔄 Обновить шаблоны", fmt.Sprintf("bot_reload:%d", botID)),
+		),
+	}
+	if b.DeactivatedReason == "" {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🪪 Профиль", fmt.Sprintf("bot_profile:%d:", botID)),
+			tgbotapi.NewInlineKeyboardButtonData("🔑 Сменить токен", fmt.Sprintf("bot_token:%d", botID)),
+		))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("🔃 Статус", fmt.Sprintf("bot_view:%d", botID)),
+		tgbotapi.NewInlineKeyboardButtonData("⬅️ К ботам", "my_bots"),
+	))
+
+	msg := tgbotapi.NewMessage(chatID, text.String())
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	send(msg)
+}
+
+// SetBotActive запускает или останавливает бота. Флаг в базе меняется до
+// команды: воркер после перезапуска поднимает только активных ботов.
+// Причина автоматического отключения сбрасывается: решение принял владелец.
+func SetBotActive(chatID, userID, botID int64, active bool) {
+	res, err := db.Exec(`
+        UPDATE bots SET is_active = $1, deactivated_reason = '', deactivated_at = NULL, updated_at = NOW()
+        WHERE user_id = $2 AND split_part(bot_token, ':', 1)::bigint = $3`, active, userID, botID)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		sendMessage(chatID, "❌ Не удалось изменить бота")
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		sendMessage(chatID, "Бот не найден")
+		return
+	}
+
+	command := sharedredis.CommandStopBot
+	if active {
+		command = sharedredis.CommandStartBot
+	}
+	status, err := sendBotCommand(command, botID)
+	if err != nil {
+		log.Printf("Error sending %s for bot %d: %v", command, botID, err)
+		sendMessage(chatID, "⚠️ Изменение сохранено, но воркеры его ещё не получили")
+	} else {
+		sendMessage(chatID, "Статус бота: "+describeBotStatus(status))
+	}
+	ShowBotDetails(chatID, userID, botID)
+}
+
+// ReloadBotTemplates просит воркер перечитать шаблоны бота из базы, не
+// дожидаясь обновления кэша.
+func ReloadBotTemplates(chatID, userID, botID int64) {
+	b, err := getOwnedBot(userID, botID)
+	if err != nil {
+		log.Printf("Database query error: %v", err)
+		sendMessage(chatID, "❌ Не удалось загрузить бота")
+		return
+	}
+	if b == nil {
+		sendMessage(chatID, "Бот не найден")
+		return
+	}
+
+	status, err := sendBotCommand(sharedredis.CommandReloadTemplate, botID)
+	switch {
+	case err != nil:
+		log.Printf("Error reloading templates of bot %d: %v", botID, err)
+		sendMessage(chatID, "⚠️ Не удалось передать команду воркерам")
+	case status.Pending:
+		sendMessage(chatID, "⏳ Воркер ещё не выполнил команду, шаблоны обновятся в течение минуты")
+	case status.Error != "":
+		sendMessage(chatID, "❌ Воркер не обновил шаблоны: "+status.Error)
+	default:
+		sendMessage(chatID, "✅ Шаблоны бота обновлены")
+	}
+}
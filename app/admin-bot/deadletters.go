@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// ownedBotIDs возвращает подзапрос с Telegram ID ботов владельца, ID которого
+// передаётся параметром param. Воркеры идентифицируют ботов по числовой части токена.
+func ownedBotIDs(param string) string {
+	return `SELECT split_part(bot_token, ':', 1)::bigint FROM bots WHERE user_id = ` + param
+}
+
+// deadLetterScope возвращает условие на dead_letters: владелец видит
+// обновления своих ботов, администратор (users.role = 'admin') — ещё и
+// обновления ботов, которых нет в bots, например бота из BOT_TOKEN.
+func deadLetterScope(param string) string {
+	return `(dead_letters.bot_id IN (` + ownedBotIDs(param) + `) OR (
+            EXISTS (SELECT 1 FROM users WHERE telegram_id = ` + param + ` AND role = 'admin')
+            AND NOT EXISTS (
+                SELECT 1 FROM bots
+                WHERE split_part(bot_token, ':', 1) = dead_letters.bot_id::text)))`
+}
+
+type deadLetter struct {
+	ID        int64
+	BotID     int64
+	UpdateID  int64
+	Stage     string
+	Error     string
+	Payload   string
+	Attempts  int
+	CreatedAt time.Time
+}
+
+func ShowDeadLetters(chatID int64, userID int64) {
+	rows, err := db.Query(`
+        SELECT id, bot_id, update_id, stage, error, attempts, created_at
+        FROM dead_letters
+        WHERE status = 'new' AND `+deadLetterScope("$1")+`
+        ORDER BY id DESC
+        LIMIT 20`, userID)
+	if err != nil {
+		log.Printf("Database query error: %v", err)
+		sendMessage(chatID, "❌ Не удалось получить список ошибок")
+		return
+	}
+	defer rows.Close()
+
+	var letters []deadLetter
+	for rows.Next() {
+		var d deadLetter
+		if err := rows.Scan(&d.ID, &d.BotID, &d.UpdateID, &d.Stage, &d.Error, &d.Attempts, &d.CreatedAt); err != nil {
+			log.Printf("Row scan error: %v", err)
+			continue
+		}
+		letters = append(letters, d)
+	}
+
+	if len(letters) == 0 {
+		sendMessage(chatID, "✅ Необработанных обновлений нет")
+		return
+	}
+
+	msg := tgbotapi.NewMessage(chatID, "📥 Необработанные обновления:")
+	var buttons [][]tgbotapi.InlineKeyboardButton
+	for _, d := range letters {
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(
+				fmt.Sprintf("#%d бот %d • %s • %s", d.ID, d.BotID, d.Stage, d.CreatedAt.Format("02.01 15:04")),
+				fmt.Sprintf("dlq_view:%d", d.ID),
+			),
+		))
+	}
+	buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("🔁 Повторить все", "dlq_replay_all"),
+		tgbotapi.NewInlineKeyboardButtonData("⬅️ Назад", "main_menu"),
+	))
+
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(buttons...)
+	send(msg)
+}
+
+func ShowDeadLetterDetails(chatID int64, userID int64, id int64) {
+	var d deadLetter
+	err := db.QueryRow(`
+        SELECT id, bot_id, update_id, stage, error, COALESCE(payload::text, raw_payload, ''), attempts, created_at
+        FROM dead_letters
+        WHERE id = $1 AND `+deadLetterScope("$2"), id, userID).
+		Scan(&d.ID, &d.BotID, &d.UpdateID, &d.Stage, &d.Error, &d.Payload, &d.Attempts, &d.CreatedAt)
+	if err != nil {
+		log.Printf("Ошибка при получении обновления: %v", err)
+		sendMessage(chatID, "Обновление не найдено")
+		return
+	}
+
+	// Обрезается по символам: разрезанный UTF-8 Telegram не примет
+	payload := d.Payload
+	if runes := []rune(payload); len(runes) > 1500 {
+		payload = string(runes[:1500]) + "…"
+	}
+
+	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf(
+		"📥 Обновление #%d\n\nБот: %d\nUpdate ID: %d\nЭтап: %s\nПопыток: %d\nВремя: %s\n\nОшибка:\n%s\n\nДанные:\n%s",
+		d.ID, d.BotID, d.UpdateID, d.Stage, d.Attempts, d.CreatedAt.Format("02.01.2006 15:04:05"), d.Error, payload))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔁 Повторить", fmt.Sprintf("dlq_replay:%d", d.ID)),
+			tgbotapi.NewInlineKeyboardButtonData("🗑 Удалить", fmt.Sprintf("dlq_discard:%d", d.ID)),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("⬅️ Назад", "dead_letters"),
+		),
+	)
+	send(msg)
+}
+
+// handleDeadLetterCallback обрабатывает действия dlq_*. Повтор только
+// помечает запись: её подхватит воркер, обслуживающий бота.
+func handleDeadLetterCallback(callback *tgbotapi.CallbackQuery, action string, parts []string) {
+	chatID := callback.Message.Chat.ID
+	userID := callback.From.ID
+
+	if action == "dlq_replay_all" {
+		res, err := db.Exec(`
+            UPDATE dead_letters SET status = 'replay'
+            WHERE status = 'new' AND `+deadLetterScope("$1"), userID)
+		if err != nil {
+			log.Printf("Database error: %v", err)
+			sendMessage(chatID, "❌ Не удалось поставить обновления в очередь")
+			return
+		}
+		count, _ := res.RowsAffected()
+		sendMessage(chatID, fmt.Sprintf("🔁 Поставлено на повтор: %d", count))
+		return
+	}
+
+	if len(parts) < 2 {
+		sendMessage(chatID, "Ошибка: не указан ID обновления")
+		return
+	}
+	id, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		sendMessage(chatID, "Ошибка: неверный ID обновления")
+		return
+	}
+
+	switch action {
+	case "dlq_view":
+		ShowDeadLetterDetails(chatID, userID, id)
+	case "dlq_replay", "dlq_discard":
+		status, reply := "replay", "🔁 Обновление поставлено на повтор"
+		if action == "dlq_discard" {
+			status, reply = "discarded", "🗑 Обновление удалено"
+		}
+
+		res, err := db.Exec(`
+            UPDATE dead_letters
+            SET status = $1, resolved_at = CASE WHEN $1 = 'discarded' THEN NOW() END
+            WHERE id = $2 AND status = 'new' AND `+deadLetterScope("$3"),
+			status, id, userID)
+		if err != nil {
+			log.Printf("Database error: %v", err)
+			sendMessage(chatID, "❌ Ошибка при обновлении записи")
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			sendMessage(chatID, "Обновление не найдено или уже обработано")
+			return
+		}
+		sendMessage(chatID, reply)
+	}
+}
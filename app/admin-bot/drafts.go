@@ -0,0 +1,426 @@
+package main
+
+import (
+	"admin-bot/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"shared/content"
+	"shared/keyboard"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// actionPublishTime — владелец вводит время отложенной публикации.
+	actionPublishTime = "awaiting_publish_time"
+
+	publishCheckInterval = 30 * time.Second
+	publishTimeLayout    = "02.01.2006 15:04"
+)
+
+// publishZone — часовой пояс, в котором владельцы вводят и видят время
+// публикации и в котором подставляются дата и время шаблонов.
+var publishZone = loadPublishZone()
+
+func loadPublishZone() *time.Location {
+	loc, err := content.ZoneFromEnv()
+	if err != nil {
+		log.Printf("Using UTC: %v", err)
+	}
+	return loc
+}
+
+// formatPublishTime показывает время в поясе publishZone с его смещением,
+// например «15.03.2025 15:00 (UTC+03:00)».
+func formatPublishTime(t time.Time) string {
+	t = t.In(publishZone)
+	return fmt.Sprintf("%s (UTC%s)", t.Format(publishTimeLayout), t.Format("-07:00"))
+}
+
+// errDraftChanged — черновик изменили или опубликовали между проверкой и
+// публикацией.
+var errDraftChanged = errors.New("draft changed before publishing")
+
+// templateDraft — неопубликованные изменения шаблона. worker-bot отдаёт
+// опубликованную версию из bot_templates, черновик виден только владельцу.
+type templateDraft struct {
+	TemplateID  int64
+	Content     string
+	Keyboard    []byte
+	ParseMode   string
+	MediaType   string
+	MediaFileID string
+	MediaID     *int64
+	AuthorID    int64
+	PublishAt   *time.Time
+	UpdatedAt   time.Time
+}
+
+// loadDraft возвращает черновик шаблона или nil, если его нет.
+func loadDraft(templateID int64) (*templateDraft, error) {
+	d := templateDraft{TemplateID: templateID}
+	err := db.QueryRow(`
+        SELECT content, keyboard, parse_mode, media_type, media_file_id, media_id,
+               author_id, publish_at, updated_at
+        FROM template_drafts WHERE template_id = $1`, templateID).Scan(
+		&d.Content, &d.Keyboard, &d.ParseMode, &d.MediaType, &d.MediaFileID, &d.MediaID,
+		&d.AuthorID, &d.PublishAt, &d.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load draft of template %d: %w", templateID, err)
+	}
+	return &d, nil
+}
+
+// saveDraft создаёт или обновляет черновик. Запланированная публикация
+// сохраняется: она опубликует последнюю редакцию черновика.
+func saveDraft(tx *sql.Tx, d *templateDraft) error {
+	_, err := tx.Exec(`
+        INSERT INTO template_drafts
+        (template_id, content, keyboard, parse_mode, media_type, media_file_id, media_id, author_id, updated_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW())
+        ON CONFLICT (template_id) DO UPDATE SET
+            content = EXCLUDED.content, keyboard = EXCLUDED.keyboard, parse_mode = EXCLUDED.parse_mode,
+            media_type = EXCLUDED.media_type, media_file_id = EXCLUDED.media_file_id,
+            media_id = EXCLUDED.media_id, author_id = EXCLUDED.author_id, updated_at = NOW()`,
+		d.TemplateID, d.Content, d.Keyboard, d.ParseMode, d.MediaType, d.MediaFileID, d.MediaID, d.AuthorID)
+	if err != nil {
+		return fmt.Errorf("failed to save draft of template %d: %w", d.TemplateID, err)
+	}
+	return nil
+}
+
+// apply подставляет черновик в шаблон, чтобы показать или проверить его.
+func (d *templateDraft) apply(t *models.BotTemplate) {
+	t.Content = d.Content
+	t.Keyboard = d.Keyboard
+	t.ParseMode = d.ParseMode
+	t.MediaType = d.MediaType
+	t.MediaFileID = d.MediaFileID
+	t.MediaID = d.MediaID
+}
+
+// validateForPublish проверяет шаблон перед публикацией. В отличие от
+// сохранения черновика, кнопки не могут вести к несуществующим шаблонам:
+// опубликованный шаблон сразу видят пользователи ботов.
+func validateForPublish(t *models.BotTemplate) error {
+	if strings.TrimSpace(t.Content) == "" && t.MediaType == "" {
+		return errors.New("нет ни текста, ни медиа")
+	}
+	if t.MediaType != "" && t.MediaID == nil && t.MediaFileID == "" {
+		return errors.New("файл медиа не найден")
+	}
+	if err := content.CheckPlaceholders(t.Content); err != nil {
+		return err
+	}
+
+	kb, err := keyboard.Parse(t.Keyboard)
+	if err != nil {
+		return errors.New("клавиатура повреждена, сохраните её заново")
+	}
+	if kb == nil {
+		return nil
+	}
+	if err := kb.Validate(); err != nil {
+		return err
+	}
+	if missing := missingTemplates(t.UserID, kb.Nodes()); len(missing) > 0 {
+		return fmt.Errorf("кнопки ведут к несуществующим шаблонам: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// publishDraft переносит черновик в bot_templates и сохраняет его как новую
+// версию. Черновик публикуется, только если не менялся после проверки.
+func publishDraft(d *templateDraft, authorID int64, note string) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var ownerID int64
+	err = tx.QueryRow(`
+        UPDATE bot_templates t
+        SET content = d.content, keyboard = d.keyboard, parse_mode = d.parse_mode,
+            media_type = d.media_type, media_file_id = d.media_file_id, media_id = d.media_id,
+            updated_at = NOW()
+        FROM template_drafts d
+        WHERE t.id = $1 AND d.template_id = t.id AND d.updated_at = $2
+        RETURNING t.user_id`, d.TemplateID, d.UpdatedAt).Scan(&ownerID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, errDraftChanged
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to publish template %d: %w", d.TemplateID, err)
+	}
+
+	version, err := recordVersion(tx, d.TemplateID, authorID, note)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(`DELETE FROM template_drafts WHERE template_id = $1`, d.TemplateID); err != nil {
+		return 0, fmt.Errorf("failed to delete draft of template %d: %w", d.TemplateID, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	notifyTemplateChanged(ownerID, d.TemplateID)
+	return version, nil
+}
+
+// ownedDraft загружает шаблон владельца вместе с черновиком и сообщает
+// об ошибке в чат.
+func ownedDraft(chatID, userID, templateID int64) (*models.BotTemplate, *templateDraft) {
+	template := getTemplateByID(templateID)
+	if template == nil || template.UserID != userID {
+		sendMessage(chatID, "Шаблон не найден")
+		return nil, nil
+	}
+	draft, err := loadDraft(templateID)
+	if err != nil {
+		log.Printf("Database query error: %v", err)
+		sendMessage(chatID, "❌ Не удалось загрузить черновик")
+		return nil, nil
+	}
+	if draft == nil {
+		sendMessage(chatID, "У шаблона нет черновика")
+		return nil, nil
+	}
+	return template, draft
+}
+
+// PublishTemplate публикует черновик после проверки.
+func PublishTemplate(chatID, userID, templateID int64) {
+	template, draft := ownedDraft(chatID, userID, templateID)
+	if draft == nil {
+		return
+	}
+
+	draft.apply(template)
+	if err := validateForPublish(template); err != nil {
+		sendMessage(chatID, "❌ Черновик не прошёл проверку: "+err.Error())
+		return
+	}
+
+	version, err := publishDraft(draft, userID, "Публикация")
+	if errors.Is(err, errDraftChanged) {
+		sendMessage(chatID, "Черновик изменился, откройте шаблон и опубликуйте его снова")
+		return
+	}
+	if err != nil {
+		log.Printf("Error publishing template %d: %v", templateID, err)
+		sendMessage(chatID, "❌ Не удалось опубликовать шаблон")
+		return
+	}
+
+	sendMessage(chatID, fmt.Sprintf("🚀 Шаблон «%s» опубликован, версия %d. Боты используют её сразу.", template.Name, version))
+	if template := getTemplateByID(templateID); template != nil {
+		ShowTemplateDetails(bot, chatID, *template)
+	}
+}
+
+// AskPublishTime запрашивает время отложенной публикации черновика.
+func AskPublishTime(chatID, userID, templateID int64) {
+	template, draft := ownedDraft(chatID, userID, templateID)
+	if draft == nil {
+		return
+	}
+
+	// Проверка сейчас сообщит об ошибке до того, как владелец на неё рассчитывает
+	draft.apply(template)
+	if err := validateForPublish(template); err != nil {
+		sendMessage(chatID, "❌ Черновик не прошёл проверку: "+err.Error())
+		return
+	}
+
+	setUserState(userID, &UserState{
+		CurrentAction: actionPublishTime,
+		TempData:      map[string]interface{}{"template_id": templateID},
+	})
+
+	now := time.Now().In(publishZone)
+	text := fmt.Sprintf("⏰ Когда опубликовать черновик «%s»?\n\nВведите дату и время в формате ДД.ММ.ГГГГ ЧЧ:ММ, например %s.\n"+
+		"Время указывается по поясу %s (UTC%s), сейчас там %s",
+		template.Name, now.Add(time.Hour).Format(publishTimeLayout), publishZone, now.Format("-07:00"), now.Format("15:04"))
+	rows := [][]tgbotapi.InlineKeyboardButton{}
+	if draft.PublishAt != nil {
+		text += fmt.Sprintf("\n\nСейчас публикация запланирована на %s", formatPublishTime(*draft.PublishAt))
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🚫 Отменить расписание", fmt.Sprintf("unschedule:%d", templateID)),
+		))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("❌ Отмена", "cancel"),
+	))
+
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	send(msg)
+}
+
+func handlePublishTimeInput(message *tgbotapi.Message, state *UserState) {
+	templateID, _ := state.TempData["template_id"].(int64)
+
+	at, err := time.ParseInLocation(publishTimeLayout, strings.TrimSpace(message.Text), publishZone)
+	if err != nil {
+		sendMessage(message.Chat.ID, "❌ Не удалось разобрать время. Формат: ДД.ММ.ГГГГ ЧЧ:ММ")
+		return
+	}
+	if !at.After(time.Now()) {
+		sendMessage(message.Chat.ID, "❌ Время публикации должно быть в будущем")
+		return
+	}
+
+	res, err := db.Exec(`
+        UPDATE template_drafts d SET publish_at = $1
+        FROM bot_templates t
+        WHERE d.template_id = $2 AND t.id = d.template_id AND t.user_id = $3`, at, templateID, message.From.ID)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		sendMessage(message.Chat.ID, "❌ Не удалось запланировать публикацию")
+		return
+	}
+	clearUserState(message.From.ID)
+	if n, _ := res.RowsAffected(); n == 0 {
+		sendMessage(message.Chat.ID, "Черновик не найден: возможно, он уже опубликован")
+		return
+	}
+
+	sendMessage(message.Chat.ID, fmt.Sprintf("⏰ Черновик будет опубликован %s. До этого боты используют текущую версию.", formatPublishTime(at)))
+	if template := getTemplateByID(templateID); template != nil {
+		ShowTemplateDetails(bot, message.Chat.ID, *template)
+	}
+}
+
+// UnschedulePublish отменяет отложенную публикацию, черновик остаётся.
+func UnschedulePublish(chatID, userID, templateID int64) {
+	_, err := db.Exec(`
+        UPDATE template_drafts d SET publish_at = NULL
+        FROM bot_templates t
+        WHERE d.template_id = $1 AND t.id = d.template_id AND t.user_id = $2`, templateID, userID)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		sendMessage(chatID, "❌ Не удалось отменить публикацию")
+		return
+	}
+	clearUserState(userID)
+	sendMessage(chatID, "Отложенная публикация отменена, черновик сохранён")
+}
+
+// DiscardDraft удаляет черновик, опубликованная версия не меняется.
+func DiscardDraft(chatID, userID, templateID int64) {
+	_, err := db.Exec(`
+        DELETE FROM template_drafts d
+        USING bot_templates t
+        WHERE d.template_id = $1 AND t.id = d.template_id AND t.user_id = $2`, templateID, userID)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		sendMessage(chatID, "❌ Не удалось удалить черновик")
+		return
+	}
+	sendMessage(chatID, "🗑 Черновик удалён")
+	if template := getTemplateByID(templateID); template != nil {
+		ShowTemplateDetails(bot, chatID, *template)
+	}
+}
+
+// describeDraft дополняет карточку шаблона сведениями о черновике.
+func describeDraft(draft *templateDraft) string {
+	text := "\n\n📝 Есть неопубликованный черновик от " + formatPublishTime(draft.UpdatedAt)
+	if draft.PublishAt != nil {
+		text += "\n⏰ Публикация запланирована на " + formatPublishTime(*draft.PublishAt)
+	}
+	return text
+}
+
+func draftButtons(templateID int64) [][]tgbotapi.InlineKeyboardButton {
+	return [][]tgbotapi.InlineKeyboardButton{
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🚀 Опубликовать", fmt.Sprintf("publish:%d", templateID)),
+			tgbotapi.NewInlineKeyboardButtonData("⏰ По расписанию", fmt.Sprintf("schedule:%d", templateID)),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("👁 Черновик", fmt.Sprintf("preview_draft:%d", templateID)),
+			tgbotapi.NewInlineKeyboardButtonData("🗑 Удалить черновик", fmt.Sprintf("discard_draft:%d", templateID)),
+		),
+	}
+}
+
+// watchScheduledPublications публикует черновики, время которых подошло.
+func watchScheduledPublications() {
+	ticker := time.NewTicker(publishCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := publishScheduledDrafts(); err != nil {
+			log.Printf("Scheduled publishing failed: %v", err)
+		}
+	}
+}
+
+func publishScheduledDrafts() error {
+	rows, err := db.Query(`
+        SELECT template_id FROM template_drafts
+        WHERE publish_at IS NOT NULL AND publish_at <= NOW()`)
+	if err != nil {
+		return err
+	}
+	var due []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		due = append(due, id)
+	}
+	rows.Close()
+
+	for _, templateID := range due {
+		publishScheduledDraft(templateID)
+	}
+	return rows.Err()
+}
+
+// publishScheduledDraft публикует черновик по расписанию и сообщает
+// владельцу результат. Черновик, не прошедший проверку, остаётся без
+// расписания, чтобы не повторять попытку каждые полминуты.
+func publishScheduledDraft(templateID int64) {
+	template := getTemplateByID(templateID)
+	draft, err := loadDraft(templateID)
+	if template == nil || draft == nil || err != nil {
+		if err != nil {
+			log.Printf("Scheduled publishing of template %d: %v", templateID, err)
+		}
+		return
+	}
+
+	draft.apply(template)
+	if err := validateForPublish(template); err != nil {
+		if _, err := db.Exec(`UPDATE template_drafts SET publish_at = NULL WHERE template_id = $1`, templateID); err != nil {
+			log.Printf("Database error: %v", err)
+		}
+		sendMessage(template.UserID, fmt.Sprintf("⚠️ Запланированная публикация шаблона «%s» отменена: %s. Черновик сохранён, исправьте его и опубликуйте снова.",
+			template.Name, err.Error()))
+		return
+	}
+
+	version, err := publishDraft(draft, draft.AuthorID, "Публикация по расписанию")
+	if errors.Is(err, errDraftChanged) {
+		// Черновик изменился после выборки, следующая проверка опубликует новую редакцию
+		return
+	}
+	if err != nil {
+		log.Printf("Error publishing template %d: %v", templateID, err)
+		return
+	}
+	sendMessage(template.UserID, fmt.Sprintf("🚀 Шаблон «%s» опубликован по расписанию, версия %d", template.Name, version))
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"log"
+	sharedredis "shared/redis"
+	"time"
+)
+
+// publishTemplateEvent сбрасывает кэш шаблонов в worker-bot. Без Redis
+// worker-bot увидит изменение при периодическом обновлении кэша.
+func publishTemplateEvent(event sharedredis.TemplateEvent) {
+	// limiter создаётся, только если Redis доступен
+	if limiter == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := sharedredis.PublishTemplateEvent(ctx, sharedredis.Client, event); err != nil {
+		log.Printf("Error publishing template event: %v", err)
+	}
+}
+
+// notifyTemplateChanged сообщает об изменении шаблонов, которые видят
+// боты владельца. templateID 0 — изменились несколько шаблонов.
+func notifyTemplateChanged(ownerID, templateID int64) {
+	publishTemplateEvent(sharedredis.TemplateEvent{
+		Kind:       sharedredis.EventTemplateChanged,
+		OwnerID:    ownerID,
+		TemplateID: templateID,
+	})
+}
+
+// notifyBindingChanged сообщает, что у бота сменился стартовый шаблон.
+func notifyBindingChanged(botToken string) {
+	botID := botIDFromToken(botToken)
+	if botID == 0 {
+		return
+	}
+	publishTemplateEvent(sharedredis.TemplateEvent{
+		Kind:  sharedredis.EventBindingChanged,
+		BotID: botID,
+	})
+}
@@ -0,0 +1,580 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"shared/keyboard"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Шаги конструктора, на которых бот ждёт текстовый ввод.
+const (
+	actionBuilderText        = "builder_button_text"
+	actionBuilderURL         = "builder_button_url"
+	actionBuilderNode        = "builder_button_node"
+	actionBuilderQuery       = "builder_button_query"
+	actionBuilderPlaceholder = "builder_placeholder"
+)
+
+// builderRowLimit оставляет в строке предпросмотра место под кнопку «➕»,
+// inline-клавиатура Telegram вмещает не больше 8 кнопок в строке.
+const builderRowLimit = 7
+
+// builderKeyboard возвращает клавиатуру, которую собирает пользователь.
+func builderKeyboard(state *UserState) *keyboard.Keyboard {
+	kb, _ := state.TempData["builder"].(*keyboard.Keyboard)
+	if kb == nil {
+		kb = &keyboard.Keyboard{Version: keyboard.Version, Type: keyboard.TypeReply, Resize: true}
+		state.TempData["builder"] = kb
+	}
+	return kb
+}
+
+// StartKeyboardBuilder открывает конструктор клавиатуры на шаге
+// awaiting_template_keyboard. JSON по-прежнему принимается текстом.
+func StartKeyboardBuilder(chatID int64, state *UserState) {
+	state.CurrentAction = "awaiting_template_keyboard"
+	builderKeyboard(state)
+	delete(state.TempData, "builder_msg")
+	showKeyboardBuilder(chatID, state)
+}
+
+// showKeyboardBuilder выводит предпросмотр клавиатуры. Кнопки сообщения
+// повторяют раскладку собираемой клавиатуры, нажатие открывает кнопку
+// для редактирования. Если сообщение конструктора уже есть, оно редактируется.
+func showKeyboardBuilder(chatID int64, state *UserState) {
+	kb := builderKeyboard(state)
+
+	text := "⌨️ Конструктор клавиатуры\n\n"
+	if len(kb.Rows) == 0 {
+		text += "Клавиатура пока пустая. Добавьте первую строку."
+	} else {
+		text += "Предпросмотр: " + describeKeyboard(kb) + "\n\nНажмите на кнопку, чтобы изменить её, или «➕», чтобы добавить кнопку в строку."
+	}
+	text += "\n\nМожно также прислать клавиатуру в JSON формате (пример: [[\"Да\"], [\"Нет\"]] или объект с полями type и rows)."
+
+	markup := builderMarkup(kb)
+	if msgID, ok := state.TempData["builder_msg"].(int); ok {
+		send(tgbotapi.NewEditMessageTextAndMarkup(chatID, msgID, text, markup))
+		return
+	}
+
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyMarkup = markup
+	sent, err := out.Send(context.Background(), msg)
+	if err != nil {
+		log.Printf("Error sending message: %v", err)
+		return
+	}
+	state.TempData["builder_msg"] = sent.MessageID
+}
+
+func builderMarkup(kb *keyboard.Keyboard) tgbotapi.InlineKeyboardMarkup {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for i, row := range kb.Rows {
+		var buttons []tgbotapi.InlineKeyboardButton
+		for j, b := range row {
+			buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData(builderLabel(b), fmt.Sprintf("kb_btn:%d:%d", i, j)))
+		}
+		if len(row) < builderRowLimit {
+			buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData("➕", fmt.Sprintf("kb_add_btn:%d", i)))
+		}
+		rows = append(rows, buttons)
+	}
+
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("➕ Строка", "kb_add_row"),
+		tgbotapi.NewInlineKeyboardButtonData("Тип: "+string(kb.Type)+" ⇄", "kb_type"),
+	))
+	if kb.Type == keyboard.TypeReply {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(checkbox(kb.Resize)+" resize", "kb_opt:resize"),
+			tgbotapi.NewInlineKeyboardButtonData(checkbox(kb.OneTime)+" one-time", "kb_opt:one_time"),
+			tgbotapi.NewInlineKeyboardButtonData("💬 Подсказка", "kb_placeholder"),
+		))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("✅ Готово", "kb_done"),
+		tgbotapi.NewInlineKeyboardButtonData("❌ Отмена", "cancel"),
+	))
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+func builderLabel(b keyboard.Button) string {
+	switch b.Type {
+	case keyboard.ButtonURL:
+		return "🔗 " + b.Text
+	case keyboard.ButtonCallback:
+		return "➡️ " + b.Text
+	case keyboard.ButtonSwitchInline:
+		return "↪️ " + b.Text
+	case keyboard.ButtonWebApp:
+		return "🌐 " + b.Text
+	}
+	return b.Text
+}
+
+func checkbox(on bool) string {
+	if on {
+		return "✅"
+	}
+	return "⬜"
+}
+
+func handleKeyboardBuilderCallback(callback *tgbotapi.CallbackQuery, action string, parts []string) {
+	chatID := callback.Message.Chat.ID
+	state := getUserState(callback.From.ID)
+	if state == nil || !isBuilderAction(state.CurrentAction) {
+		sendMessage(chatID, "Конструктор клавиатуры неактивен. Начните создание шаблона заново.")
+		return
+	}
+	kb := builderKeyboard(state)
+
+	// Нажатие в сообщении конструктора делает его текущим для редактирования.
+	state.TempData["builder_msg"] = callback.Message.MessageID
+
+	row, col := -1, -1
+	if len(parts) > 1 {
+		row, _ = strconv.Atoi(parts[1])
+	}
+	if len(parts) > 2 {
+		col, _ = strconv.Atoi(parts[2])
+	}
+
+	switch action {
+	case "kb_add_row":
+		if len(kb.Rows) >= 100 {
+			sendMessage(chatID, "❌ Достигнуто максимальное число строк")
+			return
+		}
+		startBuilderButton(chatID, state, len(kb.Rows), -1, nil)
+	case "kb_add_btn":
+		if row < 0 || row >= len(kb.Rows) || len(kb.Rows[row]) >= builderRowLimit {
+			sendMessage(chatID, "❌ В эту строку нельзя добавить кнопку")
+			return
+		}
+		startBuilderButton(chatID, state, row, -1, nil)
+	case "kb_btn":
+		b, ok := kb.Button(row, col)
+		if !ok {
+			showKeyboardBuilder(chatID, state)
+			return
+		}
+		showBuilderButton(chatID, state, row, col, b)
+	case "kb_rename":
+		b, ok := kb.Button(row, col)
+		if !ok {
+			showKeyboardBuilder(chatID, state)
+			return
+		}
+		setBuilderPending(state, row, col, &b)
+		state.TempData["builder_rename"] = true
+		state.CurrentAction = actionBuilderText
+		sendBuilderPrompt(chatID, fmt.Sprintf("Введите новый текст для кнопки «%s»:", b.Text))
+	case "kb_retype":
+		b, ok := kb.Button(row, col)
+		if !ok {
+			showKeyboardBuilder(chatID, state)
+			return
+		}
+		startBuilderButton(chatID, state, row, col, &keyboard.Button{Text: b.Text})
+	case "kb_move":
+		if len(parts) < 4 || !moveBuilderButton(kb, row, col, parts[3]) {
+			sendMessage(chatID, "❌ Кнопку нельзя переместить в эту сторону")
+			return
+		}
+		showKeyboardBuilder(chatID, state)
+	case "kb_del":
+		if _, ok := kb.Button(row, col); ok {
+			removeBuilderButton(kb, row, col)
+		}
+		showKeyboardBuilder(chatID, state)
+	case "kb_btn_type":
+		if len(parts) < 2 {
+			return
+		}
+		pending, ok := state.TempData["builder_pending"].(*keyboard.Button)
+		if !ok {
+			showKeyboardBuilder(chatID, state)
+			return
+		}
+		pending.Type = keyboard.ButtonType(parts[1])
+		if pending.Text == "" {
+			state.CurrentAction = actionBuilderText
+			sendBuilderPrompt(chatID, "Введите текст кнопки:")
+			return
+		}
+		askBuilderTarget(chatID, callback.From.ID, state, pending)
+	case "kb_node":
+		pending, ok := state.TempData["builder_pending"].(*keyboard.Button)
+		if !ok || len(parts) < 2 {
+			showKeyboardBuilder(chatID, state)
+			return
+		}
+		templateID, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return
+		}
+		template := getTemplateByID(templateID)
+		if template == nil || template.UserID != callback.From.ID {
+			sendMessage(chatID, "Шаблон не найден")
+			return
+		}
+		pending.Node = template.Name
+		commitBuilderButton(chatID, state)
+	case "kb_node_manual":
+		state.CurrentAction = actionBuilderNode
+		sendBuilderPrompt(chatID, "Введите название шаблона, к которому ведёт кнопка:")
+	case "kb_node_none":
+		if pending, ok := state.TempData["builder_pending"].(*keyboard.Button); ok {
+			pending.Node = ""
+		}
+		commitBuilderButton(chatID, state)
+	case "kb_query_empty":
+		if pending, ok := state.TempData["builder_pending"].(*keyboard.Button); ok {
+			pending.Query = ""
+		}
+		commitBuilderButton(chatID, state)
+	case "kb_type":
+		toggleBuilderType(chatID, state, kb)
+	case "kb_opt":
+		if len(parts) < 2 || kb.Type != keyboard.TypeReply {
+			return
+		}
+		switch parts[1] {
+		case "resize":
+			kb.Resize = !kb.Resize
+		case "one_time":
+			kb.OneTime = !kb.OneTime
+		}
+		showKeyboardBuilder(chatID, state)
+	case "kb_placeholder":
+		state.CurrentAction = actionBuilderPlaceholder
+		sendBuilderPrompt(chatID, "Введите подсказку для поля ввода (или «-», чтобы убрать):")
+	case "kb_back":
+		resetBuilderPending(state)
+		showKeyboardBuilder(chatID, state)
+	case "kb_done":
+		if err := kb.Validate(); err != nil {
+			sendMessage(chatID, "❌ "+err.Error())
+			return
+		}
+		finishTemplateKeyboard(chatID, callback.From.ID, state, kb)
+	}
+}
+
+// handleKeyboardBuilderInput обрабатывает текст, который конструктор
+// запросил у пользователя.
+func handleKeyboardBuilderInput(message *tgbotapi.Message, state *UserState) {
+	chatID := message.Chat.ID
+	text := strings.TrimSpace(message.Text)
+	if text == "" {
+		sendMessage(chatID, "❌ Отправьте текст")
+		return
+	}
+
+	if state.CurrentAction == actionBuilderPlaceholder {
+		if text == "-" {
+			text = ""
+		}
+		if utf8.RuneCountInString(text) > 64 {
+			sendMessage(chatID, "❌ Подсказка длиннее 64 символов")
+			return
+		}
+		builderKeyboard(state).Placeholder = text
+		returnToBuilder(chatID, state)
+		return
+	}
+
+	pending, ok := state.TempData["builder_pending"].(*keyboard.Button)
+	if !ok {
+		returnToBuilder(chatID, state)
+		return
+	}
+
+	switch state.CurrentAction {
+	case actionBuilderText:
+		if utf8.RuneCountInString(text) > 64 {
+			sendMessage(chatID, "❌ Текст кнопки длиннее 64 символов")
+			return
+		}
+		pending.Text = text
+		if rename, _ := state.TempData["builder_rename"].(bool); rename {
+			commitBuilderButton(chatID, state)
+			return
+		}
+		askBuilderTarget(chatID, message.From.ID, state, pending)
+	case actionBuilderURL:
+		pending.URL = text
+		commitBuilderButton(chatID, state)
+	case actionBuilderNode:
+		pending.Node = text
+		if missing := missingTemplates(message.From.ID, []string{text}); len(missing) > 0 {
+			sendMessage(chatID, fmt.Sprintf("⚠️ Шаблон «%s» пока не создан. Кнопка заработает, когда он появится.", text))
+		}
+		commitBuilderButton(chatID, state)
+	case actionBuilderQuery:
+		pending.Query = text
+		commitBuilderButton(chatID, state)
+	}
+}
+
+func isBuilderAction(action string) bool {
+	switch action {
+	case "awaiting_template_keyboard", actionBuilderText, actionBuilderURL,
+		actionBuilderNode, actionBuilderQuery, actionBuilderPlaceholder:
+		return true
+	}
+	return false
+}
+
+func setBuilderPending(state *UserState, row, col int, b *keyboard.Button) {
+	state.TempData["builder_pending"] = b
+	state.TempData["builder_row"] = row
+	state.TempData["builder_col"] = col
+	delete(state.TempData, "builder_rename")
+}
+
+func resetBuilderPending(state *UserState) {
+	delete(state.TempData, "builder_pending")
+	delete(state.TempData, "builder_row")
+	delete(state.TempData, "builder_col")
+	delete(state.TempData, "builder_rename")
+	state.CurrentAction = "awaiting_template_keyboard"
+}
+
+// startBuilderButton начинает добавление кнопки (col = -1) или смену типа
+// существующей и предлагает типы, допустимые для текущей клавиатуры.
+func startBuilderButton(chatID int64, state *UserState, row, col int, b *keyboard.Button) {
+	if b == nil {
+		b = &keyboard.Button{}
+	}
+	setBuilderPending(state, row, col, b)
+	state.CurrentAction = "awaiting_template_keyboard"
+
+	var buttons []tgbotapi.InlineKeyboardButton
+	if builderKeyboard(state).Type == keyboard.TypeInline {
+		buttons = append(buttons,
+			tgbotapi.NewInlineKeyboardButtonData("➡️ Переход", "kb_btn_type:"+string(keyboard.ButtonCallback)),
+			tgbotapi.NewInlineKeyboardButtonData("🔗 Ссылка", "kb_btn_type:"+string(keyboard.ButtonURL)),
+			tgbotapi.NewInlineKeyboardButtonData("↪️ Inline", "kb_btn_type:"+string(keyboard.ButtonSwitchInline)),
+		)
+	} else {
+		buttons = append(buttons,
+			tgbotapi.NewInlineKeyboardButtonData("💬 Текст", "kb_btn_type:"+string(keyboard.ButtonText)),
+		)
+	}
+	buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData("🌐 WebApp", "kb_btn_type:"+string(keyboard.ButtonWebApp)))
+
+	msg := tgbotapi.NewMessage(chatID, "Выберите тип кнопки:")
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		buttons,
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("⬅️ Назад", "kb_back")),
+	)
+	send(msg)
+}
+
+// askBuilderTarget запрашивает данные, которые нужны кнопке выбранного типа.
+func askBuilderTarget(chatID, userID int64, state *UserState, b *keyboard.Button) {
+	switch b.Type {
+	case keyboard.ButtonURL:
+		state.CurrentAction = actionBuilderURL
+		sendBuilderPrompt(chatID, "Введите ссылку (https://, http:// или tg://):")
+	case keyboard.ButtonWebApp:
+		state.CurrentAction = actionBuilderURL
+		sendBuilderPrompt(chatID, "Введите ссылку на WebApp (https://):")
+	case keyboard.ButtonSwitchInline:
+		state.CurrentAction = actionBuilderQuery
+		msg := tgbotapi.NewMessage(chatID, "Введите текст inline-запроса:")
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("Пустой запрос", "kb_query_empty")),
+			tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("⬅️ Назад", "kb_back")),
+		)
+		send(msg)
+	case keyboard.ButtonCallback, keyboard.ButtonText:
+		state.CurrentAction = "awaiting_template_keyboard"
+		askBuilderNode(chatID, userID, b.Type == keyboard.ButtonText)
+	default:
+		commitBuilderButton(chatID, state)
+	}
+}
+
+// askBuilderNode предлагает выбрать шаблон для перехода из списка.
+// Для текстовой кнопки переход необязателен.
+func askBuilderNode(chatID, userID int64, optional bool) {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, t := range getUserTemplates(userID) {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("📄 "+t.Name, fmt.Sprintf("kb_node:%d", t.ID)),
+		))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("✏️ Ввести название", "kb_node_manual"),
+	))
+	if optional {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Без перехода", "kb_node_none"),
+		))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("⬅️ Назад", "kb_back")))
+
+	msg := tgbotapi.NewMessage(chatID, "К какому шаблону ведёт кнопка?")
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	send(msg)
+}
+
+func sendBuilderPrompt(chatID int64, text string) {
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("⬅️ Назад", "kb_back")),
+	)
+	send(msg)
+}
+
+// commitBuilderButton вставляет подготовленную кнопку в клавиатуру.
+// Некорректная кнопка не сохраняется, а пользователь видит причину.
+func commitBuilderButton(chatID int64, state *UserState) {
+	pending, ok := state.TempData["builder_pending"].(*keyboard.Button)
+	if !ok {
+		returnToBuilder(chatID, state)
+		return
+	}
+	row, _ := state.TempData["builder_row"].(int)
+	col, _ := state.TempData["builder_col"].(int)
+
+	kb := builderKeyboard(state)
+	check := *kb
+	check.Rows = [][]keyboard.Button{{*pending}}
+	if err := check.Validate(); err != nil {
+		sendMessage(chatID, "❌ "+strings.TrimPrefix(err.Error(), "кнопка 1 в строке 1: "))
+		if state.CurrentAction != "awaiting_template_keyboard" {
+			// Ждём исправленный ввод на том же шаге.
+			return
+		}
+		returnToBuilder(chatID, state)
+		return
+	}
+
+	switch {
+	case row == len(kb.Rows):
+		kb.Rows = append(kb.Rows, []keyboard.Button{*pending})
+	case row >= 0 && row < len(kb.Rows) && col < 0:
+		kb.Rows[row] = append(kb.Rows[row], *pending)
+	case row >= 0 && row < len(kb.Rows) && col < len(kb.Rows[row]):
+		kb.Rows[row][col] = *pending
+	}
+
+	returnToBuilder(chatID, state)
+}
+
+// returnToBuilder показывает конструктор новым сообщением, чтобы
+// предпросмотр оказался под вводом пользователя.
+func returnToBuilder(chatID int64, state *UserState) {
+	resetBuilderPending(state)
+	delete(state.TempData, "builder_msg")
+	showKeyboardBuilder(chatID, state)
+}
+
+func showBuilderButton(chatID int64, state *UserState, row, col int, b keyboard.Button) {
+	pos := fmt.Sprintf("%d:%d", row, col)
+	msgID, _ := state.TempData["builder_msg"].(int)
+	text := fmt.Sprintf("Кнопка %s (тип %s, строка %d, позиция %d)", describeButton(b), b.Type, row+1, col+1)
+	markup := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✏️ Переименовать", "kb_rename:"+pos),
+			tgbotapi.NewInlineKeyboardButtonData("🔄 Тип и действие", "kb_retype:"+pos),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("⬅️", "kb_move:"+pos+":left"),
+			tgbotapi.NewInlineKeyboardButtonData("⬆️", "kb_move:"+pos+":up"),
+			tgbotapi.NewInlineKeyboardButtonData("⬇️", "kb_move:"+pos+":down"),
+			tgbotapi.NewInlineKeyboardButtonData("➡️", "kb_move:"+pos+":right"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🗑 Удалить", "kb_del:"+pos),
+			tgbotapi.NewInlineKeyboardButtonData("⬅️ Назад", "kb_back"),
+		),
+	)
+	send(tgbotapi.NewEditMessageTextAndMarkup(chatID, msgID, text, markup))
+}
+
+// moveBuilderButton сдвигает кнопку внутри строки или переносит её в конец
+// соседней строки. Перенос вниз из последней строки создаёт новую строку.
+func moveBuilderButton(kb *keyboard.Keyboard, row, col int, dir string) bool {
+	b, ok := kb.Button(row, col)
+	if !ok {
+		return false
+	}
+
+	switch dir {
+	case "left", "right":
+		target := col - 1
+		if dir == "right" {
+			target = col + 1
+		}
+		if target < 0 || target >= len(kb.Rows[row]) {
+			return false
+		}
+		kb.Rows[row][col], kb.Rows[row][target] = kb.Rows[row][target], kb.Rows[row][col]
+		return true
+	case "up":
+		if row == 0 || len(kb.Rows[row-1]) >= builderRowLimit {
+			return false
+		}
+		kb.Rows[row-1] = append(kb.Rows[row-1], b)
+		removeBuilderButton(kb, row, col)
+		return true
+	case "down":
+		if row == len(kb.Rows)-1 {
+			if len(kb.Rows[row]) == 1 {
+				return false
+			}
+			kb.Rows = append(kb.Rows, []keyboard.Button{b})
+			removeBuilderButton(kb, row, col)
+			return true
+		}
+		if len(kb.Rows[row+1]) >= builderRowLimit {
+			return false
+		}
+		kb.Rows[row+1] = append(kb.Rows[row+1], b)
+		removeBuilderButton(kb, row, col)
+		return true
+	}
+	return false
+}
+
+// removeBuilderButton удаляет кнопку, опустевшая строка удаляется целиком.
+func removeBuilderButton(kb *keyboard.Keyboard, row, col int) {
+	kb.Rows[row] = append(kb.Rows[row][:col:col], kb.Rows[row][col+1:]...)
+	if len(kb.Rows[row]) == 0 {
+		kb.Rows = append(kb.Rows[:row:row], kb.Rows[row+1:]...)
+	}
+}
+
+// toggleBuilderType переключает reply/inline, если все кнопки совместимы
+// с новым типом.
+func toggleBuilderType(chatID int64, state *UserState, kb *keyboard.Keyboard) {
+	next := *kb
+	if kb.Type == keyboard.TypeReply {
+		next.Type = keyboard.TypeInline
+		next.Resize, next.OneTime, next.Placeholder = false, false, ""
+	} else {
+		next.Type = keyboard.TypeReply
+		next.Resize = true
+	}
+
+	if len(next.Rows) > 0 {
+		if err := next.Validate(); err != nil {
+			sendMessage(chatID, "❌ Нельзя сменить тип: "+err.Error()+"\nИзмените или удалите несовместимые кнопки.")
+			return
+		}
+	}
+
+	*kb = next
+	showKeyboardBuilder(chatID, state)
+}
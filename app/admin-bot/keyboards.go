@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"shared/keyboard"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// describeKeyboard выводит клавиатуру шаблона в виде текста для владельца.
+func describeKeyboard(kb *keyboard.Keyboard) string {
+	var sb strings.Builder
+	if kb.Type == keyboard.TypeInline {
+		sb.WriteString("inline")
+	} else {
+		sb.WriteString("reply")
+		var opts []string
+		if kb.Resize {
+			opts = append(opts, "resize")
+		}
+		if kb.OneTime {
+			opts = append(opts, "one-time")
+		}
+		if kb.Placeholder != "" {
+			opts = append(opts, fmt.Sprintf("подсказка «%s»", kb.Placeholder))
+		}
+		if len(opts) > 0 {
+			sb.WriteString(" (" + strings.Join(opts, ", ") + ")")
+		}
+	}
+
+	for _, row := range kb.Rows {
+		sb.WriteString("\n")
+		for _, b := range row {
+			sb.WriteString(describeButton(b) + " ")
+		}
+	}
+	return sb.String()
+}
+
+func describeButton(b keyboard.Button) string {
+	switch b.Type {
+	case keyboard.ButtonURL:
+		return fmt.Sprintf("[🔗 %s → %s]", b.Text, b.URL)
+	case keyboard.ButtonCallback:
+		return fmt.Sprintf("[%s → %s]", b.Text, b.Node)
+	case keyboard.ButtonSwitchInline:
+		return fmt.Sprintf("[↪️ %s]", b.Text)
+	case keyboard.ButtonWebApp:
+		return fmt.Sprintf("[🌐 %s → %s]", b.Text, b.URL)
+	}
+	if b.Node != "" {
+		return fmt.Sprintf("[%s → %s]", b.Text, b.Node)
+	}
+	return fmt.Sprintf("[%s]", b.Text)
+}
+
+// missingTemplates возвращает имена шаблонов из списка, которых у
+// пользователя нет.
+func missingTemplates(userID int64, names []string) []string {
+	if len(names) == 0 {
+		return nil
+	}
+
+	rows, err := db.Query(`
+        SELECT name FROM bot_templates
+        WHERE user_id = $1 AND name = ANY($2)`, userID, pq.Array(names))
+	if err != nil {
+		log.Printf("Database query error: %v", err)
+		return nil
+	}
+	defer rows.Close()
+
+	found := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			log.Printf("Row scan error: %v", err)
+			continue
+		}
+		found[name] = true
+	}
+
+	var missing []string
+	for _, name := range names {
+		if !found[name] {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
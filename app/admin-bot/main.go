@@ -12,6 +12,11 @@ import (
 	"math/rand"
 	"os"
 	"regexp"
+	"shared/content"
+	"shared/keyboard"
+	"shared/media"
+	sharedredis "shared/redis"
+	"shared/sender"
 	"strconv"
 	"strings"
 	"sync"
@@ -31,7 +36,9 @@ type UserState struct {
 
 var (
 	bot        *tgbotapi.BotAPI
+	out        *sender.Sender
 	db         *sql.DB
+	limiter    *sharedredis.RateLimiter
 	userStates = make(map[int64]*UserState)
 	stateMutex sync.RWMutex
 )
@@ -59,6 +66,7 @@ func main() {
 	if err != nil {
 		log.Panic(err)
 	}
+	out = sender.New(bot)
 
 	// Инициализация базы данных
 	db, err = initDB()
@@ -71,21 +79,30 @@ func main() {
 	if err := checkDatabase(); err != nil {
 		log.Panicf("Database check failed: %v", err)
 	}
-	bot.Debug = true
-	log.Printf("Authorized on account %s", bot.Self.UserName)
+	// Redis нужен для ограничения частоты действий в мастерах
+	if err := sharedredis.Init(); err != nil {
+		log.Printf("Redis unavailable, admin rate limiting disabled: %v", err)
+	} else {
+		limiter = sharedredis.NewRateLimiter(sharedredis.Client)
+		defer sharedredis.Close()
+	}
 
-	u := tgbotapi.NewUpdate(0)
-	u.Timeout = 60
-	u.AllowedUpdates = []string{tgbotapi.UpdateTypeMessage, tgbotapi.UpdateTypeCallbackQuery}
+	// Медиатека нужна для шаблонов с фото, видео и документами
+	if mediaStorage, err = media.NewStorageFromEnv(); err != nil {
+		log.Printf("Media storage unavailable, media templates disabled: %v", err)
+	}
 
-	updates := bot.GetUpdatesChan(u)
+	bot.Debug = os.Getenv("ADMIN_DEBUG") == "true"
+	log.Printf("Authorized on account %s", bot.Self.UserName)
 
-	for update := range updates {
-		if update.Message != nil {
-			handleMessage(update.Message)
-		} else if update.CallbackQuery != nil {
-			handleCallback(update.CallbackQuery)
-		}
+	// Фоновые задачи и состояния мастеров живут в памяти процесса
+	go watchUndeliveredMessages()
+	go watchScheduledPublications()
+	go watchWebhooks()
+	go watchDeactivatedBots()
+
+	if err := receiveUpdates(); err != nil {
+		log.Panicf("Admin bot stopped: %v", err)
 	}
 }
 
@@ -151,19 +168,24 @@ func CompleteTemplateCreation(bot *tgbotapi.BotAPI, db *sql.DB, userID int64, ch
 		return fmt.Errorf("invalid template name")
 	}
 
+	parseMode, _ := templateData["parse_mode"].(string)
+	mediaType, _ := templateData["media_type"].(string)
+	mediaFileID, _ := templateData["media_file_id"].(string)
+
+	// У шаблона с медиа подпись необязательна.
 	content, ok := templateData["content"].(string)
-	if !ok || strings.TrimSpace(content) == "" {
+	if !ok || (strings.TrimSpace(content) == "" && mediaType == "") {
 		sendMessage(chatID, "❌ Неверное содержание шаблона")
 		return fmt.Errorf("invalid template content")
 	}
 
-	keyboard, ok := templateData["keyboard"].([][]string)
-	if !ok || len(keyboard) == 0 {
+	kb, ok := templateData["keyboard"].(*keyboard.Keyboard)
+	if !ok || kb.Validate() != nil {
 		sendMessage(chatID, "❌ Неверный формат клавиатуры")
 		return fmt.Errorf("invalid keyboard format")
 	}
 
-	keyboardJSON, err := json.Marshal(keyboard)
+	keyboardJSON, err := kb.Marshal()
 	if err != nil {
 		sendMessage(chatID, "❌ Ошибка обработки клавиатуры")
 		return fmt.Errorf("keyboard marshal error: %v", err)
@@ -171,8 +193,8 @@ func CompleteTemplateCreation(bot *tgbotapi.BotAPI, db *sql.DB, userID int64, ch
 
 	query := `
         INSERT INTO bot_templates 
-        (user_id, name, content, keyboard, is_active, created_at, updated_at)
-        VALUES ($1, $2, $3, $4, $5, $6, $7)
+        (user_id, name, content, keyboard, is_active, created_at, updated_at, parse_mode, media_type, media_file_id, media_id)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
         RETURNING id`
 
 	var templateID int64
@@ -184,6 +206,10 @@ func CompleteTemplateCreation(bot *tgbotapi.BotAPI, db *sql.DB, userID int64, ch
 		true,
 		time.Now(),
 		time.Now(),
+		parseMode,
+		mediaType,
+		mediaFileID,
+		nullMediaID(templateData),
 	).Scan(&templateID)
 
 	if err != nil {
@@ -201,34 +227,62 @@ func CompleteTemplateCreation(bot *tgbotapi.BotAPI, db *sql.DB, userID int64, ch
 }
 
 func ShowTemplateDetails(bot *tgbotapi.BotAPI, chatID int64, template models.BotTemplate) {
-	var keyboard [][]string
-	if err := json.Unmarshal(template.Keyboard, &keyboard); err != nil {
-		log.Printf("Ошибка разбора клавиатуры: %v", err)
-		keyboard = [][]string{{"Ошибка отображения"}}
-	}
-
 	msgText := fmt.Sprintf(
-		"📋 Шаблон: %s\n\nID: %d\nСодержание:\n%s\n\nКлавиатура:",
+		"📋 Шаблон: %s\n\nID: %d\nСодержание:\n%s",
 		template.Name, template.ID, template.Content)
+	if template.ParseMode != "" {
+		msgText += "\nРазметка: " + template.ParseMode
+	}
+	if template.MediaType != "" {
+		msgText += "\nМедиа: " + template.MediaType
+	}
+	if template.Version > 0 {
+		msgText += fmt.Sprintf("\nОпубликована версия: %d", template.Version)
+	}
+	msgText += "\n\nКлавиатура:"
 
-	for _, row := range keyboard {
-		msgText += "\n"
-		for _, btn := range row {
-			msgText += fmt.Sprintf("[%s] ", btn)
-		}
+	kb, err := keyboard.Parse(template.Keyboard)
+	switch {
+	case err != nil:
+		log.Printf("Ошибка разбора клавиатуры: %v", err)
+		msgText += "\n[Ошибка отображения]"
+	case kb == nil:
+		msgText += " нет"
+	default:
+		msgText += " " + describeKeyboard(kb)
+	}
+
+	draft, err := loadDraft(template.ID)
+	if err != nil {
+		log.Printf("Database query error: %v", err)
+	}
+	if draft != nil {
+		msgText += describeDraft(draft)
 	}
 
 	msg := tgbotapi.NewMessage(chatID, msgText)
 
-	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+	var rows [][]tgbotapi.InlineKeyboardButton
+	if draft != nil {
+		rows = draftButtons(template.ID)
+	}
+	rows = append(rows,
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("👁 Предпросмотр", fmt.Sprintf("preview_template:%d", template.ID)),
+			tgbotapi.NewInlineKeyboardButtonData("📤 Экспорт", fmt.Sprintf("export_menu:%d", template.ID)),
+		),
 		tgbotapi.NewInlineKeyboardRow(
 			tgbotapi.NewInlineKeyboardButtonData("✏️ Редактировать", fmt.Sprintf("edit_template:%d", template.ID)),
 			tgbotapi.NewInlineKeyboardButtonData("❌ Удалить", fmt.Sprintf("delete_template:%d", template.ID)),
 		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🕓 История", fmt.Sprintf("history:%d", template.ID)),
+		),
 		tgbotapi.NewInlineKeyboardRow(
 			tgbotapi.NewInlineKeyboardButtonData("⬅️ Назад", "list_templates"),
 		),
 	)
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
 
 	send(msg)
 }
@@ -259,7 +313,20 @@ func sendJSONError(chatID int64) {
     [
         ["Да"],
         ["Нет"]
-    ]`
+    ]
+
+Inline-кнопки со ссылками и переходами:
+
+    {
+        "type": "inline",
+        "rows": [
+            [{"type": "url", "text": "Сайт", "url": "https://example.com"}],
+            [{"type": "callback", "text": "Далее", "node": "Шаг 2"}]
+        ]
+    }
+
+Типы кнопок: text, url, callback, switch_inline, web_app.
+Для reply-клавиатуры доступны resize, one_time и placeholder.`
 
 	msg := tgbotapi.NewMessage(chatID, "❌ Неверный формат JSON. Пожалуйста, используйте один из следующих форматов:\n"+example)
 	msg.ParseMode = "Markdown"
@@ -274,20 +341,20 @@ func HandleStart(bot *tgbotapi.BotAPI, db *gorm.DB, update tgbotapi.Update) {
 	if err != nil {
 		log.Printf("Ошибка создания пользователя: %v", err)
 		msg := tgbotapi.NewMessage(update.Message.Chat.ID, "❌ Ошибка инициализации")
-		bot.Send(msg)
+		send(msg)
 		return
 	}
 	isOwner, err := userRepo.IsOwner(user.TelegramID)
 	if err != nil {
 		log.Printf("Ошибка проверки владельца: %v", err)
 		msg := tgbotapi.NewMessage(update.Message.Chat.ID, "❌ Ошибка проверки доступа")
-		bot.Send(msg)
+		send(msg)
 		return
 	}
 
 	if !isOwner {
 		msg := tgbotapi.NewMessage(update.Message.Chat.ID, "⛔ Доступ только для владельцев")
-		bot.Send(msg)
+		send(msg)
 		return
 	}
 
@@ -304,21 +371,44 @@ func ShowOwnerPanel(bot *tgbotapi.BotAPI, chatID int64) {
 			tgbotapi.NewInlineKeyboardButtonData("➕ Создать шаблон", "add_template"),
 		),
 		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("📋 Мои боты", "my_bots"),
 			tgbotapi.NewInlineKeyboardButtonData("⚙️ Настройки", "settings"),
 			tgbotapi.NewInlineKeyboardButtonData("💳 Тарифы", "billing"),
 		),
 	)
 
 	msg.ReplyMarkup = keyboard
-	bot.Send(msg)
+	send(msg)
 }
 func handleCallback(callback *tgbotapi.CallbackQuery) {
+	// Кнопки шаблона в предпросмотре отвечают сами: ответ показывает,
+	// куда ведёт кнопка
+	if _, _, ok := keyboard.ParseCallbackData(callback.Data); ok {
+		handlePreviewButton(callback)
+		return
+	}
+
 	callbackCfg := tgbotapi.NewCallback(callback.ID, "")
-	bot.Request(callbackCfg)
+	if _, err := out.Request(context.Background(), callbackCfg); err != nil {
+		log.Printf("Error answering callback query: %v", err)
+	}
 
 	parts := strings.Split(callback.Data, ":")
 	action := parts[0]
 
+	switch action {
+	case "add_bot", "add_template", "select_template_for_bot", "confirm_bot_creation", "export", "import_apply", "edit_template", "rollback", "publish", "bot_start", "bot_stop", "bot_reload", "bot_token", "profile_cmds_set", "profile_cmds_del", "profile_menu_set":
+		if !allowAdminAction(callback.From.ID, callback.Message.Chat.ID) {
+			return
+		}
+	}
+	if strings.HasPrefix(action, "kb_") {
+		if allowAdminAction(callback.From.ID, callback.Message.Chat.ID) {
+			handleKeyboardBuilderCallback(callback, action, parts)
+		}
+		return
+	}
+
 	switch action {
 	case "add_bot":
 		handleAddBotStart(callback)
@@ -369,6 +459,9 @@ func handleCallback(callback *tgbotapi.CallbackQuery) {
 			msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
 				tgbotapi.NewInlineKeyboardRow(
 					tgbotapi.NewInlineKeyboardButtonData("➕ Создать шаблон", "add_template"),
+					tgbotapi.NewInlineKeyboardButtonData("📥 Импорт", "import_templates"),
+				),
+				tgbotapi.NewInlineKeyboardRow(
 					tgbotapi.NewInlineKeyboardButtonData("⬅️ Назад", "main_menu"),
 				),
 			)
@@ -383,6 +476,141 @@ func handleCallback(callback *tgbotapi.CallbackQuery) {
 	case "main_menu":
 		clearUserState(callback.From.ID)
 		ShowOwnerPanel(bot, callback.Message.Chat.ID)
+	case "preview_template":
+		if len(parts) < 2 {
+			sendMessage(callback.Message.Chat.ID, "Ошибка: не указан ID шаблона")
+			return
+		}
+		templateID, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			sendMessage(callback.Message.Chat.ID, "Ошибка: неверный ID шаблона")
+			return
+		}
+		PreviewTemplate(callback.Message.Chat.ID, callback.From.ID, templateID)
+	case "preview_end":
+		endPreview(callback.Message.Chat.ID, callback.From.ID)
+	case "export_menu":
+		if len(parts) < 2 {
+			sendMessage(callback.Message.Chat.ID, "Ошибка: не указан ID шаблона")
+			return
+		}
+		templateID, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			sendMessage(callback.Message.Chat.ID, "Ошибка: неверный ID шаблона")
+			return
+		}
+		ShowExportMenu(callback.Message.Chat.ID, callback.From.ID, templateID)
+	case "export":
+		if len(parts) < 4 {
+			sendMessage(callback.Message.Chat.ID, "Ошибка: неверные параметры экспорта")
+			return
+		}
+		templateID, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			sendMessage(callback.Message.Chat.ID, "Ошибка: неверный ID шаблона")
+			return
+		}
+		ExportTemplates(callback.Message.Chat.ID, callback.From.ID, templateID, parts[2], parts[3])
+	case "edit_template", "history":
+		if len(parts) < 2 {
+			sendMessage(callback.Message.Chat.ID, "Ошибка: не указан ID шаблона")
+			return
+		}
+		templateID, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			sendMessage(callback.Message.Chat.ID, "Ошибка: неверный ID шаблона")
+			return
+		}
+		if action == "history" {
+			ShowTemplateHistory(callback.Message.Chat.ID, callback.From.ID, templateID)
+		} else {
+			EditTemplate(callback.Message.Chat.ID, callback.From.ID, templateID)
+		}
+	case "publish", "schedule", "unschedule", "discard_draft", "preview_draft":
+		if len(parts) < 2 {
+			sendMessage(callback.Message.Chat.ID, "Ошибка: не указан ID шаблона")
+			return
+		}
+		templateID, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			sendMessage(callback.Message.Chat.ID, "Ошибка: неверный ID шаблона")
+			return
+		}
+		switch action {
+		case "publish":
+			PublishTemplate(callback.Message.Chat.ID, callback.From.ID, templateID)
+		case "schedule":
+			AskPublishTime(callback.Message.Chat.ID, callback.From.ID, templateID)
+		case "unschedule":
+			UnschedulePublish(callback.Message.Chat.ID, callback.From.ID, templateID)
+		case "discard_draft":
+			DiscardDraft(callback.Message.Chat.ID, callback.From.ID, templateID)
+		default:
+			PreviewDraft(callback.Message.Chat.ID, callback.From.ID, templateID)
+		}
+	case "edit_keep_content":
+		keepTemplateContent(callback.Message.Chat.ID, callback.From.ID)
+	case "version", "rollback", "version_diff":
+		if len(parts) < 3 {
+			sendMessage(callback.Message.Chat.ID, "Ошибка: не указана версия")
+			return
+		}
+		templateID, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			sendMessage(callback.Message.Chat.ID, "Ошибка: неверный ID шаблона")
+			return
+		}
+		version, err := strconv.Atoi(parts[2])
+		if err != nil {
+			sendMessage(callback.Message.Chat.ID, "Ошибка: неверная версия")
+			return
+		}
+		switch action {
+		case "version":
+			ShowTemplateVersion(callback.Message.Chat.ID, callback.From.ID, templateID, version)
+		case "rollback":
+			RollbackTemplate(callback.Message.Chat.ID, callback.From.ID, templateID, version)
+		default:
+			to := 0
+			if len(parts) > 3 {
+				to, _ = strconv.Atoi(parts[3])
+			}
+			ShowVersionDiff(callback.Message.Chat.ID, callback.From.ID, templateID, version, to)
+		}
+	case "import_templates":
+		StartImport(callback.Message.Chat.ID, callback.From.ID)
+	case "import_apply":
+		if len(parts) < 2 {
+			return
+		}
+		ApplyImport(callback.Message.Chat.ID, callback.From.ID, parts[1])
+	case "my_bots":
+		ShowBotsList(callback.Message.Chat.ID, callback.From.ID)
+	case "bot_view", "bot_start", "bot_stop", "bot_reload", "bot_token":
+		if len(parts) < 2 {
+			return
+		}
+		botID, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			sendMessage(callback.Message.Chat.ID, "Ошибка: неверный ID бота")
+			return
+		}
+		switch action {
+		case "bot_view":
+			ShowBotDetails(callback.Message.Chat.ID, callback.From.ID, botID)
+		case "bot_start", "bot_stop":
+			SetBotActive(callback.Message.Chat.ID, callback.From.ID, botID, action == "bot_start")
+		case "bot_reload":
+			ReloadBotTemplates(callback.Message.Chat.ID, callback.From.ID, botID)
+		case "bot_token":
+			StartReplaceToken(callback.Message.Chat.ID, callback.From.ID, botID)
+		}
+	case "bot_profile", "profile_edit", "profile_cmds", "profile_cmds_set", "profile_cmds_del", "profile_menu", "profile_menu_set":
+		handleProfileCallback(callback, action, parts)
+	case "dead_letters":
+		ShowDeadLetters(callback.Message.Chat.ID, callback.From.ID)
+	case "dlq_view", "dlq_replay", "dlq_discard", "dlq_replay_all":
+		handleDeadLetterCallback(callback, action, parts)
 	}
 }
 
@@ -424,13 +652,13 @@ func handleConfirmBotCreation(callback *tgbotapi.CallbackQuery) {
 		return
 	}
 
-	// Запускаем Worker для обработки этого бота
-	go startBotWorker(botToken, templateID)
-
 	sendMessage(callback.Message.Chat.ID, fmt.Sprintf(
 		"✅ Бот успешно создан!\n\nТокен: %s\nШаблон: %d\nРеферальный код: %s",
 		maskToken(botToken), templateID, refCode))
 
+	// Бот считается запущенным, только когда воркер подтвердит команду
+	startBot(callback.Message.Chat.ID, botToken)
+
 	clearUserState(callback.From.ID)
 	ShowOwnerPanel(bot, callback.Message.Chat.ID)
 }
@@ -450,38 +678,21 @@ func createBotInDB(userID int64, botToken string, templateID int64, refCode stri
 		time.Now(),
 		time.Now(),
 	)
+	if err == nil {
+		notifyBindingChanged(botToken)
+	}
 
 	return err
 }
 
 func registerWebhook(botToken string) error {
-	// URL вебхука должен быть зарегистрирован для всех ботов
-	webhookURL := os.Getenv("WEBHOOK_URL") + "/webhook/" + botToken
-
 	botAPI, err := tgbotapi.NewBotAPI(botToken)
 	if err != nil {
 		return err
 	}
 
-	// Исправленная часть:
-	wh, err := tgbotapi.NewWebhook(webhookURL)
-	if err != nil {
-		return fmt.Errorf("failed to create webhook config: %v", err)
-	}
-
-	_, err = botAPI.Request(wh)
-	return err
-}
-
-func startBotWorker(botToken string, templateID int64) {
-	// Здесь должна быть реализация Worker для обработки бота
-	// Это может быть отдельный процесс, который слушает обновления
-	// и обрабатывает их согласно шаблону
-
-	log.Printf("Starting worker for bot with token: %s and template: %d", maskToken(botToken), templateID)
-
-	// Реализация Worker будет зависеть от вашей архитектуры
-	// Это может быть вызов внешнего сервиса или запуск горутины
+	// URL вебхука должен быть зарегистрирован для всех ботов
+	return setBotWebhook(botAPI, botToken)
 }
 
 func generateRefCode() string {
@@ -514,6 +725,8 @@ func ShowTemplatesList(bot *tgbotapi.BotAPI, chatID int64, templates []models.Bo
 	// Добавляем кнопки управления
 	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
 		tgbotapi.NewInlineKeyboardButtonData("➕ Создать новый", "add_template"),
+		tgbotapi.NewInlineKeyboardButtonData("📥 Импорт", "import_templates"),
+	), tgbotapi.NewInlineKeyboardRow(
 		tgbotapi.NewInlineKeyboardButtonData("⬅️ Назад", "main_menu"),
 	))
 
@@ -523,7 +736,8 @@ func ShowTemplatesList(bot *tgbotapi.BotAPI, chatID int64, templates []models.Bo
 
 func getTemplateByID(templateID int64) *models.BotTemplate {
 	row := db.QueryRow(`
-        SELECT id, user_id, name, content, keyboard, is_active, created_at, updated_at
+        SELECT id, user_id, name, content, keyboard, is_active, created_at, updated_at,
+               parse_mode, media_type, media_file_id, media_id, version
         FROM bot_templates WHERE id = $1`, templateID)
 
 	var t models.BotTemplate
@@ -538,6 +752,11 @@ func getTemplateByID(templateID int64) *models.BotTemplate {
 		&t.IsActive,
 		&t.CreatedAt,
 		&t.UpdatedAt,
+		&t.ParseMode,
+		&t.MediaType,
+		&t.MediaFileID,
+		&t.MediaID,
+		&t.Version,
 	)
 
 	if err != nil {
@@ -548,6 +767,10 @@ func getTemplateByID(templateID int64) *models.BotTemplate {
 	t.Keyboard = keyboardJSON
 	return &t
 }
+
+// saveTemplate создаёт шаблон или, если в data есть template_id, сохраняет
+// изменения существующего шаблона в черновик. Новый шаблон сразу
+// публикуется первой версией: ботов, которые бы его использовали, ещё нет.
 func saveTemplate(userID int64, data map[string]interface{}) error {
 	if err := db.Ping(); err != nil {
 		log.Printf("Database ping failed: %v", err)
@@ -564,42 +787,142 @@ func saveTemplate(userID int64, data map[string]interface{}) error {
 		return fmt.Errorf("invalid content data")
 	}
 
-	keyboard, ok := data["keyboard"].([][]string)
+	kb, ok := data["keyboard"].(*keyboard.Keyboard)
 	if !ok {
 		return fmt.Errorf("invalid keyboard data")
 	}
 
-	keyboardJSON, err := json.Marshal(keyboard)
+	keyboardJSON, err := kb.Marshal()
 	if err != nil {
 		log.Printf("Keyboard marshal error: %v", err)
 		return fmt.Errorf("keyboard format error")
 	}
 
-	query := `
+	parseMode, _ := data["parse_mode"].(string)
+	mediaType, _ := data["media_type"].(string)
+	mediaFileID, _ := data["media_file_id"].(string)
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		return fmt.Errorf("database save error")
+	}
+	defer tx.Rollback()
+
+	id, editing := data["template_id"].(int64)
+	if editing {
+		if template := getTemplateByID(id); template == nil || template.UserID != userID {
+			err = sql.ErrNoRows
+		} else {
+			draft := &templateDraft{
+				TemplateID:  id,
+				Content:     content,
+				Keyboard:    keyboardJSON,
+				ParseMode:   parseMode,
+				MediaType:   mediaType,
+				MediaFileID: mediaFileID,
+				AuthorID:    userID,
+			}
+			if mediaID := nullMediaID(data); mediaID.Valid {
+				draft.MediaID = &mediaID.Int64
+			}
+			err = saveDraft(tx, draft)
+		}
+	} else {
+		query := `
         INSERT INTO bot_templates 
-        (user_id, name, content, keyboard, is_active, created_at) 
-        VALUES ($1, $2, $3, $4, $5, $6)
+        (user_id, name, content, keyboard, is_active, created_at, updated_at, parse_mode, media_type, media_file_id, media_id) 
+        VALUES ($1, $2, $3, $4, $5, $6, $6, $7, $8, $9, $10)
         RETURNING id`
 
-	var id int64
-	err = db.QueryRow(query,
-		userID,
-		name,
-		content,
-		string(keyboardJSON),
-		true,
-		time.Now(),
-	).Scan(&id)
+		err = tx.QueryRow(query,
+			userID,
+			name,
+			content,
+			string(keyboardJSON),
+			true,
+			time.Now(),
+			parseMode,
+			mediaType,
+			mediaFileID,
+			nullMediaID(data),
+		).Scan(&id)
+		if err == nil {
+			_, err = recordVersion(tx, id, userID, "Создание")
+		}
+	}
 
 	if err != nil {
-		log.Printf("Database error: %v\nQuery: %s\nParams: %d, %s, %s, %s, %v, %v",
-			err, query, userID, name, content, string(keyboardJSON), true, time.Now())
+		log.Printf("Database error: %v\nParams: %d, %s, %s, %s, %v, %v",
+			err, userID, name, content, string(keyboardJSON), true, time.Now())
 		return fmt.Errorf("database save error")
 	}
 
+	if err := tx.Commit(); err != nil {
+		log.Printf("Database error: %v", err)
+		return fmt.Errorf("database save error")
+	}
+
+	// Черновик не виден ботам, новый шаблон — виден
+	if !editing {
+		notifyTemplateChanged(userID, id)
+	}
 	return nil
 }
 
+// finishTemplateKeyboard сохраняет шаблон с готовой клавиатурой — общий
+// последний шаг для JSON-ввода и конструктора.
+func finishTemplateKeyboard(chatID, userID int64, state *UserState, kb *keyboard.Keyboard) {
+	if text, _ := state.TempData["content"].(string); content.CheckPlaceholders(text) != nil {
+		sendMessage(chatID, "❌ Некорректные переменные в содержании шаблона. Начните создание шаблона заново.")
+		return
+	}
+
+	if missing := missingTemplates(userID, kb.Nodes()); len(missing) > 0 {
+		sendMessage(chatID, "⚠️ Шаблоны для переходов не найдены: "+strings.Join(missing, ", ")+
+			"\nКнопки заработают, когда вы создадите шаблоны с такими названиями.")
+	}
+
+	state.TempData["keyboard"] = kb
+
+	if err := saveTemplate(userID, state.TempData); err != nil {
+		log.Printf("Full save error: %v\nTemplate data: %+v", err, state.TempData)
+
+		detailedMsg := "❌ Ошибка сохранения:\n"
+
+		switch {
+		case strings.Contains(err.Error(), "invalid template name"):
+			detailedMsg += "Некорректное имя шаблона"
+		case strings.Contains(err.Error(), "invalid template content"):
+			detailedMsg += "Некорректное содержание шаблона"
+		case strings.Contains(err.Error(), "invalid keyboard"):
+			detailedMsg += "Некорректный формат клавиатуры"
+		case strings.Contains(err.Error(), "database"):
+			detailedMsg += "Проблема с базой данных"
+		default:
+			detailedMsg += "Техническая ошибка"
+		}
+
+		detailedMsg += "\n\nПопробуйте ещё раз или обратитесь в поддержку"
+
+		msg := tgbotapi.NewMessage(chatID, detailedMsg)
+		msg.ReplyMarkup = getCancelKeyboard()
+		send(msg)
+		return
+	}
+
+	clearUserState(userID)
+	if templateID, editing := state.TempData["template_id"].(int64); editing {
+		sendMessage(chatID, "📝 Черновик сохранён. Боты используют опубликованную версию, пока вы не опубликуете черновик.")
+		if template := getTemplateByID(templateID); template != nil {
+			ShowTemplateDetails(bot, chatID, *template)
+		}
+		return
+	}
+	sendMessage(chatID, "✅ Шаблон успешно создан!")
+	ShowOwnerPanel(bot, chatID)
+}
+
 func getCancelKeyboard() tgbotapi.InlineKeyboardMarkup {
 	return tgbotapi.NewInlineKeyboardMarkup(
 		tgbotapi.NewInlineKeyboardRow(
@@ -610,7 +933,8 @@ func getCancelKeyboard() tgbotapi.InlineKeyboardMarkup {
 
 func getUserTemplates(userID int64) []models.BotTemplate {
 	rows, err := db.Query(`
-        SELECT id, user_id, name, content, keyboard, is_active, created_at, updated_at
+        SELECT id, user_id, name, content, keyboard, is_active, created_at, updated_at,
+               parse_mode, media_type, media_file_id, media_id, version
         FROM bot_templates 
         WHERE user_id = $1`, userID)
 	if err != nil {
@@ -633,6 +957,11 @@ func getUserTemplates(userID int64) []models.BotTemplate {
 			&t.IsActive,
 			&t.CreatedAt,
 			&t.UpdatedAt,
+			&t.ParseMode,
+			&t.MediaType,
+			&t.MediaFileID,
+			&t.MediaID,
+			&t.Version,
 		)
 
 		if err != nil {
@@ -653,11 +982,39 @@ func sendMessage(chatID int64, text string) {
 }
 
 func send(msg tgbotapi.Chattable) {
-	if _, err := bot.Send(msg); err != nil {
+	if _, err := out.Send(context.Background(), msg); err != nil {
 		log.Printf("Error sending message: %v", err)
 	}
 }
 
+// allowAdminAction ограничивает частоту шагов в мастерах согласно тарифу владельца.
+func allowAdminAction(userID int64, chatID int64) bool {
+	if limiter == nil {
+		return true
+	}
+
+	limit := sharedredis.LimitFor(getUserPlan(userID), sharedredis.ScopeAdmin)
+	allowed, retryAfter, err := limiter.Allow(context.Background(), sharedredis.ScopeAdmin, strconv.FormatInt(userID, 10), limit)
+	if err != nil {
+		log.Printf("Rate limit check failed: %v", err)
+		return true
+	}
+
+	if !allowed {
+		sendMessage(chatID, fmt.Sprintf("⏳ Слишком много действий. Повторите через %d сек.", max(1, int(retryAfter.Seconds()))))
+	}
+	return allowed
+}
+
+func getUserPlan(userID int64) sharedredis.Plan {
+	var plan string
+	err := db.QueryRow(`SELECT plan FROM users WHERE telegram_id = $1`, userID).Scan(&plan)
+	if err != nil {
+		return sharedredis.PlanFree
+	}
+	return sharedredis.Plan(plan)
+}
+
 func setUserState(userID int64, state *UserState) {
 	stateMutex.Lock()
 	defer stateMutex.Unlock()
@@ -701,25 +1058,52 @@ func handleAddBotStart(callback *tgbotapi.CallbackQuery) {
 }
 
 // Модифицированный обработчик сообщений
-func handleMessage(message *tgbotapi.Message) {
+// handleMessage обрабатывает сообщение владельца. raw — исходный JSON
+// сообщения, нужен для кастомных эмодзи в содержимом шаблона.
+func handleMessage(message *tgbotapi.Message, raw json.RawMessage) {
 	state := getUserState(message.From.ID)
 
 	if state != nil {
+		if !allowAdminAction(message.From.ID, message.Chat.ID) {
+			return
+		}
+
 		switch state.CurrentAction {
 		case "awaiting_template_name":
 			state.TempData["name"] = message.Text
 			state.CurrentAction = "awaiting_template_content"
-			msg := tgbotapi.NewMessage(message.Chat.ID, "Введите содержание шаблона:")
+			msg := tgbotapi.NewMessage(message.Chat.ID, "Отправьте содержание шаблона: текст с форматированием или фото, видео, документ, GIF с подписью.\n\n"+
+				"Можно использовать переменные: {{first_name}}, {{username}}, {{bot_username}}, {{date}}, "+
+				"ответы в других шаблонах — {{var.название шаблона}}, значение по умолчанию — {{first_name|друг}}")
 			msg.ReplyMarkup = getCancelKeyboard()
 			send(msg)
 			return
 
 		case "awaiting_template_content":
-			state.TempData["content"] = message.Text
-			state.CurrentAction = "awaiting_template_keyboard"
-			msg := tgbotapi.NewMessage(message.Chat.ID, "Введите клавиатуру в JSON формате (пример: [[\"Да\"], [\"Нет\"]]):")
-			msg.ReplyMarkup = getCancelKeyboard()
-			send(msg)
+			c := content.FromRawMessage(message, raw)
+			if c.Empty() {
+				sendMessage(message.Chat.ID, "❌ Отправьте текст или фото, видео, документ, GIF с подписью")
+				return
+			}
+			if !checkTemplateVars(message.From.ID, message.Chat.ID, c.Text) {
+				return
+			}
+			// При редактировании в TempData лежит прежнее медиа
+			delete(state.TempData, "media_id")
+			if c.MediaType != "" {
+				mediaID, err := storeMedia(message.From.ID, c)
+				if err != nil {
+					log.Printf("Error storing media: %v", err)
+					sendMessage(message.Chat.ID, "❌ Не удалось сохранить файл. Попробуйте ещё раз или отправьте другой файл (до 20 МБ)")
+					return
+				}
+				state.TempData["media_id"] = mediaID
+			}
+			state.TempData["content"] = c.Text
+			state.TempData["parse_mode"] = c.ParseMode
+			state.TempData["media_type"] = c.MediaType
+			state.TempData["media_file_id"] = c.MediaFileID
+			StartKeyboardBuilder(message.Chat.ID, state)
 			return
 
 		case "awaiting_template_keyboard":
@@ -729,8 +1113,8 @@ func handleMessage(message *tgbotapi.Message) {
 				return
 			}
 
-			var keyboard [][]string
-			if err := json.Unmarshal([]byte(normalizedInput), &keyboard); err != nil {
+			kb, err := keyboard.Parse([]byte(normalizedInput))
+			if err != nil {
 				errorPos := strings.Index(err.Error(), "offset ")
 				if errorPos > 0 {
 					posStr := err.Error()[errorPos+7:]
@@ -743,55 +1127,38 @@ func handleMessage(message *tgbotapi.Message) {
 				return
 			}
 
-			if len(keyboard) == 0 {
+			if kb == nil {
 				sendMessage(message.Chat.ID, "❌ Клавиатура не может быть пустой")
 				return
 			}
 
-			for _, row := range keyboard {
-				if len(row) == 0 {
-					sendMessage(message.Chat.ID, "❌ Строка клавиатуры не может быть пустой")
-					return
-				}
-				for _, button := range row {
-					if strings.TrimSpace(button) == "" {
-						sendMessage(message.Chat.ID, "❌ Текст кнопки не может быть пустым")
-						return
-					}
-				}
-			}
-
-			state.TempData["keyboard"] = keyboard
-
-			if err := saveTemplate(message.From.ID, state.TempData); err != nil {
-				log.Printf("Full save error: %v\nTemplate data: %+v", err, state.TempData)
-
-				detailedMsg := "❌ Ошибка сохранения:\n"
-
-				switch {
-				case strings.Contains(err.Error(), "invalid template name"):
-					detailedMsg += "Некорректное имя шаблона"
-				case strings.Contains(err.Error(), "invalid template content"):
-					detailedMsg += "Некорректное содержание шаблона"
-				case strings.Contains(err.Error(), "invalid keyboard"):
-					detailedMsg += "Некорректный формат клавиатуры"
-				case strings.Contains(err.Error(), "database"):
-					detailedMsg += "Проблема с базой данных"
-				default:
-					detailedMsg += "Техническая ошибка"
-				}
-
-				detailedMsg += "\n\nПопробуйте ещё раз или обратитесь в поддержку"
-
-				msg := tgbotapi.NewMessage(message.Chat.ID, detailedMsg)
-				msg.ReplyMarkup = getCancelKeyboard()
-				send(msg)
+			if err := kb.Validate(); err != nil {
+				sendMessage(message.Chat.ID, "❌ "+err.Error())
 				return
 			}
 
-			clearUserState(message.From.ID)
-			sendMessage(message.Chat.ID, "✅ Шаблон успешно создан!")
-			ShowOwnerPanel(bot, message.Chat.ID)
+			finishTemplateKeyboard(message.Chat.ID, message.From.ID, state, kb)
+			return
+		case actionBuilderText, actionBuilderURL, actionBuilderNode, actionBuilderQuery, actionBuilderPlaceholder:
+			handleKeyboardBuilderInput(message, state)
+			return
+		case actionPreview:
+			handlePreviewInput(message, state)
+			return
+		case actionImport:
+			handleImportDocument(message, state)
+			return
+		case actionPublishTime:
+			handlePublishTimeInput(message, state)
+			return
+		case actionReplaceToken:
+			handleReplaceTokenInput(message, state)
+			return
+		case actionProfileField:
+			handleProfileFieldInput(message, state)
+			return
+		case actionMenuButton:
+			handleMenuButtonInput(message, state)
 			return
 		case "awaiting_bot_token":
 			// Проверяем формат токена (без префикса "bot")
@@ -851,6 +1218,12 @@ func handleMessage(message *tgbotapi.Message) {
 
 			HandleStart(bot, gormDB, update)
 			return
+		case "deadletters":
+			ShowDeadLetters(message.Chat.ID, message.From.ID)
+			return
+		case "import":
+			StartImport(message.Chat.ID, message.From.ID)
+			return
 		}
 	}
 	sendMessage(message.Chat.ID, "Используйте кнопки меню")
@@ -942,8 +1315,6 @@ func confirmBotCreation(chatID int64, userID int64) {
 		sendMessage(chatID, "✅ Вебхук успешно зарегистрирован")
 	}
 
-	go startBotWorker(state.BotToken, templateID)
-
 	sendMessage(chatID, fmt.Sprintf(
 		"✅ Бот успешно создан!\n\n"+
 			"Токен: %s\n"+
@@ -951,6 +1322,8 @@ func confirmBotCreation(chatID int64, userID int64) {
 			"Реферальный код: %s",
 		maskToken(state.BotToken), templateID, refCode))
 
+	startBot(chatID, state.BotToken)
+
 	clearUserState(userID)
 }
 
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"shared/content"
+	"shared/media"
+	"time"
+)
+
+// maxMediaSize — предел Bot API на скачивание файлов ботом.
+const maxMediaSize = 20 << 20
+
+// mediaStorage хранит файлы медиатеки. Без него шаблоны с медиа недоступны.
+var mediaStorage media.Storage
+
+// storeMedia скачивает медиа из сообщения владельца и добавляет его в
+// медиатеку. Одинаковые файлы хранятся один раз, file_id admin-bot
+// запоминается, чтобы отправлять файл без повторной загрузки.
+func storeMedia(ownerID int64, c content.Content) (int64, error) {
+	if mediaStorage == nil {
+		return 0, fmt.Errorf("media storage is not configured")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	data, err := downloadFile(ctx, c.MediaFileID, maxMediaSize)
+	if err != nil {
+		return 0, err
+	}
+
+	key := media.Key(data)
+	if err := mediaStorage.Put(ctx, key, data, c.MimeType); err != nil {
+		return 0, err
+	}
+
+	var mediaID int64
+	err = db.QueryRow(`
+        INSERT INTO media_files (owner_id, kind, file_name, mime_type, size, storage_key)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        ON CONFLICT (owner_id, storage_key) DO UPDATE SET kind = EXCLUDED.kind
+        RETURNING id`,
+		ownerID, c.MediaType, c.FileName, c.MimeType, len(data), key).Scan(&mediaID)
+	if err != nil {
+		return 0, fmt.Errorf("database save error: %w", err)
+	}
+
+	_, err = db.Exec(`
+        INSERT INTO media_bot_files (media_id, bot_id, file_id)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (media_id, bot_id) DO UPDATE SET file_id = EXCLUDED.file_id`,
+		mediaID, bot.Self.ID, c.MediaFileID)
+	if err != nil {
+		return 0, fmt.Errorf("database save error: %w", err)
+	}
+
+	return mediaID, nil
+}
+
+// downloadFile скачивает файл, присланный admin-bot, не больше limit байт.
+func downloadFile(ctx context.Context, fileID string, limit int) ([]byte, error) {
+	url, err := bot.GetFileDirectURL(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file url: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download file: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download file: %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, int64(limit)+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download file: %w", err)
+	}
+	if len(data) > limit {
+		return nil, fmt.Errorf("file is larger than %d bytes", limit)
+	}
+	return data, nil
+}
+
+// nullMediaID переводит отсутствующий файл медиатеки в NULL.
+func nullMediaID(data map[string]interface{}) sql.NullInt64 {
+	id, _ := data["media_id"].(int64)
+	return sql.NullInt64{Int64: id, Valid: id != 0}
+}
@@ -50,6 +50,15 @@ type BotTemplate struct {
 	IsActive  bool            `db:"is_active" json:"is_active"`
 	CreatedAt time.Time       `db:"created_at" json:"created_at"`
 	UpdatedAt time.Time       `db:"updated_at" json:"updated_at"`
+
+	// ParseMode — режим разметки Content: пусто или HTML
+	ParseMode   string `db:"parse_mode" json:"parse_mode"`
+	MediaType   string `db:"media_type" json:"media_type"`
+	MediaFileID string `db:"media_file_id" json:"media_file_id"`
+	MediaID     *int64 `db:"media_id" json:"media_id"`
+
+	// Version — активная версия из template_versions
+	Version int `db:"version" json:"version"`
 }
 
 // Методы для работы с базой
@@ -18,6 +18,7 @@ type User struct {
 	Username    string `gorm:"size:255"`
 	Phone       string `gorm:"size:20;unique"`
 	Role        string `gorm:"size:10;not null;check:role IN ('admin', 'owner', 'client')"`
+	Plan        string `gorm:"size:20;not null;default:free"`
 	IsActive    bool   `gorm:"default:true"`
 	SessionData []byte `gorm:"type:bytea"`
 	LastActive  time.Time
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+const undeliveredCheckInterval = time.Minute
+
+// watchUndeliveredMessages периодически сообщает владельцам о сообщениях,
+// которые их боты так и не смогли доставить. Блокировка бота пользователем
+// ошибкой для владельца не считается: такой подписчик просто отмечается.
+func watchUndeliveredMessages() {
+	ticker := time.NewTicker(undeliveredCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := notifyUndeliveredMessages(); err != nil {
+			log.Printf("Undelivered messages check failed: %v", err)
+		}
+	}
+}
+
+func notifyUndeliveredMessages() error {
+	rows, err := db.Query(`
+        SELECT b.user_id, b.bot_token, o.bot_id, COUNT(o.id), MAX(o.id),
+               (ARRAY_AGG(o.last_error ORDER BY o.id DESC))[1]
+        FROM outbox_messages o
+        JOIN bots b ON split_part(b.bot_token, ':', 1)::bigint = o.bot_id
+        WHERE o.status = 'failed' AND o.owner_notified_at IS NULL AND o.error_kind <> 'blocked'
+        GROUP BY b.user_id, b.bot_token, o.bot_id`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	type undelivered struct {
+		ownerID   int64
+		token     string
+		botID     int64
+		count     int
+		lastID    int64
+		lastError string
+	}
+
+	var pending []undelivered
+	for rows.Next() {
+		var u undelivered
+		if err := rows.Scan(&u.ownerID, &u.token, &u.botID, &u.count, &u.lastID, &u.lastError); err != nil {
+			log.Printf("Row scan error: %v", err)
+			continue
+		}
+		pending = append(pending, u)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, u := range pending {
+		sendMessage(u.ownerID, fmt.Sprintf(
+			"⚠️ Бот %s не смог доставить сообщений: %d\n\nПоследняя ошибка: %s",
+			maskToken(u.token), u.count, u.lastError))
+
+		_, err := db.Exec(`
+            UPDATE outbox_messages SET owner_notified_at = NOW()
+            WHERE bot_id = $1 AND status = 'failed' AND owner_notified_at IS NULL AND error_kind <> 'blocked' AND id <= $2`,
+			u.botID, u.lastID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"admin-bot/models"
+	"context"
+	"fmt"
+	"log"
+	"shared/content"
+	"shared/keyboard"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// actionPreview — владелец смотрит шаблон с reply-клавиатурой, нажатия
+// её кнопок приходят обычными сообщениями.
+const actionPreview = "preview_template"
+
+// PreviewTemplate отправляет владельцу шаблон так, как его увидит
+// пользователь: с разметкой, медиа, настоящей клавиатурой и примерами
+// значений переменных.
+func PreviewTemplate(chatID, userID, templateID int64) {
+	template := getTemplateByID(templateID)
+	if template == nil || template.UserID != userID {
+		sendMessage(chatID, "Шаблон не найден")
+		return
+	}
+	showPreview(chatID, userID, template, false)
+}
+
+// PreviewDraft показывает черновик шаблона так же, как опубликованную версию.
+func PreviewDraft(chatID, userID, templateID int64) {
+	template, draft := ownedDraft(chatID, userID, templateID)
+	if draft == nil {
+		return
+	}
+	draft.apply(template)
+	showPreview(chatID, userID, template, true)
+}
+
+func showPreview(chatID, userID int64, template *models.BotTemplate, draft bool) {
+	kb, err := keyboard.Parse(template.Keyboard)
+	if err != nil {
+		log.Printf("Ошибка разбора клавиатуры: %v", err)
+		sendMessage(chatID, "❌ Не удалось разобрать клавиатуру шаблона")
+		return
+	}
+
+	title := "шаблона"
+	if draft {
+		title = "черновика шаблона"
+	}
+	sendMessage(chatID, fmt.Sprintf("👁 Предпросмотр %s «%s». Вместо переменных подставлены примеры.", title, template.Name))
+	if !sendPreview(chatID, template, kb) {
+		return
+	}
+
+	if !draft && (kb == nil || kb.Type != keyboard.TypeReply) {
+		if state := getUserState(userID); state != nil && state.CurrentAction == actionPreview {
+			clearUserState(userID)
+		}
+		return
+	}
+
+	// Нажатия reply-кнопок приходят текстом, поэтому запоминаем шаблон,
+	// чтобы показать, куда ведёт кнопка. Для черновика запоминаем и
+	// inline-клавиатуру: её кнопки ищутся в черновике, а не в опубликованной версии
+	setUserState(userID, &UserState{
+		CurrentAction: actionPreview,
+		TempData:      map[string]interface{}{"template_id": template.ID, "draft": draft},
+	})
+	msg := tgbotapi.NewMessage(chatID, "Нажимайте кнопки клавиатуры, чтобы увидеть, куда они ведут.")
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("⏹ Закончить предпросмотр", "preview_end"),
+		),
+	)
+	send(msg)
+}
+
+// sendPreview отправляет отрисованный шаблон в чат владельца.
+func sendPreview(chatID int64, template *models.BotTemplate, kb *keyboard.Keyboard) bool {
+	text := content.Render(template.Content, template.ParseMode, sampleVars(template.Content))
+	markup := kb.Markup(template.ID)
+
+	var msg tgbotapi.Chattable
+	if template.MediaType == "" {
+		m := tgbotapi.NewMessage(chatID, text)
+		m.ParseMode = template.ParseMode
+		m.ReplyMarkup = markup
+		msg = m
+	} else {
+		file, err := previewFile(template)
+		if err != nil {
+			log.Printf("Error loading preview media: %v", err)
+			sendMessage(chatID, "❌ Не удалось загрузить медиа шаблона")
+			return false
+		}
+		msg = mediaMessage(chatID, template.MediaType, file, text, template.ParseMode, markup)
+	}
+
+	sent, err := out.Send(context.Background(), msg)
+	if err != nil {
+		log.Printf("Error sending preview: %v", err)
+		sendMessage(chatID, "❌ Telegram не принял шаблон: "+err.Error())
+		return false
+	}
+
+	// Файл, загруженный из медиатеки, в следующий раз отправляется по file_id
+	if template.MediaID != nil {
+		if fileID := content.FromMessage(&sent).MediaFileID; fileID != "" {
+			cacheAdminFileID(*template.MediaID, fileID)
+		}
+	}
+	return true
+}
+
+func mediaMessage(chatID int64, mediaType string, file tgbotapi.RequestFileData, caption, parseMode string, markup interface{}) tgbotapi.Chattable {
+	switch mediaType {
+	case content.MediaVideo:
+		m := tgbotapi.NewVideo(chatID, file)
+		m.Caption, m.ParseMode, m.ReplyMarkup = caption, parseMode, markup
+		return m
+	case content.MediaDocument:
+		m := tgbotapi.NewDocument(chatID, file)
+		m.Caption, m.ParseMode, m.ReplyMarkup = caption, parseMode, markup
+		return m
+	case content.MediaAnimation:
+		m := tgbotapi.NewAnimation(chatID, file)
+		m.Caption, m.ParseMode, m.ReplyMarkup = caption, parseMode, markup
+		return m
+	}
+	m := tgbotapi.NewPhoto(chatID, file)
+	m.Caption, m.ParseMode, m.ReplyMarkup = caption, parseMode, markup
+	return m
+}
+
+// previewFile возвращает файл шаблона для admin-bot: его собственный
+// file_id, если он уже есть, иначе содержимое из медиатеки.
+func previewFile(template *models.BotTemplate) (tgbotapi.RequestFileData, error) {
+	if template.MediaID == nil {
+		return tgbotapi.FileID(template.MediaFileID), nil
+	}
+
+	var fileID string
+	err := db.QueryRow(`
+        SELECT file_id FROM media_bot_files
+        WHERE media_id = $1 AND bot_id = $2`, *template.MediaID, bot.Self.ID).Scan(&fileID)
+	if err == nil {
+		return tgbotapi.FileID(fileID), nil
+	}
+
+	if mediaStorage == nil {
+		return nil, fmt.Errorf("media storage is not configured")
+	}
+	var fileName, storageKey string
+	err = db.QueryRow(`
+        SELECT file_name, storage_key FROM media_files WHERE id = $1`, *template.MediaID).Scan(&fileName, &storageKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load media %d: %w", *template.MediaID, err)
+	}
+
+	data, err := mediaStorage.Get(context.Background(), storageKey)
+	if err != nil {
+		return nil, err
+	}
+	if fileName == "" {
+		fileName = template.MediaType
+	}
+	return tgbotapi.FileBytes{Name: fileName, Bytes: data}, nil
+}
+
+func cacheAdminFileID(mediaID int64, fileID string) {
+	_, err := db.Exec(`
+        INSERT INTO media_bot_files (media_id, bot_id, file_id)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (media_id, bot_id) DO UPDATE SET file_id = EXCLUDED.file_id`,
+		mediaID, bot.Self.ID, fileID)
+	if err != nil {
+		log.Printf("Error caching media file_id: %v", err)
+	}
+}
+
+// sampleVars подставляет правдоподобные значения вместо данных пользователя.
+func sampleVars(text string) content.Vars {
+	vars := content.Vars{
+		"first_name":   "Иван",
+		"last_name":    "Петров",
+		"full_name":    "Иван Петров",
+		"username":     "ivan_petrov",
+		"user_id":      "123456789",
+		"bot_username": "example_bot",
+		"bot_name":     "Пример",
+	}
+	content.DateVars(vars, time.Now().In(publishZone))
+	for _, p := range content.Placeholders(text) {
+		if name, ok := strings.CutPrefix(p.Name, content.ChatVarPrefix); ok {
+			vars[p.Name] = fmt.Sprintf("ответ в «%s»", name)
+		}
+	}
+	return vars
+}
+
+// handlePreviewButton отвечает на нажатие inline-кнопки шаблона в
+// предпросмотре: показывает, куда она ведёт, и отправляет следующий шаблон.
+func handlePreviewButton(callback *tgbotapi.CallbackQuery) {
+	answer := tgbotapi.NewCallback(callback.ID, "")
+	defer func() {
+		if _, err := out.Request(context.Background(), answer); err != nil {
+			log.Printf("Error answering callback query: %v", err)
+		}
+	}()
+
+	templateID, ref, _ := keyboard.ParseCallbackData(callback.Data)
+	template := previewSource(callback.From.ID, templateID)
+	if template == nil || template.UserID != callback.From.ID {
+		answer.Text = "Шаблон не найден"
+		return
+	}
+	kb, err := keyboard.Parse(template.Keyboard)
+	if err != nil || kb == nil {
+		answer.Text = "У шаблона нет клавиатуры"
+		return
+	}
+	button, ok := kb.Find(ref)
+	if !ok {
+		answer.Text = "Кнопка не найдена"
+		return
+	}
+
+	var nextID int64
+	answer.Text, nextID = previewTarget(callback.From.ID, button)
+	if nextID == 0 {
+		answer.ShowAlert = true
+		return
+	}
+	PreviewTemplate(callback.Message.Chat.ID, callback.From.ID, nextID)
+}
+
+// handlePreviewInput обрабатывает нажатие reply-кнопки в предпросмотре.
+// Текст, не совпавший ни с одной кнопкой, завершает предпросмотр.
+func handlePreviewInput(message *tgbotapi.Message, state *UserState) {
+	templateID, _ := state.TempData["template_id"].(int64)
+	template := previewSource(message.From.ID, templateID)
+	if template == nil {
+		endPreview(message.Chat.ID, message.From.ID)
+		return
+	}
+
+	kb, err := keyboard.Parse(template.Keyboard)
+	if err != nil || kb == nil {
+		endPreview(message.Chat.ID, message.From.ID)
+		return
+	}
+	button, ok := kb.FindText(message.Text)
+	if !ok {
+		endPreview(message.Chat.ID, message.From.ID)
+		return
+	}
+
+	text, nextID := previewTarget(message.From.ID, button)
+	sendMessage(message.Chat.ID, text)
+	if nextID != 0 {
+		PreviewTemplate(message.Chat.ID, message.From.ID, nextID)
+	}
+}
+
+// previewSource возвращает шаблон, который сейчас в предпросмотре:
+// черновик, если владелец смотрит черновик, иначе опубликованную версию.
+func previewSource(userID, templateID int64) *models.BotTemplate {
+	template := getTemplateByID(templateID)
+	if template == nil {
+		return nil
+	}
+
+	state := getUserState(userID)
+	if state == nil || state.CurrentAction != actionPreview || state.TempData["template_id"] != templateID {
+		return template
+	}
+	if draft, _ := state.TempData["draft"].(bool); !draft {
+		return template
+	}
+	if d, err := loadDraft(templateID); err != nil {
+		log.Printf("Database query error: %v", err)
+	} else if d != nil {
+		d.apply(template)
+	}
+	return template
+}
+
+// previewTarget описывает, куда ведёт кнопка. Возвращает ID шаблона
+// перехода или 0, если кнопка никуда не ведёт или шаблона нет.
+func previewTarget(userID int64, button keyboard.Button) (string, int64) {
+	if button.Node == "" {
+		return fmt.Sprintf("Кнопка «%s» никуда не ведёт: бот ответит как на обычное сообщение", button.Text), 0
+	}
+
+	var nextID int64
+	err := db.QueryRow(`
+        SELECT id FROM bot_templates
+        WHERE user_id = $1 AND name = $2 AND is_active`, userID, button.Node).Scan(&nextID)
+	if err != nil {
+		return fmt.Sprintf("Кнопка «%s» ведёт к шаблону «%s», но такого шаблона нет", button.Text, button.Node), 0
+	}
+	return fmt.Sprintf("➡️ Переход к шаблону «%s»", button.Node), nextID
+}
+
+// endPreview завершает предпросмотр и убирает reply-клавиатуру шаблона.
+func endPreview(chatID, userID int64) {
+	if state := getUserState(userID); state != nil && state.CurrentAction == actionPreview {
+		clearUserState(userID)
+	}
+
+	msg := tgbotapi.NewMessage(chatID, "Предпросмотр завершён")
+	msg.ReplyMarkup = tgbotapi.NewRemoveKeyboard(true)
+	send(msg)
+	ShowOwnerPanel(bot, chatID)
+}
@@ -0,0 +1,481 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"shared/commands"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	actionProfileField = "awaiting_profile_field"
+	actionMenuButton   = "awaiting_menu_button"
+)
+
+// profileLanguages — языки, для которых владелец задаёт профиль. Пустой код —
+// значения для всех языков, у которых нет своих.
+var profileLanguages = []string{"", "ru", "en", "uk"}
+
+// profileField — текстовое поле профиля бота в Bot API.
+type profileField struct {
+	Title  string
+	Get    string
+	Set    string
+	Param  string
+	MaxLen int
+}
+
+var profileFields = map[string]profileField{
+	"name":        {Title: "Имя", Get: "getMyName", Set: "setMyName", Param: "name", MaxLen: 64},
+	"description": {Title: "Описание", Get: "getMyDescription", Set: "setMyDescription", Param: "description", MaxLen: 512},
+	"short":       {Title: "Краткое описание", Get: "getMyShortDescription", Set: "setMyShortDescription", Param: "short_description", MaxLen: 120},
+}
+
+var profileFieldOrder = []string{"name", "description", "short"}
+
+// commandScopes — области видимости команд, которые можно задать из admin-bot.
+var commandScopes = []struct {
+	Type  string
+	Title string
+}{
+	{"default", "Все чаты"},
+	{"all_private_chats", "Личные чаты"},
+	{"all_group_chats", "Группы"},
+}
+
+func languageTitle(lang string) string {
+	if lang == "" {
+		return "все языки"
+	}
+	return lang
+}
+
+func validProfileLanguage(lang string) bool {
+	for _, l := range profileLanguages {
+		if l == lang {
+			return true
+		}
+	}
+	return false
+}
+
+// profileClient возвращает клиент Bot API бота владельца.
+func profileClient(chatID, userID, botID int64) (*ownedBot, *tgbotapi.BotAPI) {
+	b, err := getOwnedBot(userID, botID)
+	if err != nil {
+		log.Printf("Database query error: %v", err)
+		sendMessage(chatID, "❌ Не удалось загрузить бота")
+		return nil, nil
+	}
+	if b == nil {
+		sendMessage(chatID, "Бот не найден")
+		return nil, nil
+	}
+	client, err := webhookClient(b.Token)
+	if err != nil {
+		log.Printf("Error authorizing bot %d: %v", botID, err)
+		deactivateRejected(botID, err)
+		sendMessage(chatID, "❌ Telegram не принял токен бота: "+err.Error())
+		return nil, nil
+	}
+	return b, client
+}
+
+// callBotMethod вызывает метод Bot API, для которого в tgbotapi нет
+// конфигурации, и возвращает его результат.
+func callBotMethod(client *tgbotapi.BotAPI, botID int64, method string, params tgbotapi.Params) (json.RawMessage, error) {
+	resp, err := client.MakeRequest(method, params)
+	if err != nil {
+		deactivateRejected(botID, err)
+		return nil, err
+	}
+	return resp.Result, nil
+}
+
+// getProfileField читает поле профиля для языка. Telegram возвращает
+// значение для всех языков, если своего у языка нет.
+func getProfileField(client *tgbotapi.BotAPI, botID int64, field profileField, lang string) (string, error) {
+	params := tgbotapi.Params{}
+	params.AddNonEmpty("language_code", lang)
+	result, err := callBotMethod(client, botID, field.Get, params)
+	if err != nil {
+		return "", err
+	}
+	var values map[string]string
+	if err := json.Unmarshal(result, &values); err != nil {
+		return "", fmt.Errorf("failed to decode %s: %w", field.Get, err)
+	}
+	return values[field.Param], nil
+}
+
+// ShowBotProfile показывает профиль бота на языке lang.
+func ShowBotProfile(chatID, userID, botID int64, lang string) {
+	if !validProfileLanguage(lang) {
+		lang = ""
+	}
+	b, client := profileClient(chatID, userID, botID)
+	if client == nil {
+		return
+	}
+
+	var text strings.Builder
+	fmt.Fprintf(&text, "🪪 Профиль бота @%s (%s), язык: %s\n", client.Self.UserName, maskToken(b.Token), languageTitle(lang))
+	for _, key := range profileFieldOrder {
+		field := profileFields[key]
+		value, err := getProfileField(client, botID, field, lang)
+		if err != nil {
+			log.Printf("Error getting %s of bot %d: %v", field.Get, botID, err)
+			value = "❔ не удалось получить"
+		} else if value == "" {
+			value = "—"
+		}
+		fmt.Fprintf(&text, "\n%s: %s", field.Title, value)
+	}
+
+	var langRow []tgbotapi.InlineKeyboardButton
+	for _, l := range profileLanguages {
+		label := languageTitle(l)
+		if l == lang {
+			label = "• " + label
+		}
+		langRow = append(langRow, tgbotapi.NewInlineKeyboardButtonData(label, fmt.Sprintf("bot_profile:%d:%s", botID, l)))
+	}
+
+	msg := tgbotapi.NewMessage(chatID, text.String())
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		langRow,
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✏️ Имя", fmt.Sprintf("profile_edit:%d:name:%s", botID, lang)),
+			tgbotapi.NewInlineKeyboardButtonData("📝 Описание", fmt.Sprintf("profile_edit:%d:description:%s", botID, lang)),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("💬 Краткое описание", fmt.Sprintf("profile_edit:%d:short:%s", botID, lang)),
+			tgbotapi.NewInlineKeyboardButtonData("⌨️ Команды", fmt.Sprintf("profile_cmds:%d:%s", botID, lang)),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("📱 Кнопка меню", fmt.Sprintf("profile_menu:%d", botID)),
+			tgbotapi.NewInlineKeyboardButtonData("⬅️ К боту", fmt.Sprintf("bot_view:%d", botID)),
+		),
+	)
+	send(msg)
+}
+
+// AskProfileField запрашивает новое значение поля профиля.
+func AskProfileField(chatID, userID, botID int64, key, lang string) {
+	field, ok := profileFields[key]
+	if !ok || !validProfileLanguage(lang) {
+		sendMessage(chatID, "Ошибка: неизвестное поле профиля")
+		return
+	}
+	if b, _ := getOwnedBot(userID, botID); b == nil {
+		sendMessage(chatID, "Бот не найден")
+		return
+	}
+
+	setUserState(userID, &UserState{
+		CurrentAction: actionProfileField,
+		TempData:      map[string]interface{}{"bot_id": botID, "field": key, "lang": lang},
+	})
+
+	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf(
+		"Введите %s бота (язык: %s), до %d символов.\n\nОтправьте «-», чтобы убрать значение.",
+		strings.ToLower(field.Title), languageTitle(lang), field.MaxLen))
+	msg.ReplyMarkup = getCancelKeyboard()
+	send(msg)
+}
+
+func handleProfileFieldInput(message *tgbotapi.Message, state *UserState) {
+	botID, _ := state.TempData["bot_id"].(int64)
+	key, _ := state.TempData["field"].(string)
+	lang, _ := state.TempData["lang"].(string)
+	field := profileFields[key]
+
+	value := strings.TrimSpace(message.Text)
+	if value == "-" {
+		value = ""
+	}
+	if n := utf8.RuneCountInString(value); n > field.MaxLen {
+		sendMessage(message.Chat.ID, fmt.Sprintf("❌ Слишком длинно: %d символов из %d", n, field.MaxLen))
+		return
+	}
+
+	_, client := profileClient(message.Chat.ID, message.From.ID, botID)
+	if client == nil {
+		clearUserState(message.From.ID)
+		return
+	}
+
+	// Пустое значение Telegram понимает как удаление
+	params := tgbotapi.Params{}
+	params.AddNonEmpty(field.Param, value)
+	params.AddNonEmpty("language_code", lang)
+	if _, err := callBotMethod(client, botID, field.Set, params); err != nil {
+		log.Printf("Error calling %s for bot %d: %v", field.Set, botID, err)
+		sendMessage(message.Chat.ID, "❌ Telegram не сохранил изменение: "+err.Error())
+		return
+	}
+
+	clearUserState(message.From.ID)
+	sendMessage(message.Chat.ID, fmt.Sprintf("✅ %s сохранено", field.Title))
+	ShowBotProfile(message.Chat.ID, message.From.ID, botID, lang)
+}
+
+// botCommands строит команды меню по потоку шаблона бота.
+func botCommands(userID int64, b *ownedBot) []commands.Command {
+	root := getTemplateByID(b.TemplateID)
+	if root == nil {
+		return nil
+	}
+	var names []string
+	for _, t := range collectFlow(userID, root) {
+		names = append(names, t.Name)
+	}
+	return commands.Build(names)
+}
+
+// ShowBotCommands показывает команды, построенные по потоку шаблона, и
+// области, для которых их можно установить.
+func ShowBotCommands(chatID, userID, botID int64, lang string) {
+	if !validProfileLanguage(lang) {
+		lang = ""
+	}
+	b, err := getOwnedBot(userID, botID)
+	if err != nil {
+		log.Printf("Database query error: %v", err)
+		sendMessage(chatID, "❌ Не удалось загрузить бота")
+		return
+	}
+	if b == nil {
+		sendMessage(chatID, "Бот не найден")
+		return
+	}
+
+	cmds := botCommands(userID, b)
+	if len(cmds) == 0 {
+		sendMessage(chatID, "❌ Шаблон бота не найден, команды построить не из чего")
+		return
+	}
+
+	var text strings.Builder
+	fmt.Fprintf(&text, "⌨️ Команды по шаблонам бота (язык: %s):\n", languageTitle(lang))
+	for _, c := range cmds {
+		fmt.Fprintf(&text, "\n/%s — %s", c.Command, c.Description())
+	}
+	text.WriteString("\n\nКоманда открывает свой шаблон. Шаблоны, из имени которых не получается команда, в меню не попадают.")
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, scope := range commandScopes {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✅ "+scope.Title, fmt.Sprintf("profile_cmds_set:%d:%s:%s", botID, scope.Type, lang)),
+			tgbotapi.NewInlineKeyboardButtonData("🗑", fmt.Sprintf("profile_cmds_del:%d:%s:%s", botID, scope.Type, lang)),
+		))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("⬅️ К профилю", fmt.Sprintf("bot_profile:%d:%s", botID, lang)),
+	))
+
+	msg := tgbotapi.NewMessage(chatID, text.String())
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	send(msg)
+}
+
+// SetBotCommands устанавливает или удаляет команды бота для области и языка.
+func SetBotCommands(chatID, userID, botID int64, scope, lang string, remove bool) {
+	known := false
+	for _, s := range commandScopes {
+		known = known || s.Type == scope
+	}
+	if !known || !validProfileLanguage(lang) {
+		sendMessage(chatID, "Ошибка: неизвестная область команд")
+		return
+	}
+	b, client := profileClient(chatID, userID, botID)
+	if client == nil {
+		return
+	}
+
+	commandScope := tgbotapi.NewBotCommandScopeDefault()
+	switch scope {
+	case "all_private_chats":
+		commandScope = tgbotapi.NewBotCommandScopeAllPrivateChats()
+	case "all_group_chats":
+		commandScope = tgbotapi.NewBotCommandScopeAllGroupChats()
+	}
+
+	var config tgbotapi.Chattable
+	if remove {
+		config = tgbotapi.NewDeleteMyCommandsWithScopeAndLanguage(commandScope, lang)
+	} else {
+		var list []tgbotapi.BotCommand
+		for _, c := range botCommands(userID, b) {
+			list = append(list, tgbotapi.BotCommand{Command: c.Command, Description: c.Description()})
+		}
+		config = tgbotapi.NewSetMyCommandsWithScopeAndLanguage(commandScope, lang, list...)
+	}
+	if _, err := client.Request(config); err != nil {
+		log.Printf("Error updating commands of bot %d: %v", botID, err)
+		deactivateRejected(botID, err)
+		sendMessage(chatID, "❌ Telegram не сохранил команды: "+err.Error())
+		return
+	}
+
+	if remove {
+		sendMessage(chatID, "🗑 Команды удалены")
+	} else {
+		sendMessage(chatID, "✅ Команды установлены")
+	}
+}
+
+// ShowMenuButton предлагает варианты кнопки меню бота.
+func ShowMenuButton(chatID, userID, botID int64) {
+	_, client := profileClient(chatID, userID, botID)
+	if client == nil {
+		return
+	}
+
+	current := "не удалось получить"
+	if result, err := callBotMethod(client, botID, "getChatMenuButton", tgbotapi.Params{}); err != nil {
+		log.Printf("Error getting menu button of bot %d: %v", botID, err)
+	} else {
+		var button struct {
+			Type   string `json:"type"`
+			Text   string `json:"text"`
+			WebApp struct {
+				URL string `json:"url"`
+			} `json:"web_app"`
+		}
+		if err := json.Unmarshal(result, &button); err == nil {
+			current = describeMenuButton(button.Type, button.Text, button.WebApp.URL)
+		}
+	}
+
+	msg := tgbotapi.NewMessage(chatID, "📱 Кнопка меню рядом с полем ввода\n\nСейчас: "+current)
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("⌨️ Список команд", fmt.Sprintf("profile_menu_set:%d:commands", botID)),
+			tgbotapi.NewInlineKeyboardButtonData("🌐 Веб-приложение", fmt.Sprintf("profile_menu_set:%d:web_app", botID)),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("↩️ По умолчанию", fmt.Sprintf("profile_menu_set:%d:default", botID)),
+			tgbotapi.NewInlineKeyboardButtonData("⬅️ К профилю", fmt.Sprintf("bot_profile:%d:", botID)),
+		),
+	)
+	send(msg)
+}
+
+func describeMenuButton(kind, text, webAppURL string) string {
+	switch kind {
+	case "commands":
+		return "список команд"
+	case "web_app":
+		return fmt.Sprintf("веб-приложение «%s» (%s)", text, webAppURL)
+	}
+	return "по умолчанию"
+}
+
+// SetMenuButton меняет кнопку меню. Для веб-приложения сначала
+// запрашиваются текст и адрес.
+func SetMenuButton(chatID, userID, botID int64, kind string) {
+	switch kind {
+	case "commands", "default":
+		applyMenuButton(chatID, userID, botID, map[string]string{"type": kind})
+	case "web_app":
+		setUserState(userID, &UserState{
+			CurrentAction: actionMenuButton,
+			TempData:      map[string]interface{}{"bot_id": botID},
+		})
+		msg := tgbotapi.NewMessage(chatID, "Отправьте текст кнопки и адрес веб-приложения через «|», например:\nМагазин | https://example.com/shop")
+		msg.ReplyMarkup = getCancelKeyboard()
+		send(msg)
+	default:
+		sendMessage(chatID, "Ошибка: неизвестный тип кнопки")
+	}
+}
+
+func handleMenuButtonInput(message *tgbotapi.Message, state *UserState) {
+	botID, _ := state.TempData["bot_id"].(int64)
+
+	text, rawURL, ok := strings.Cut(message.Text, "|")
+	text, rawURL = strings.TrimSpace(text), strings.TrimSpace(rawURL)
+	if !ok || text == "" || rawURL == "" {
+		sendMessage(message.Chat.ID, "❌ Нужны текст и адрес через «|»")
+		return
+	}
+	// Веб-приложения Telegram открывает только по HTTPS
+	if u, err := url.Parse(rawURL); err != nil || u.Scheme != "https" || u.Host == "" {
+		sendMessage(message.Chat.ID, "❌ Адрес веб-приложения должен начинаться с https://")
+		return
+	}
+
+	clearUserState(message.From.ID)
+	applyMenuButton(message.Chat.ID, message.From.ID, botID, map[string]interface{}{
+		"type":    "web_app",
+		"text":    text,
+		"web_app": map[string]string{"url": rawURL},
+	})
+}
+
+// applyMenuButton устанавливает кнопку меню по умолчанию для всех чатов бота.
+func applyMenuButton(chatID, userID, botID int64, button interface{}) {
+	_, client := profileClient(chatID, userID, botID)
+	if client == nil {
+		return
+	}
+
+	params := tgbotapi.Params{}
+	if err := params.AddInterface("menu_button", button); err != nil {
+		log.Printf("Error encoding menu button: %v", err)
+		return
+	}
+	if _, err := callBotMethod(client, botID, "setChatMenuButton", params); err != nil {
+		log.Printf("Error setting menu button of bot %d: %v", botID, err)
+		sendMessage(chatID, "❌ Telegram не сохранил кнопку меню: "+err.Error())
+		return
+	}
+	sendMessage(chatID, "✅ Кнопка меню обновлена")
+	ShowMenuButton(chatID, userID, botID)
+}
+
+// handleProfileCallback разбирает кнопки профиля: первым параметром всегда
+// идёт ID бота, последним у экранов с языком — код языка.
+func handleProfileCallback(callback *tgbotapi.CallbackQuery, action string, parts []string) {
+	chatID := callback.Message.Chat.ID
+	userID := callback.From.ID
+
+	if len(parts) < 2 {
+		sendMessage(chatID, "Ошибка: не указан бот")
+		return
+	}
+	botID, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		sendMessage(chatID, "Ошибка: неверный ID бота")
+		return
+	}
+	arg := func(i int) string {
+		if i < len(parts) {
+			return parts[i]
+		}
+		return ""
+	}
+
+	switch action {
+	case "bot_profile":
+		ShowBotProfile(chatID, userID, botID, arg(2))
+	case "profile_edit":
+		AskProfileField(chatID, userID, botID, arg(2), arg(3))
+	case "profile_cmds":
+		ShowBotCommands(chatID, userID, botID, arg(2))
+	case "profile_cmds_set", "profile_cmds_del":
+		SetBotCommands(chatID, userID, botID, arg(2), arg(3), action == "profile_cmds_del")
+	case "profile_menu":
+		ShowMenuButton(chatID, userID, botID)
+	case "profile_menu_set":
+		SetMenuButton(chatID, userID, botID, arg(2))
+	}
+}
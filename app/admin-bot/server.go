@@ -0,0 +1,410 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"runtime/debug"
+	sharedredis "shared/redis"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Режимы получения обновлений admin-bot, задаются ADMIN_MODE. В обоих
+// режимах admin-bot работает одним экземпляром: состояния мастеров
+// (userStates) хранятся в памяти процесса, а фоновые проверки вебхуков,
+// публикаций и уведомлений запускаются в каждом процессе и дублировали бы
+// друг друга.
+const (
+	modePolling = "polling"
+	// modeWebhook не требует исходящего long polling и не конфликтует с
+	// вебхуком, уже установленным на токен
+	modeWebhook = "webhook"
+)
+
+const (
+	adminWebhookPath = "/webhook"
+	// secretHeader — заголовок, в котором Telegram передаёт secret_token
+	// из setWebhook
+	secretHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+	adminPollTimeout = 30
+	updateQueueSize  = 100
+	shutdownTimeout  = 30 * time.Second
+)
+
+var adminAllowedUpdates = []string{tgbotapi.UpdateTypeMessage, tgbotapi.UpdateTypeCallbackQuery}
+
+// adminUpdate — обновление вместе с исходным JSON сообщения: из него
+// берутся поля, которых нет в tgbotapi, например custom_emoji_id.
+type adminUpdate struct {
+	tgbotapi.Update
+	rawMessage json.RawMessage
+}
+
+// decodeUpdate разбирает обновление. Если разобрать удалось только
+// update_id, возвращается ошибка и обновление с одним UpdateID: его можно
+// подтвердить и пропустить.
+func decodeUpdate(body []byte) (adminUpdate, error) {
+	var u adminUpdate
+	var raw struct {
+		UpdateID int             `json:"update_id"`
+		Message  json.RawMessage `json:"message"`
+	}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return u, err
+	}
+	if err := json.Unmarshal(body, &u.Update); err != nil {
+		return adminUpdate{Update: tgbotapi.Update{UpdateID: raw.UpdateID}}, err
+	}
+	u.rawMessage = raw.Message
+	return u, nil
+}
+
+// adminMetrics — счётчики для /metrics.
+var adminMetrics struct {
+	messages  atomic.Int64
+	callbacks atomic.Int64
+	rejected  atomic.Int64
+	invalid   atomic.Int64
+	panics    atomic.Int64
+	queued    atomic.Int64
+}
+
+// receiveUpdates получает обновления admin-bot в режиме из ADMIN_MODE и
+// обрабатывает их до SIGINT или SIGTERM. /health и /metrics отдаёт тот же
+// HTTP-сервер, что принимает вебхук.
+//
+// Обновления из обоих источников проходят через одну очередь и
+// обрабатываются по одному, как при long polling. При остановке сначала
+// перестают приниматься новые обновления, затем дообрабатывается очередь.
+// Переключение режима безопасно: polling снимает вебхук, webhook ставит
+// его заново.
+func receiveUpdates() error {
+	mode := os.Getenv("ADMIN_MODE")
+	if mode == "" {
+		mode = modePolling
+	}
+	listenAddr := os.Getenv("ADMIN_LISTEN_ADDR")
+	if listenAddr == "" {
+		listenAddr = ":8081"
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	queue := make(chan adminUpdate, updateQueueSize)
+	var poll pollOffset
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", serveAdminHealth(mode))
+	mux.HandleFunc("/metrics", serveAdminMetrics)
+
+	switch mode {
+	case modeWebhook:
+		webhookURL := strings.TrimSuffix(os.Getenv("ADMIN_WEBHOOK_URL"), "/")
+		secret := os.Getenv("ADMIN_WEBHOOK_SECRET")
+		if webhookURL == "" || secret == "" {
+			return errors.New("ADMIN_WEBHOOK_URL and ADMIN_WEBHOOK_SECRET are required in webhook mode")
+		}
+		mux.HandleFunc(adminWebhookPath, serveAdminWebhook(secret, queue))
+		if err := setAdminWebhook(webhookURL+adminWebhookPath, secret); err != nil {
+			return fmt.Errorf("failed to set admin webhook: %w", err)
+		}
+	case modePolling:
+		// Вебхук, оставшийся от режима webhook, не даёт работать getUpdates
+		if _, err := bot.Request(tgbotapi.DeleteWebhookConfig{}); err != nil {
+			return fmt.Errorf("failed to delete admin webhook: %w", err)
+		}
+		go pollAdminUpdates(ctx, queue, &poll)
+	default:
+		return fmt.Errorf("unknown ADMIN_MODE %q, expected %s or %s", mode, modePolling, modeWebhook)
+	}
+
+	consumeCtx, stopConsuming := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		consumeUpdates(consumeCtx, queue)
+		close(done)
+	}()
+
+	server := &http.Server{Addr: listenAddr, Handler: mux}
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+	log.Printf("Admin bot receives updates in %s mode, listening on %s", mode, listenAddr)
+
+	var runErr error
+	select {
+	case <-ctx.Done():
+		log.Printf("Shutting down admin bot")
+	case err := <-serverErr:
+		runErr = fmt.Errorf("server stopped: %w", err)
+	}
+	stop()
+	if mode == modePolling {
+		confirmAdminUpdates(poll.get())
+	}
+
+	// Shutdown дожидается обработчиков вебхука: всё, что Telegram считает
+	// доставленным, уже в очереди
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Error shutting down server: %v", err)
+	}
+
+	stopConsuming()
+	select {
+	case <-done:
+	case <-shutdownCtx.Done():
+		log.Printf("Shutdown timeout, %d updates left unprocessed", len(queue))
+	}
+	return runErr
+}
+
+// setAdminWebhook ставит вебхук с secret_token: tgbotapi.WebhookConfig
+// этот параметр не поддерживает.
+func setAdminWebhook(url, secret string) error {
+	params := tgbotapi.Params{"url": url, "secret_token": secret}
+	if err := params.AddInterface("allowed_updates", adminAllowedUpdates); err != nil {
+		return err
+	}
+	_, err := bot.MakeRequest("setWebhook", params)
+	return err
+}
+
+// serveAdminWebhook принимает обновление, только если Telegram прислал
+// секрет из setWebhook. Ответ уходит после постановки в очередь.
+func serveAdminWebhook(secret string, queue chan<- adminUpdate) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get(secretHeader)), []byte(secret)) != 1 {
+			adminMetrics.rejected.Add(1)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			log.Printf("Error reading admin update: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		update, err := decodeUpdate(body)
+		if err != nil {
+			// Повтор пришёл бы в том же виде, поэтому обновление
+			// подтверждается ответом 200 и пропускается
+			adminMetrics.invalid.Add(1)
+			log.Printf("Error decoding admin update %d, skipping it: %v", update.UpdateID, err)
+			return
+		}
+
+		select {
+		case queue <- update:
+			adminMetrics.queued.Add(1)
+		case <-r.Context().Done():
+			// Telegram не дождался ответа и повторит обновление
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}
+}
+
+// pollOffset — offset следующего getUpdates: все обновления до него уже
+// поставлены в очередь.
+type pollOffset struct {
+	mu   sync.Mutex
+	next int
+}
+
+func (o *pollOffset) get() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.next
+}
+
+// pollAdminUpdates получает обновления через getUpdates. Обновление
+// подтверждается следующим запросом с большим offset, поэтому при
+// остановке receiveUpdates подтверждает поставленные в очередь обновления
+// отдельным вызовом (см. confirmAdminUpdates). Не попавшие в очередь
+// Telegram отдаст следующему запуску.
+func pollAdminUpdates(ctx context.Context, queue chan<- adminUpdate, offset *pollOffset) {
+	for ctx.Err() == nil {
+		updates, err := getAdminUpdates(offset.get())
+		if err != nil {
+			if ctx.Err() != nil {
+				// Запрос прерван подтверждением при остановке
+				return
+			}
+			log.Printf("Error getting admin updates: %v", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(3 * time.Second):
+			}
+			continue
+		}
+
+		for _, update := range updates {
+			if !offset.push(ctx, queue, update) {
+				return
+			}
+		}
+	}
+}
+
+// push ставит обновление в очередь и сдвигает offset. Блокировка не даёт
+// прочитать offset между постановкой в очередь и сдвигом.
+func (o *pollOffset) push(ctx context.Context, queue chan<- adminUpdate, update adminUpdate) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if ctx.Err() != nil {
+		return false
+	}
+	select {
+	case queue <- update:
+		adminMetrics.queued.Add(1)
+		o.next = update.UpdateID + 1
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// confirmAdminUpdates подтверждает обновления до offset, чтобы следующий
+// запуск не выполнил их повторно. Запрос заодно прерывает long polling,
+// который ещё ждёт ответа: Telegram завершает его с ошибкой 409.
+func confirmAdminUpdates(offset int) {
+	if offset == 0 {
+		return
+	}
+	params := tgbotapi.Params{}
+	params.AddNonZero("offset", offset)
+	params.AddNonZero("limit", 1)
+	if _, err := bot.MakeRequest("getUpdates", params); err != nil {
+		log.Printf("Error confirming admin updates before %d: %v", offset, err)
+	}
+}
+
+// getAdminUpdates вызывает getUpdates и разбирает обновления вместе с
+// исходным JSON: bot.GetUpdates его не сохраняет.
+func getAdminUpdates(offset int) ([]adminUpdate, error) {
+	params := tgbotapi.Params{}
+	params.AddNonZero("offset", offset)
+	params.AddNonZero("timeout", adminPollTimeout)
+	if err := params.AddInterface("allowed_updates", adminAllowedUpdates); err != nil {
+		return nil, err
+	}
+
+	resp, err := bot.MakeRequest("getUpdates", params)
+	if err != nil {
+		return nil, err
+	}
+	var bodies []json.RawMessage
+	if err := json.Unmarshal(resp.Result, &bodies); err != nil {
+		return nil, err
+	}
+
+	updates := make([]adminUpdate, 0, len(bodies))
+	for _, body := range bodies {
+		update, err := decodeUpdate(body)
+		if err != nil {
+			// Обновление всё равно подтверждается, иначе getUpdates
+			// возвращал бы его снова
+			adminMetrics.invalid.Add(1)
+			log.Printf("Error decoding admin update %d: %v", update.UpdateID, err)
+		}
+		updates = append(updates, update)
+	}
+	return updates, nil
+}
+
+// consumeUpdates обрабатывает очередь, пока ctx не отменён, и затем
+// дообрабатывает то, что в ней осталось.
+func consumeUpdates(ctx context.Context, queue <-chan adminUpdate) {
+	for {
+		select {
+		case update := <-queue:
+			dispatchUpdate(update)
+		case <-ctx.Done():
+			for {
+				select {
+				case update := <-queue:
+					dispatchUpdate(update)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// dispatchUpdate передаёт обновление обработчику. Паника в обработчике не
+// останавливает admin-bot.
+func dispatchUpdate(update adminUpdate) {
+	adminMetrics.queued.Add(-1)
+	defer func() {
+		if r := recover(); r != nil {
+			adminMetrics.panics.Add(1)
+			log.Printf("Panic handling admin update %d: %v\n%s", update.UpdateID, r, debug.Stack())
+		}
+	}()
+
+	if update.Message != nil {
+		adminMetrics.messages.Add(1)
+		handleMessage(update.Message, update.rawMessage)
+	} else if update.CallbackQuery != nil {
+		adminMetrics.callbacks.Add(1)
+		handleCallback(update.CallbackQuery)
+	}
+}
+
+// serveAdminHealth отвечает 503, если недоступна база: без неё admin-bot
+// не работает. Redis необязателен и только показывается.
+func serveAdminHealth(mode string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+		defer cancel()
+
+		status := struct {
+			Mode  string `json:"mode"`
+			DB    bool   `json:"db"`
+			Redis bool   `json:"redis"`
+			Queue int64  `json:"queue"`
+		}{Mode: mode, Queue: adminMetrics.queued.Load()}
+		status.DB = db.PingContext(ctx) == nil
+		status.Redis = limiter != nil && sharedredis.Client.Ping(ctx).Err() == nil
+
+		w.Header().Set("Content-Type", "application/json")
+		if !status.DB {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(status)
+	}
+}
+
+// serveAdminMetrics отдаёт счётчики в текстовом формате Prometheus.
+func serveAdminMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintf(w, "# HELP admin_bot_updates_total Updates handled by admin-bot.\n# TYPE admin_bot_updates_total counter\n")
+	fmt.Fprintf(w, "admin_bot_updates_total{type=\"message\"} %d\n", adminMetrics.messages.Load())
+	fmt.Fprintf(w, "admin_bot_updates_total{type=\"callback_query\"} %d\n", adminMetrics.callbacks.Load())
+	fmt.Fprintf(w, "# HELP admin_bot_webhook_rejected_total Webhook requests with a wrong secret token.\n# TYPE admin_bot_webhook_rejected_total counter\n")
+	fmt.Fprintf(w, "admin_bot_webhook_rejected_total %d\n", adminMetrics.rejected.Load())
+	fmt.Fprintf(w, "# HELP admin_bot_invalid_updates_total Updates that could not be decoded and were skipped.\n# TYPE admin_bot_invalid_updates_total counter\n")
+	fmt.Fprintf(w, "admin_bot_invalid_updates_total %d\n", adminMetrics.invalid.Load())
+	fmt.Fprintf(w, "# HELP admin_bot_update_panics_total Updates whose handler panicked.\n# TYPE admin_bot_update_panics_total counter\n")
+	fmt.Fprintf(w, "admin_bot_update_panics_total %d\n", adminMetrics.panics.Load())
+	fmt.Fprintf(w, "# HELP admin_bot_queue_length Updates waiting to be handled.\n# TYPE admin_bot_queue_length gauge\n")
+	fmt.Fprintf(w, "admin_bot_queue_length %d\n", adminMetrics.queued.Load())
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	sharedredis "shared/redis"
+	"shared/sender"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	deactivatedCheckInterval = time.Minute
+
+	actionReplaceToken = "awaiting_replacement_token"
+)
+
+// deactivateBot отключает бота, чей токен Telegram больше не принимает, и
+// просит воркеры остановить его. Возвращает false, если бот уже отключён.
+// Владельцу сообщает watchDeactivatedBots.
+func deactivateBot(botID int64, reason string) (bool, error) {
+	res, err := db.Exec(`
+        UPDATE bots SET is_active = false, deactivated_reason = $1, deactivated_at = NOW(),
+               owner_notified_at = NULL, updated_at = NOW()
+        WHERE split_part(bot_token, ':', 1)::bigint = $2 AND is_active`, reason, botID)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, nil
+	}
+
+	log.Printf("Bot %d deactivated, token rejected by Telegram: %s", botID, reason)
+	go func() {
+		if _, err := sendBotCommand(sharedredis.CommandStopBot, botID); err != nil {
+			log.Printf("Error stopping deactivated bot %d: %v", botID, err)
+		}
+	}()
+	return true, nil
+}
+
+// watchDeactivatedBots сообщает владельцам о ботах, которые отключились
+// из-за отклонённого токена. Боты отключают и воркеры, и admin-bot, поэтому
+// уведомления отправляются отсюда по отметке в базе.
+func watchDeactivatedBots() {
+	ticker := time.NewTicker(deactivatedCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := notifyDeactivatedBots(); err != nil {
+			log.Printf("Deactivated bots check failed: %v", err)
+		}
+	}
+}
+
+func notifyDeactivatedBots() error {
+	rows, err := db.Query(`
+        SELECT user_id, bot_token, deactivated_reason FROM bots
+        WHERE NOT is_active AND deactivated_at IS NOT NULL AND owner_notified_at IS NULL`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	type deactivated struct {
+		ownerID int64
+		token   string
+		reason  string
+	}
+
+	var pending []deactivated
+	for rows.Next() {
+		var d deactivated
+		if err := rows.Scan(&d.ownerID, &d.token, &d.reason); err != nil {
+			log.Printf("Row scan error: %v", err)
+			continue
+		}
+		pending = append(pending, d)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, d := range pending {
+		botID := botIDFromToken(d.token)
+		msg := tgbotapi.NewMessage(d.ownerID, fmt.Sprintf(
+			"⛔ Бот %s отключён: Telegram не принимает его токен.\n\nПричина: %s\n\n"+
+				"Если вы отозвали токен в BotFather, пришлите новый — подписчики, шаблоны и статистика бота сохранятся.",
+			maskToken(d.token), d.reason))
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("🔑 Заменить токен", fmt.Sprintf("bot_token:%d", botID)),
+				tgbotapi.NewInlineKeyboardButtonData("🤖 К боту", fmt.Sprintf("bot_view:%d", botID)),
+			),
+		)
+		send(msg)
+
+		_, err := db.Exec(`
+            UPDATE bots SET owner_notified_at = NOW()
+            WHERE bot_token = $1 AND owner_notified_at IS NULL`, d.token)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StartReplaceToken запрашивает новый токен бота. Им заменяют и отклонённый
+// токен, и токен, который владелец сменил сам, например после утечки.
+func StartReplaceToken(chatID, userID, botID int64) {
+	b, err := getOwnedBot(userID, botID)
+	if err != nil {
+		log.Printf("Database query error: %v", err)
+		sendMessage(chatID, "❌ Не удалось загрузить бота")
+		return
+	}
+	if b == nil {
+		sendMessage(chatID, "Бот не найден")
+		return
+	}
+
+	setUserState(userID, &UserState{
+		CurrentAction: actionReplaceToken,
+		TempData:      map[string]interface{}{"bot_id": botID},
+	})
+
+	text := fmt.Sprintf("🔑 Пришлите новый токен бота %s.\n\nВ BotFather: /mybots → бот → API Token → Revoke current token. "+
+		"Нужен токен этого же бота: подписчики привязаны к нему.", maskToken(b.Token))
+	if b.IsActive {
+		text += "\n\nПосле отзыва старого токена бот не работает, пока вы не пришлёте новый."
+	}
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyMarkup = getCancelKeyboard()
+	send(msg)
+}
+
+func handleReplaceTokenInput(message *tgbotapi.Message, state *UserState) {
+	botID, _ := state.TempData["bot_id"].(int64)
+	token := strings.TrimSpace(message.Text)
+
+	if !isValidBotToken(token) {
+		sendMessage(message.Chat.ID, "❌ Неверный формат токена. Токен должен быть в формате 1234567890:ABCdefghijk_Lmnopqrstuvwxyz")
+		return
+	}
+
+	b, err := getOwnedBot(message.From.ID, botID)
+	if err != nil {
+		log.Printf("Database query error: %v", err)
+		sendMessage(message.Chat.ID, "❌ Не удалось загрузить бота")
+		return
+	}
+	if b == nil {
+		clearUserState(message.From.ID)
+		sendMessage(message.Chat.ID, "Бот не найден")
+		return
+	}
+	if token == b.Token {
+		sendMessage(message.Chat.ID, "❌ Это текущий токен бота. Отзовите его в BotFather и пришлите новый")
+		return
+	}
+
+	// NewBotAPI вызывает getMe: токен рабочий и принадлежит этому боту
+	client, err := tgbotapi.NewBotAPI(token)
+	if err != nil {
+		log.Printf("Error checking new token of bot %d: %v", botID, err)
+		sendMessage(message.Chat.ID, "❌ Telegram не принял токен: "+err.Error())
+		return
+	}
+	if client.Self.ID != botID {
+		sendMessage(message.Chat.ID, "❌ Это токен другого бота. Пришлите новый токен того же бота из BotFather")
+		return
+	}
+
+	active, err := rotateBotToken(message.From.ID, b.Token, client)
+	if errors.Is(err, errTokenChanged) {
+		clearUserState(message.From.ID)
+		sendMessage(message.Chat.ID, "Токен бота уже изменился, откройте бота заново")
+		return
+	}
+	if err != nil {
+		log.Printf("Error rotating token of bot %d: %v", botID, err)
+		sendMessage(message.Chat.ID, "❌ Не удалось сменить токен: "+err.Error())
+		return
+	}
+	clearUserState(message.From.ID)
+	sendMessage(message.Chat.ID, fmt.Sprintf("✅ Токен бота @%s заменён. Подписчики, шаблоны и статистика сохранены", client.Self.UserName))
+
+	if active {
+		status, err := sendBotCommand(sharedredis.CommandRotateToken, botID)
+		if err != nil {
+			log.Printf("Error sending %s for bot %d: %v", sharedredis.CommandRotateToken, botID, err)
+			sendMessage(message.Chat.ID, "⚠️ Воркеры ещё не получили новый токен, бот перезапустится в течение минуты")
+		} else {
+			sendMessage(message.Chat.ID, "Статус бота: "+describeBotStatus(status))
+		}
+	}
+	ShowBotDetails(message.Chat.ID, message.From.ID, botID)
+}
+
+var errTokenChanged = errors.New("bot token changed concurrently")
+
+// rotateBotToken переводит бота на новый токен и возвращает, активен ли бот
+// после смены. Бот, отключённый из-за отклонённого токена, включается снова,
+// остановленный владельцем остаётся остановленным.
+//
+// Строка в bots сохраняется, поэтому шаблон, реферальный код и всё, что
+// привязано к ID бота, остаётся: подписчики, статистика, outbox и file_id
+// медиатеки. file_id Telegram выдаёт боту, а не токену, и они остаются
+// рабочими. Ключи Redis воркера построены на ID бота и переноса не требуют.
+func rotateBotToken(userID int64, oldToken string, client *tgbotapi.BotAPI) (bool, error) {
+	newToken := client.Token
+	botID := client.Self.ID
+
+	var active bool
+	err := db.QueryRow(`
+        UPDATE bots SET bot_token = $1, is_active = is_active OR deactivated_reason <> '',
+               deactivated_reason = '', deactivated_at = NULL, owner_notified_at = NULL, updated_at = NOW()
+        WHERE user_id = $2 AND bot_token = $3
+        RETURNING is_active`, newToken, userID, oldToken).Scan(&active)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, errTokenChanged
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to save token: %w", err)
+	}
+	notifyBindingChanged(newToken)
+
+	// Вебхук общий для всех токенов бота: старый снимается только после
+	// сохранения нового токена и до регистрации нового вебхука, иначе
+	// deleteWebhook снял бы и новый. Отозванный токен Telegram не примет,
+	// тогда снимать нечего
+	if _, err := rawBotClient(oldToken).Request(tgbotapi.DeleteWebhookConfig{}); err != nil && !sender.IsUnauthorized(err) {
+		log.Printf("Error deleting old webhook of bot %d: %v", botID, err)
+	}
+
+	if err := setBotWebhook(client, newToken); err != nil {
+		// Монитор вебхуков повторит регистрацию для активного бота
+		log.Printf("Error registering webhook of bot %d: %v", botID, err)
+	}
+
+	webhookMu.Lock()
+	delete(webhookClients, oldToken)
+	webhookMu.Unlock()
+	return active, nil
+}
+
+// rawBotClient создаёт клиент Bot API без проверки токена: NewBotAPI
+// вызывает getMe, и с отозванным токеном клиента не получить.
+func rawBotClient(token string) *tgbotapi.BotAPI {
+	client := &tgbotapi.BotAPI{
+		Token:  token,
+		Client: &http.Client{Timeout: commandTimeout},
+		Buffer: 100,
+	}
+	client.SetAPIEndpoint(tgbotapi.APIEndpoint)
+	return client
+}
@@ -0,0 +1,684 @@
+package main
+
+import (
+	"admin-bot/models"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"shared/commands"
+	"shared/content"
+	"shared/keyboard"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// actionImport — владелец должен прислать документ с шаблонами.
+	actionImport = "awaiting_import_document"
+
+	// documentVersion — версия формата экспорта. Клавиатура внутри
+	// документа хранится в формате bot_templates.keyboard.
+	documentVersion = 1
+
+	maxImportSize      = 1 << 20
+	maxImportTemplates = 100
+	maxTemplateName    = 255
+)
+
+const (
+	importOverwrite = "overwrite"
+	importCopy      = "copy"
+	importSkip      = "skip"
+)
+
+// exportDocument — документ с шаблонами, который admin-bot отправляет при
+// экспорте и принимает при импорте.
+type exportDocument struct {
+	Version   int                `json:"version"`
+	Templates []exportedTemplate `json:"templates"`
+}
+
+type exportedTemplate struct {
+	Name      string             `json:"name"`
+	Content   string             `json:"content"`
+	ParseMode string             `json:"parse_mode,omitempty"`
+	Media     *exportedMedia     `json:"media,omitempty"`
+	Keyboard  *keyboard.Keyboard `json:"keyboard,omitempty"`
+}
+
+// exportedMedia ссылается на файл медиатеки по хешу содержимого: сам файл
+// в документ не попадает, при импорте он находится в общем хранилище.
+type exportedMedia struct {
+	Type     string `json:"type"`
+	FileName string `json:"file_name,omitempty"`
+	SHA256   string `json:"sha256,omitempty"`
+}
+
+// importPlan — проверенный документ, ожидающий подтверждения владельца.
+type importPlan struct {
+	FileName  string
+	Templates []exportedTemplate
+	// Existing — шаблоны владельца с теми же названиями
+	Existing map[string]int64
+}
+
+// ShowExportMenu предлагает выгрузить шаблон или весь поток, который
+// начинается с него.
+func ShowExportMenu(chatID, userID, templateID int64) {
+	template := getTemplateByID(templateID)
+	if template == nil || template.UserID != userID {
+		sendMessage(chatID, "Шаблон не найден")
+		return
+	}
+
+	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf(
+		"📤 Экспорт шаблона «%s»\n\nПоток — шаблон и все шаблоны, к которым ведут его кнопки.", template.Name))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Шаблон JSON", fmt.Sprintf("export:%d:template:json", template.ID)),
+			tgbotapi.NewInlineKeyboardButtonData("Шаблон YAML", fmt.Sprintf("export:%d:template:yaml", template.ID)),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Поток JSON", fmt.Sprintf("export:%d:flow:json", template.ID)),
+			tgbotapi.NewInlineKeyboardButtonData("Поток YAML", fmt.Sprintf("export:%d:flow:yaml", template.ID)),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("⬅️ Назад", fmt.Sprintf("view_template:%d", template.ID)),
+		),
+	)
+	send(msg)
+}
+
+// ExportTemplates отправляет владельцу документ с шаблоном или потоком.
+func ExportTemplates(chatID, userID, templateID int64, scope, format string) {
+	template := getTemplateByID(templateID)
+	if template == nil || template.UserID != userID {
+		sendMessage(chatID, "Шаблон не найден")
+		return
+	}
+
+	templates := []models.BotTemplate{*template}
+	if scope == "flow" {
+		templates = collectFlow(userID, template)
+	}
+
+	doc := exportDocument{Version: documentVersion}
+	for i := range templates {
+		t, err := exportTemplate(&templates[i])
+		if err != nil {
+			log.Printf("Error exporting template %d: %v", templates[i].ID, err)
+			sendMessage(chatID, fmt.Sprintf("❌ Не удалось выгрузить шаблон «%s»", templates[i].Name))
+			return
+		}
+		doc.Templates = append(doc.Templates, t)
+	}
+
+	data, err := encodeDocument(&doc, format)
+	if err != nil {
+		log.Printf("Error encoding export document: %v", err)
+		sendMessage(chatID, "❌ Не удалось сформировать документ")
+		return
+	}
+
+	msg := tgbotapi.NewDocument(chatID, tgbotapi.FileBytes{
+		Name:  exportFileName(template.Name, format),
+		Bytes: data,
+	})
+	msg.Caption = fmt.Sprintf("📤 Шаблонов в документе: %d. Чтобы загрузить их обратно, используйте «📥 Импорт» в списке шаблонов.", len(doc.Templates))
+	send(msg)
+}
+
+// collectFlow возвращает шаблон и все шаблоны, достижимые по кнопкам.
+// Имена разрешаются так же, как в воркере (см. commands.Prefer).
+func collectFlow(userID int64, root *models.BotTemplate) []models.BotTemplate {
+	byName := make(map[string]models.BotTemplate)
+	for _, t := range getUserTemplates(userID) {
+		prev := byName[t.Name]
+		if commands.Prefer(commands.Template{ID: t.ID, Active: t.IsActive}, commands.Template{ID: prev.ID, Active: prev.IsActive}) {
+			byName[t.Name] = t
+		}
+	}
+
+	flow := []models.BotTemplate{*root}
+	seen := map[string]bool{root.Name: true}
+	for i := 0; i < len(flow); i++ {
+		kb, err := keyboard.Parse(flow[i].Keyboard)
+		if err != nil || kb == nil {
+			continue
+		}
+		for _, name := range kb.Nodes() {
+			next, ok := byName[name]
+			if !ok || seen[name] {
+				continue
+			}
+			seen[name] = true
+			flow = append(flow, next)
+		}
+	}
+	return flow
+}
+
+func exportTemplate(t *models.BotTemplate) (exportedTemplate, error) {
+	result := exportedTemplate{
+		Name:      t.Name,
+		Content:   t.Content,
+		ParseMode: t.ParseMode,
+	}
+
+	kb, err := keyboard.Parse(t.Keyboard)
+	if err != nil {
+		return result, err
+	}
+	if kb != nil {
+		kb.Version = keyboard.Version
+		result.Keyboard = kb
+	}
+
+	if t.MediaType != "" {
+		result.Media = &exportedMedia{Type: t.MediaType}
+	}
+	if t.MediaID != nil && result.Media != nil {
+		err := db.QueryRow(`
+        SELECT file_name, storage_key FROM media_files WHERE id = $1`, *t.MediaID).Scan(&result.Media.FileName, &result.Media.SHA256)
+		if err != nil {
+			return result, fmt.Errorf("failed to load media %d: %w", *t.MediaID, err)
+		}
+	}
+	return result, nil
+}
+
+func exportFileName(name, format string) string {
+	base := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+	if base == "" {
+		base = "templates"
+	}
+	return base + "." + format
+}
+
+func encodeDocument(doc *exportDocument, format string) ([]byte, error) {
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil || format != "yaml" {
+		return data, err
+	}
+
+	// JSON — подмножество YAML: разбираем его в дерево, чтобы сохранить
+	// порядок полей, и выводим в блочном стиле
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return nil, err
+	}
+	blockStyle(&node)
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&node); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// blockStyle убирает стиль JSON из дерева. Многострочный текст шаблонов
+// выводится литеральным блоком, чтобы его было удобно править.
+func blockStyle(node *yaml.Node) {
+	node.Style = 0
+	if node.Kind == yaml.ScalarNode && strings.Contains(node.Value, "\n") {
+		node.Style = yaml.LiteralStyle
+	}
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
+
+// decodeDocument читает документ по расширению файла. Неизвестные поля
+// считаются ошибкой, чтобы опечатка не терялась молча.
+func decodeDocument(fileName string, data []byte) (*exportDocument, error) {
+	switch strings.ToLower(path.Ext(fileName)) {
+	case ".json":
+	case ".yaml", ".yml":
+		var tree interface{}
+		if err := yaml.Unmarshal(data, &tree); err != nil {
+			return nil, fmt.Errorf("некорректный YAML: %v", err)
+		}
+		converted, err := json.Marshal(tree)
+		if err != nil {
+			return nil, errors.New("некорректный YAML: ключи должны быть строками")
+		}
+		data = converted
+	default:
+		return nil, errors.New("поддерживаются файлы .json, .yaml и .yml")
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var doc exportDocument
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("документ не соответствует схеме: %v", err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("документ не соответствует схеме: лишние данные после документа")
+	}
+	return &doc, nil
+}
+
+// StartImport ждёт от владельца документ с шаблонами.
+func StartImport(chatID, userID int64) {
+	setUserState(userID, &UserState{
+		CurrentAction: actionImport,
+		TempData:      make(map[string]interface{}),
+	})
+
+	msg := tgbotapi.NewMessage(chatID, "📥 Импорт шаблонов\n\nОтправьте файл .json или .yaml, выгруженный через «📤 Экспорт». "+
+		"Перед сохранением я покажу, что будет создано и какие шаблоны совпадают по названию с вашими.")
+	msg.ReplyMarkup = getCancelKeyboard()
+	send(msg)
+}
+
+// handleImportDocument проверяет присланный документ и показывает итог
+// импорта без сохранения.
+func handleImportDocument(message *tgbotapi.Message, state *UserState) {
+	if message.Document == nil {
+		sendMessage(message.Chat.ID, "❌ Отправьте шаблоны файлом .json или .yaml")
+		return
+	}
+	if message.Document.FileSize > maxImportSize {
+		sendMessage(message.Chat.ID, "❌ Файл больше 1 МБ")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	data, err := downloadFile(ctx, message.Document.FileID, maxImportSize)
+	if err != nil {
+		log.Printf("Error downloading import document: %v", err)
+		sendMessage(message.Chat.ID, "❌ Не удалось скачать файл. Попробуйте ещё раз")
+		return
+	}
+
+	doc, err := decodeDocument(message.Document.FileName, data)
+	if err != nil {
+		msg := tgbotapi.NewMessage(message.Chat.ID, "❌ "+err.Error())
+		msg.ReplyMarkup = getCancelKeyboard()
+		send(msg)
+		return
+	}
+
+	plan, problems, warnings := planImport(message.From.ID, message.Document.FileName, doc)
+	if len(problems) > 0 {
+		msg := tgbotapi.NewMessage(message.Chat.ID, "❌ Документ не прошёл проверку, ничего не сохранено:\n• "+
+			strings.Join(problems, "\n• ")+"\n\nИсправьте файл и отправьте его снова.")
+		msg.ReplyMarkup = getCancelKeyboard()
+		send(msg)
+		return
+	}
+
+	state.TempData["import"] = plan
+	showImportSummary(message.Chat.ID, plan, warnings)
+}
+
+// planImport проверяет документ и сопоставляет шаблоны с уже
+// существующими. problems делают импорт невозможным, warnings — нет.
+func planImport(userID int64, fileName string, doc *exportDocument) (*importPlan, []string, []string) {
+	var problems, warnings []string
+
+	if doc.Version != documentVersion {
+		return nil, []string{fmt.Sprintf("неподдерживаемая версия документа %d (ожидается %d)", doc.Version, documentVersion)}, nil
+	}
+	if len(doc.Templates) == 0 {
+		return nil, []string{"в документе нет шаблонов"}, nil
+	}
+	if len(doc.Templates) > maxImportTemplates {
+		return nil, []string{fmt.Sprintf("слишком много шаблонов: %d (максимум %d)", len(doc.Templates), maxImportTemplates)}, nil
+	}
+
+	plan := &importPlan{FileName: fileName}
+	names := make(map[string]bool)
+	for _, t := range doc.Templates {
+		t.Name = strings.TrimSpace(t.Name)
+		if problem := checkImportedTemplate(&t, names); problem != "" {
+			problems = append(problems, problem)
+			continue
+		}
+		names[t.Name] = true
+
+		if t.Media != nil && t.Media.SHA256 != "" && !mediaExists(t.Media.SHA256) {
+			warnings = append(warnings, fmt.Sprintf("«%s»: файл медиа не найден в хранилище, шаблон будет сохранён без медиа", t.Name))
+			t.Media = nil
+		} else if t.Media != nil && t.Media.SHA256 == "" {
+			warnings = append(warnings, fmt.Sprintf("«%s»: медиа не выгружено в медиатеку, шаблон будет сохранён без медиа", t.Name))
+			t.Media = nil
+		}
+		if t.Media == nil && strings.TrimSpace(t.Content) == "" {
+			problems = append(problems, fmt.Sprintf("«%s»: без медиа шаблону нужен текст", t.Name))
+			continue
+		}
+
+		plan.Templates = append(plan.Templates, t)
+	}
+	if len(problems) > 0 {
+		return nil, problems, warnings
+	}
+
+	// Заменяется тот из одноимённых шаблонов, который открывает воркер
+	// (см. commands.Prefer). Если активных нет — последний созданный
+	plan.Existing = make(map[string]int64)
+	preferred := make(map[string]commands.Template)
+	known := make(map[string]bool)
+	for _, t := range getUserTemplates(userID) {
+		known[t.Name] = true
+		if !names[t.Name] {
+			continue
+		}
+		ref := commands.Template{ID: t.ID, Active: t.IsActive}
+		if commands.Prefer(ref, preferred[t.Name]) {
+			preferred[t.Name] = ref
+			plan.Existing[t.Name] = t.ID
+		} else if preferred[t.Name].ID == 0 && t.ID > plan.Existing[t.Name] {
+			plan.Existing[t.Name] = t.ID
+		}
+	}
+	for _, t := range plan.Templates {
+		if t.Keyboard == nil {
+			continue
+		}
+		var missing []string
+		for _, node := range t.Keyboard.Nodes() {
+			if !names[node] && !known[node] {
+				missing = append(missing, node)
+			}
+		}
+		if len(missing) > 0 {
+			warnings = append(warnings, fmt.Sprintf("«%s»: кнопки ведут к отсутствующим шаблонам %s", t.Name, strings.Join(missing, ", ")))
+		}
+	}
+	return plan, nil, warnings
+}
+
+// checkImportedTemplate проверяет шаблон так же, как мастер создания.
+func checkImportedTemplate(t *exportedTemplate, names map[string]bool) string {
+	if t.Name == "" {
+		return "шаблон без названия"
+	}
+	if utf8.RuneCountInString(t.Name) > maxTemplateName {
+		return fmt.Sprintf("«%s»: название длиннее %d символов", t.Name, maxTemplateName)
+	}
+	if names[t.Name] {
+		return fmt.Sprintf("«%s»: название повторяется в документе", t.Name)
+	}
+
+	switch t.ParseMode {
+	case "", tgbotapi.ModeHTML, tgbotapi.ModeMarkdownV2, tgbotapi.ModeMarkdown:
+	default:
+		return fmt.Sprintf("«%s»: неизвестный режим разметки %q", t.Name, t.ParseMode)
+	}
+	if err := content.CheckPlaceholders(t.Content); err != nil {
+		return fmt.Sprintf("«%s»: %v", t.Name, err)
+	}
+
+	if t.Media != nil {
+		if _, _, ok := content.MediaMethod(t.Media.Type); !ok {
+			return fmt.Sprintf("«%s»: неизвестный тип медиа %q", t.Name, t.Media.Type)
+		}
+	}
+	if t.Keyboard != nil {
+		if err := t.Keyboard.Validate(); err != nil {
+			return fmt.Sprintf("«%s»: %v", t.Name, err)
+		}
+	}
+	return ""
+}
+
+func mediaExists(storageKey string) bool {
+	var exists bool
+	err := db.QueryRow(`
+        SELECT EXISTS (SELECT 1 FROM media_files WHERE storage_key = $1)`, storageKey).Scan(&exists)
+	if err != nil {
+		log.Printf("Database query error: %v", err)
+	}
+	return exists
+}
+
+func showImportSummary(chatID int64, plan *importPlan, warnings []string) {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "📥 Проверка «%s» пройдена, пока ничего не сохранено.\n\n", plan.FileName)
+	fmt.Fprintf(&sb, "Шаблонов в документе: %d\n", len(plan.Templates))
+	fmt.Fprintf(&sb, "Новых: %d\n", len(plan.Templates)-len(plan.Existing))
+
+	if len(plan.Existing) > 0 {
+		conflicts := make([]string, 0, len(plan.Existing))
+		for name := range plan.Existing {
+			conflicts = append(conflicts, name)
+		}
+		sort.Strings(conflicts)
+		fmt.Fprintf(&sb, "Совпадают по названию с вашими: %d\n• %s\n", len(conflicts), strings.Join(conflicts, "\n• "))
+	}
+	if len(warnings) > 0 {
+		sb.WriteString("\n⚠️ Предупреждения:\n• " + strings.Join(warnings, "\n• ") + "\n")
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	if len(plan.Existing) == 0 {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✅ Импортировать", "import_apply:"+importSkip),
+		))
+	} else {
+		sb.WriteString("\nЧто сделать с совпадающими шаблонами? Замена сохраняется черновиком и не затрагивает ботов до публикации.")
+		rows = append(rows,
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("♻️ Заменить", "import_apply:"+importOverwrite),
+				tgbotapi.NewInlineKeyboardButtonData("➕ Сохранить копии", "import_apply:"+importCopy),
+			),
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("⏭ Пропустить", "import_apply:"+importSkip),
+			),
+		)
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("❌ Отмена", "cancel"),
+	))
+
+	msg := tgbotapi.NewMessage(chatID, sb.String())
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	send(msg)
+}
+
+// ApplyImport сохраняет подтверждённый импорт одной транзакцией.
+func ApplyImport(chatID, userID int64, mode string) {
+	state := getUserState(userID)
+	if state == nil || state.CurrentAction != actionImport {
+		sendMessage(chatID, "Импорт устарел. Отправьте документ заново.")
+		return
+	}
+	plan, ok := state.TempData["import"].(*importPlan)
+	if !ok {
+		sendMessage(chatID, "Сначала отправьте документ с шаблонами")
+		return
+	}
+
+	templates, existing := plan.Templates, plan.Existing
+	if mode == importCopy {
+		// После переименования совпадений не остаётся
+		templates, existing = renameConflicts(userID, plan), nil
+	}
+
+	created, replaced, skipped, err := saveImport(userID, templates, existing, mode)
+	if err != nil {
+		log.Printf("Error importing templates: %v", err)
+		msg := tgbotapi.NewMessage(chatID, "❌ Ошибка при сохранении, ничего не импортировано. Попробуйте ещё раз.")
+		msg.ReplyMarkup = getCancelKeyboard()
+		send(msg)
+		return
+	}
+
+	clearUserState(userID)
+	text := fmt.Sprintf("✅ Импорт завершён\n\nСоздано: %d\nЗаменено черновиками: %d\nПропущено: %d", created, replaced, skipped)
+	if replaced > 0 {
+		text += "\n\nЗамены сохранены черновиками. Проверьте и опубликуйте их в карточках шаблонов."
+	}
+	sendMessage(chatID, text)
+	ShowOwnerPanel(bot, chatID)
+}
+
+func saveImport(userID int64, templates []exportedTemplate, existing map[string]int64, mode string) (created, replaced, skipped int, err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	defer tx.Rollback()
+
+	for _, t := range templates {
+		existingID, conflict := existing[t.Name]
+		if conflict && mode == importSkip {
+			skipped++
+			continue
+		}
+
+		var keyboardJSON []byte
+		if t.Keyboard != nil {
+			if keyboardJSON, err = t.Keyboard.Marshal(); err != nil {
+				return 0, 0, 0, err
+			}
+		}
+
+		var mediaType string
+		var mediaID sql.NullInt64
+		if t.Media != nil {
+			mediaType = t.Media.Type
+			if mediaID, err = importMedia(tx, userID, t.Media.SHA256); err != nil {
+				return 0, 0, 0, err
+			}
+		}
+
+		// Замена попадает в черновик: опубликованную версию могут
+		// использовать работающие боты
+		if conflict {
+			draft := &templateDraft{
+				TemplateID: existingID,
+				Content:    t.Content,
+				Keyboard:   keyboardJSON,
+				ParseMode:  t.ParseMode,
+				MediaType:  mediaType,
+				AuthorID:   userID,
+			}
+			if mediaID.Valid {
+				draft.MediaID = &mediaID.Int64
+			}
+			if err = saveDraft(tx, draft); err != nil {
+				return 0, 0, 0, err
+			}
+			replaced++
+			continue
+		}
+
+		var id int64
+		err = tx.QueryRow(`
+        INSERT INTO bot_templates
+        (user_id, name, content, keyboard, is_active, created_at, updated_at, parse_mode, media_type, media_file_id, media_id)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, '', $10)
+        RETURNING id`,
+			userID, t.Name, t.Content, keyboardJSON, true, time.Now(), time.Now(), t.ParseMode, mediaType, mediaID).Scan(&id)
+		if err != nil {
+			return 0, 0, 0, fmt.Errorf("failed to insert template %q: %w", t.Name, err)
+		}
+		if _, err = recordVersion(tx, id, userID, "Импорт"); err != nil {
+			return 0, 0, 0, err
+		}
+		created++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, 0, 0, err
+	}
+	if created > 0 {
+		notifyTemplateChanged(userID, 0)
+	}
+	return created, replaced, skipped, nil
+}
+
+// importMedia добавляет файл хранилища в медиатеку владельца: файл мог
+// быть выгружен другим владельцем.
+func importMedia(tx *sql.Tx, userID int64, storageKey string) (sql.NullInt64, error) {
+	var id int64
+	err := tx.QueryRow(`
+        INSERT INTO media_files (owner_id, kind, file_name, mime_type, size, storage_key)
+        SELECT $1, kind, file_name, mime_type, size, storage_key
+        FROM media_files WHERE storage_key = $2
+        LIMIT 1
+        ON CONFLICT (owner_id, storage_key) DO UPDATE SET kind = EXCLUDED.kind
+        RETURNING id`, userID, storageKey).Scan(&id)
+	if err != nil {
+		return sql.NullInt64{}, fmt.Errorf("failed to import media %s: %w", storageKey, err)
+	}
+	return sql.NullInt64{Int64: id, Valid: true}, nil
+}
+
+// renameConflicts даёт совпадающим шаблонам свободные названия «Имя (2)»
+// и переписывает ссылки на них внутри документа: кнопки и переменные чата.
+func renameConflicts(userID int64, plan *importPlan) []exportedTemplate {
+	taken := make(map[string]bool)
+	for _, t := range getUserTemplates(userID) {
+		taken[t.Name] = true
+	}
+	for _, t := range plan.Templates {
+		taken[t.Name] = true
+	}
+
+	renamed := make(map[string]string)
+	for name := range plan.Existing {
+		for i := 2; ; i++ {
+			candidate := fmt.Sprintf("%s (%d)", name, i)
+			if !taken[candidate] {
+				taken[candidate] = true
+				renamed[name] = candidate
+				break
+			}
+		}
+	}
+
+	result := make([]exportedTemplate, len(plan.Templates))
+	for i, t := range plan.Templates {
+		if name, ok := renamed[t.Name]; ok {
+			t.Name = name
+		}
+		for old, name := range renamed {
+			t.Content = strings.ReplaceAll(t.Content, "{{"+content.ChatVarPrefix+old+"}}", "{{"+content.ChatVarPrefix+name+"}}")
+			t.Content = strings.ReplaceAll(t.Content, "{{"+content.ChatVarPrefix+old+"|", "{{"+content.ChatVarPrefix+name+"|")
+		}
+		if t.Keyboard != nil {
+			kb := *t.Keyboard
+			kb.Rows = make([][]keyboard.Button, len(t.Keyboard.Rows))
+			for r, row := range t.Keyboard.Rows {
+				kb.Rows[r] = append([]keyboard.Button(nil), row...)
+				for c, b := range kb.Rows[r] {
+					if name, ok := renamed[b.Node]; ok {
+						kb.Rows[r][c].Node = name
+					}
+				}
+			}
+			t.Keyboard = &kb
+		}
+		result[i] = t
+	}
+	return result
+}
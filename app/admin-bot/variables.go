@@ -0,0 +1,28 @@
+package main
+
+import (
+	"shared/content"
+	"strings"
+)
+
+// checkTemplateVars проверяет переменные в тексте шаблона и сообщает
+// владельцу об ошибке. Переменные чата, которые ссылаются на ещё не
+// созданные шаблоны, допустимы, но о них стоит предупредить.
+func checkTemplateVars(userID, chatID int64, text string) bool {
+	if err := content.CheckPlaceholders(text); err != nil {
+		sendMessage(chatID, "❌ "+err.Error())
+		return false
+	}
+
+	var names []string
+	for _, p := range content.Placeholders(text) {
+		if name, ok := strings.CutPrefix(p.Name, content.ChatVarPrefix); ok {
+			names = append(names, name)
+		}
+	}
+	if missing := missingTemplates(userID, names); len(missing) > 0 {
+		sendMessage(chatID, "⚠️ Переменные чата ссылаются на несуществующие шаблоны: "+strings.Join(missing, ", ")+
+			"\nЗначение появится, когда пользователь ответит в шаблоне с таким названием.")
+	}
+	return true
+}
@@ -0,0 +1,473 @@
+package main
+
+import (
+	"admin-bot/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"shared/keyboard"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	historyLimit = 15
+	// maxDiffLength оставляет запас до предела длины сообщения Telegram
+	maxDiffLength = 3500
+)
+
+// templateVersion — сохранённое состояние шаблона. Каждое сохранение
+// шаблона добавляет версию, bot_templates хранит активную.
+type templateVersion struct {
+	Version     int
+	Name        string
+	Content     string
+	Keyboard    []byte
+	ParseMode   string
+	MediaType   string
+	MediaFileID string
+	MediaID     *int64
+	AuthorID    int64
+	Author      string
+	Note        string
+	CreatedAt   time.Time
+}
+
+// recordVersion сохраняет текущее состояние шаблона как новую версию и
+// делает её активной. Вызывается в той же транзакции, что и изменение.
+func recordVersion(tx *sql.Tx, templateID, authorID int64, note string) (int, error) {
+	// Блокировка строки шаблона не даёт двум сохранениям получить один номер
+	if _, err := tx.Exec(`SELECT 1 FROM bot_templates WHERE id = $1 FOR UPDATE`, templateID); err != nil {
+		return 0, fmt.Errorf("failed to lock template %d: %w", templateID, err)
+	}
+
+	var version int
+	err := tx.QueryRow(`
+        INSERT INTO template_versions
+        (template_id, version, name, content, keyboard, parse_mode, media_type, media_file_id, media_id, author_id, note)
+        SELECT id, COALESCE((SELECT MAX(version) FROM template_versions WHERE template_id = $1), 0) + 1,
+               name, COALESCE(content, ''), keyboard, parse_mode, media_type, media_file_id, media_id, $2, $3
+        FROM bot_templates WHERE id = $1
+        RETURNING version`, templateID, authorID, note).Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record version of template %d: %w", templateID, err)
+	}
+
+	if _, err := tx.Exec(`UPDATE bot_templates SET version = $1 WHERE id = $2`, version, templateID); err != nil {
+		return 0, fmt.Errorf("failed to activate version of template %d: %w", templateID, err)
+	}
+	return version, nil
+}
+
+func listVersions(templateID int64) ([]templateVersion, error) {
+	rows, err := db.Query(`
+        SELECT v.version, v.author_id, COALESCE(u.username, ''), v.note, v.created_at
+        FROM template_versions v
+        LEFT JOIN users u ON u.telegram_id = v.author_id
+        WHERE v.template_id = $1
+        ORDER BY v.version DESC
+        LIMIT $2`, templateID, historyLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []templateVersion
+	for rows.Next() {
+		var v templateVersion
+		if err := rows.Scan(&v.Version, &v.AuthorID, &v.Author, &v.Note, &v.CreatedAt); err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+func loadVersion(templateID int64, version int) (*templateVersion, error) {
+	v := templateVersion{Version: version}
+	err := db.QueryRow(`
+        SELECT v.name, v.content, v.keyboard, v.parse_mode, v.media_type, v.media_file_id, v.media_id,
+               v.author_id, COALESCE(u.username, ''), v.note, v.created_at
+        FROM template_versions v
+        LEFT JOIN users u ON u.telegram_id = v.author_id
+        WHERE v.template_id = $1 AND v.version = $2`, templateID, version).Scan(
+		&v.Name, &v.Content, &v.Keyboard, &v.ParseMode, &v.MediaType, &v.MediaFileID, &v.MediaID,
+		&v.AuthorID, &v.Author, &v.Note, &v.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// apply подставляет содержимое версии в шаблон, чтобы проверить его.
+func (v *templateVersion) apply(t *models.BotTemplate) {
+	t.Content = v.Content
+	t.Keyboard = v.Keyboard
+	t.ParseMode = v.ParseMode
+	t.MediaType = v.MediaType
+	t.MediaFileID = v.MediaFileID
+	t.MediaID = v.MediaID
+}
+
+func (v *templateVersion) author() string {
+	if v.Author != "" {
+		return "@" + v.Author
+	}
+	return fmt.Sprintf("ID %d", v.AuthorID)
+}
+
+// ShowTemplateHistory выводит последние версии шаблона.
+func ShowTemplateHistory(chatID, userID, templateID int64) {
+	template := getTemplateByID(templateID)
+	if template == nil || template.UserID != userID {
+		sendMessage(chatID, "Шаблон не найден")
+		return
+	}
+
+	versions, err := listVersions(templateID)
+	if err != nil {
+		log.Printf("Database query error: %v", err)
+		sendMessage(chatID, "❌ Не удалось получить историю шаблона")
+		return
+	}
+	if len(versions) == 0 {
+		sendMessage(chatID, "У шаблона пока нет сохранённых версий")
+		return
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "🕓 История шаблона «%s»\n", template.Name)
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, v := range versions {
+		mark := ""
+		if v.Version == template.Version {
+			mark = " ✅ активная"
+		}
+		fmt.Fprintf(&sb, "\nv%d%s · %s · %s", v.Version, mark, v.CreatedAt.Format("02.01.2006 15:04"), v.author())
+		if v.Note != "" {
+			sb.WriteString(" · " + v.Note)
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("v%d%s", v.Version, mark), fmt.Sprintf("version:%d:%d", templateID, v.Version)),
+		))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("⬅️ Назад", fmt.Sprintf("view_template:%d", templateID)),
+	))
+
+	msg := tgbotapi.NewMessage(chatID, sb.String())
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	send(msg)
+}
+
+// ShowTemplateVersion показывает версию и действия с ней.
+func ShowTemplateVersion(chatID, userID, templateID int64, version int) {
+	template := getTemplateByID(templateID)
+	if template == nil || template.UserID != userID {
+		sendMessage(chatID, "Шаблон не найден")
+		return
+	}
+	v, err := loadVersion(templateID, version)
+	if err != nil {
+		log.Printf("Error loading template version: %v", err)
+		sendMessage(chatID, "Версия не найдена")
+		return
+	}
+
+	text := fmt.Sprintf("Версия %d · %s · %s", v.Version, v.CreatedAt.Format("02.01.2006 15:04"), v.author())
+	if v.Note != "" {
+		text += "\n" + v.Note
+	}
+	text += "\n\n" + strings.Join(versionLines(v), "\n")
+	if len(text) > maxDiffLength {
+		text = strings.ToValidUTF8(text[:maxDiffLength], "") + "…"
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	if v.Version != template.Version {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔍 Сравнить с активной", fmt.Sprintf("version_diff:%d:%d:%d", templateID, v.Version, template.Version)),
+		))
+	}
+	if v.Version > 1 {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔍 Изменения в этой версии", fmt.Sprintf("version_diff:%d:%d:%d", templateID, v.Version-1, v.Version)),
+		))
+	}
+	if v.Version != template.Version {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("↩️ Откатить к этой версии", fmt.Sprintf("rollback:%d:%d", templateID, v.Version)),
+		))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("⬅️ История", fmt.Sprintf("history:%d", templateID)),
+	))
+
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	send(msg)
+}
+
+// ShowVersionDiff отправляет построчную разницу между двумя версиями.
+func ShowVersionDiff(chatID, userID, templateID int64, from, to int) {
+	template := getTemplateByID(templateID)
+	if template == nil || template.UserID != userID {
+		sendMessage(chatID, "Шаблон не найден")
+		return
+	}
+	a, err := loadVersion(templateID, from)
+	if err != nil {
+		sendMessage(chatID, fmt.Sprintf("Версия %d не найдена", from))
+		return
+	}
+	b, err := loadVersion(templateID, to)
+	if err != nil {
+		sendMessage(chatID, fmt.Sprintf("Версия %d не найдена", to))
+		return
+	}
+
+	diff := diffLines(versionLines(a), versionLines(b))
+	changed := false
+	for _, line := range diff {
+		if !strings.HasPrefix(line, " ") {
+			changed = true
+			break
+		}
+	}
+
+	text := fmt.Sprintf("<b>Изменения: версия %d → %d</b>\n", from, to)
+	if !changed {
+		text += "Версии совпадают"
+	} else {
+		body := strings.Join(diff, "\n")
+		if len(body) > maxDiffLength {
+			body = body[:maxDiffLength] + "\n…"
+		}
+		text += "<pre>" + html.EscapeString(strings.ToValidUTF8(body, "")) + "</pre>"
+	}
+
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = tgbotapi.ModeHTML
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("⬅️ К версии", fmt.Sprintf("version:%d:%d", templateID, to)),
+		),
+	)
+	send(msg)
+}
+
+// versionLines представляет версию текстом для просмотра и сравнения.
+func versionLines(v *templateVersion) []string {
+	lines := []string{"Название: " + v.Name}
+	if v.ParseMode != "" {
+		lines = append(lines, "Разметка: "+v.ParseMode)
+	}
+	if v.MediaType != "" {
+		lines = append(lines, "Медиа: "+v.MediaType)
+	}
+	lines = append(lines, "Содержание:")
+	lines = append(lines, strings.Split(v.Content, "\n")...)
+
+	kb, err := keyboard.Parse(v.Keyboard)
+	switch {
+	case err != nil:
+		lines = append(lines, "Клавиатура: [ошибка разбора]")
+	case kb == nil:
+		lines = append(lines, "Клавиатура: нет")
+	default:
+		lines = append(lines, strings.Split("Клавиатура: "+describeKeyboard(kb), "\n")...)
+	}
+	return lines
+}
+
+// diffLines сравнивает тексты построчно через наибольшую общую
+// подпоследовательность: «-» — удалённая строка, «+» — добавленная.
+func diffLines(a, b []string) []string {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var result []string
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			result = append(result, "  "+a[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			result = append(result, "- "+a[i])
+			i++
+		default:
+			result = append(result, "+ "+b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		result = append(result, "- "+a[i])
+	}
+	for ; j < len(b); j++ {
+		result = append(result, "+ "+b[j])
+	}
+	return result
+}
+
+// RollbackTemplate делает активным содержимое старой версии. Откат
+// сохраняется новой версией, поэтому его тоже можно отменить. Название
+// шаблона не меняется: на него ссылаются кнопки других шаблонов.
+//
+// Откат публикует версию сразу, поэтому она проходит ту же проверку, что
+// и черновик: кнопки старой версии могли вести к удалённым шаблонам.
+func RollbackTemplate(chatID, userID, templateID int64, version int) {
+	template := getTemplateByID(templateID)
+	if template == nil || template.UserID != userID {
+		sendMessage(chatID, "Шаблон не найден")
+		return
+	}
+	v, err := loadVersion(templateID, version)
+	if errors.Is(err, sql.ErrNoRows) {
+		sendMessage(chatID, "Версия не найдена")
+		return
+	}
+	if err != nil {
+		log.Printf("Database query error: %v", err)
+		sendMessage(chatID, "❌ Не удалось загрузить версию")
+		return
+	}
+	v.apply(template)
+	if err := validateForPublish(template); err != nil {
+		sendMessage(chatID, fmt.Sprintf("❌ Версия %d не прошла проверку: %s", version, err.Error()))
+		return
+	}
+
+	newVersion, err := rollbackTemplate(userID, templateID, version)
+	if errors.Is(err, sql.ErrNoRows) {
+		sendMessage(chatID, "Версия не найдена")
+		return
+	}
+	if err != nil {
+		log.Printf("Error rolling back template %d: %v", templateID, err)
+		sendMessage(chatID, "❌ Не удалось откатить шаблон")
+		return
+	}
+
+	sendMessage(chatID, fmt.Sprintf("↩️ Шаблон откатился к версии %d и сохранён как версия %d. Боты используют её сразу.", version, newVersion))
+	if template := getTemplateByID(templateID); template != nil {
+		ShowTemplateDetails(bot, chatID, *template)
+	}
+}
+
+func rollbackTemplate(userID, templateID int64, version int) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+        UPDATE bot_templates t
+        SET content = v.content, keyboard = v.keyboard, parse_mode = v.parse_mode,
+            media_type = v.media_type, media_file_id = v.media_file_id, media_id = v.media_id,
+            updated_at = NOW()
+        FROM template_versions v
+        WHERE t.id = $1 AND t.user_id = $2 AND v.template_id = t.id AND v.version = $3`,
+		templateID, userID, version)
+	if err != nil {
+		return 0, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return 0, sql.ErrNoRows
+	}
+
+	newVersion, err := recordVersion(tx, templateID, userID, fmt.Sprintf("Откат к версии %d", version))
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	notifyTemplateChanged(userID, templateID)
+	return newVersion, nil
+}
+
+// EditTemplate запускает мастер шаблона для существующего шаблона.
+// Подставляются содержимое и клавиатура черновика или опубликованной
+// версии, результат сохраняется в черновик.
+func EditTemplate(chatID, userID, templateID int64) {
+	template := getTemplateByID(templateID)
+	if template == nil || template.UserID != userID {
+		sendMessage(chatID, "Шаблон не найден")
+		return
+	}
+	draft, err := loadDraft(templateID)
+	if err != nil {
+		log.Printf("Database query error: %v", err)
+		sendMessage(chatID, "❌ Не удалось загрузить черновик")
+		return
+	}
+	if draft != nil {
+		draft.apply(template)
+	}
+	kb, err := keyboard.Parse(template.Keyboard)
+	if err != nil {
+		log.Printf("Ошибка разбора клавиатуры: %v", err)
+	}
+
+	data := map[string]interface{}{
+		"template_id":   template.ID,
+		"name":          template.Name,
+		"content":       template.Content,
+		"parse_mode":    template.ParseMode,
+		"media_type":    template.MediaType,
+		"media_file_id": template.MediaFileID,
+	}
+	if template.MediaID != nil {
+		data["media_id"] = *template.MediaID
+	}
+	if kb != nil {
+		data["builder"] = kb
+	}
+	setUserState(userID, &UserState{
+		CurrentAction: "awaiting_template_content",
+		TempData:      data,
+	})
+
+	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("✏️ Редактирование шаблона «%s»\n\n"+
+		"Отправьте новое содержание: текст с форматированием или фото, видео, документ, GIF с подписью. "+
+		"Или оставьте текущее и перейдите к клавиатуре.\n\n"+
+		"Изменения сохранятся в черновик, боты будут использовать опубликованную версию до публикации.", template.Name))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("➡️ Оставить содержание", "edit_keep_content"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("❌ Отмена", "cancel"),
+		),
+	)
+	send(msg)
+}
+
+// keepTemplateContent переходит к клавиатуре, не меняя содержание.
+func keepTemplateContent(chatID, userID int64) {
+	state := getUserState(userID)
+	if state == nil || state.CurrentAction != "awaiting_template_content" || state.TempData["template_id"] == nil {
+		sendMessage(chatID, "Редактирование устарело. Откройте шаблон заново.")
+		return
+	}
+	StartKeyboardBuilder(chatID, state)
+}
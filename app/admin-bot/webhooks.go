@@ -0,0 +1,279 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"shared/sender"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	webhookCheckInterval = 5 * time.Minute
+
+	// stuckPendingUpdates — если в очереди Telegram столько обновлений и
+	// очередь не уменьшается между проверками, воркеры их не забирают
+	stuckPendingUpdates = 100
+)
+
+// webhookHealth — результат последней проверки вебхука бота.
+type webhookHealth struct {
+	Info      tgbotapi.WebhookInfo
+	CheckedAt time.Time
+	// Problem пуст, если вебхук в порядке
+	Problem string
+	// alerted — владельцу уже сообщили о проблеме
+	alerted bool
+}
+
+var (
+	webhookMu sync.Mutex
+	// webhookClients — клиенты Bot API по токену: NewBotAPI вызывает getMe,
+	// и без кэша каждая проверка стоила бы два запроса
+	webhookClients = make(map[string]*tgbotapi.BotAPI)
+	webhookStates  = make(map[int64]*webhookHealth)
+)
+
+// webhookURLFor возвращает адрес вебхука, который бот должен получить.
+// Завершающий «/» отбрасывается так же, как в конфиге воркера, иначе
+// admin-bot и воркер ставили бы разные адреса.
+func webhookURLFor(botToken string) string {
+	return strings.TrimSuffix(os.Getenv("WEBHOOK_URL"), "/") + "/webhook/" + botToken
+}
+
+// botsPolling сообщает, что воркеры получают обновления ботов через
+// getUpdates (MODE=polling). Вебхук тогда ставить нельзя: пока он
+// установлен, getUpdates не работает.
+func botsPolling() bool {
+	return os.Getenv("MODE") == "polling"
+}
+
+// watchWebhooks периодически проверяет вебхуки активных ботов, чинит
+// сломанные и сообщает владельцам о проблемах.
+func watchWebhooks() {
+	if botsPolling() {
+		log.Printf("Bots use polling, webhook monitor disabled")
+		return
+	}
+	if os.Getenv("WEBHOOK_URL") == "" {
+		log.Printf("WEBHOOK_URL is not set, webhook monitor disabled")
+		return
+	}
+
+	ticker := time.NewTicker(webhookCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := checkWebhooks(); err != nil {
+			log.Printf("Webhook check failed: %v", err)
+		}
+	}
+}
+
+func checkWebhooks() error {
+	rows, err := db.Query(`
+        SELECT user_id, bot_token FROM bots
+        WHERE is_active`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	type activeBot struct {
+		ownerID int64
+		token   string
+	}
+
+	var bots []activeBot
+	for rows.Next() {
+		var b activeBot
+		if err := rows.Scan(&b.ownerID, &b.token); err != nil {
+			log.Printf("Row scan error: %v", err)
+			continue
+		}
+		bots = append(bots, b)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	active := make(map[int64]bool, len(bots))
+	for _, b := range bots {
+		active[botIDFromToken(b.token)] = true
+		checkWebhook(b.ownerID, b.token)
+	}
+
+	// Отключённые и удалённые боты больше не проверяются
+	webhookMu.Lock()
+	for botID := range webhookStates {
+		if !active[botID] {
+			delete(webhookStates, botID)
+		}
+	}
+	for token := range webhookClients {
+		if !active[botIDFromToken(token)] {
+			delete(webhookClients, token)
+		}
+	}
+	webhookMu.Unlock()
+	return nil
+}
+
+func webhookClient(botToken string) (*tgbotapi.BotAPI, error) {
+	webhookMu.Lock()
+	client := webhookClients[botToken]
+	webhookMu.Unlock()
+	if client != nil {
+		return client, nil
+	}
+
+	client, err := tgbotapi.NewBotAPI(botToken)
+	if err != nil {
+		return nil, err
+	}
+	webhookMu.Lock()
+	webhookClients[botToken] = client
+	webhookMu.Unlock()
+	return client, nil
+}
+
+// checkWebhook проверяет вебхук одного бота. О проблеме владелец узнаёт
+// один раз, и ещё раз — когда вебхук заработает.
+func checkWebhook(ownerID int64, botToken string) {
+	botID := botIDFromToken(botToken)
+
+	client, err := webhookClient(botToken)
+	if err != nil {
+		log.Printf("Error authorizing bot %d for webhook check: %v", botID, err)
+		deactivateRejected(botID, err)
+		return
+	}
+	info, err := client.GetWebhookInfo()
+	if err != nil {
+		log.Printf("Error getting webhook info of bot %d: %v", botID, err)
+		deactivateRejected(botID, err)
+		return
+	}
+
+	webhookMu.Lock()
+	prev := webhookStates[botID]
+	webhookMu.Unlock()
+
+	state := &webhookHealth{
+		Info:      info,
+		CheckedAt: time.Now(),
+		Problem:   diagnoseWebhook(info, webhookURLFor(botToken), prev),
+	}
+	if prev != nil {
+		state.alerted = prev.alerted
+	}
+
+	switch {
+	case state.Problem != "":
+		repaired := "✅ Вебхук зарегистрирован заново."
+		if err := setBotWebhook(client, botToken); err != nil {
+			log.Printf("Error re-registering webhook of bot %d: %v", botID, err)
+			repaired = "❌ Не удалось зарегистрировать вебхук заново: " + err.Error()
+		}
+		log.Printf("Webhook of bot %d is unhealthy: %s", botID, state.Problem)
+		if !state.alerted {
+			sendMessage(ownerID, fmt.Sprintf("⚠️ Бот %s: %s\n\n%s", maskToken(botToken), state.Problem, repaired))
+			state.alerted = true
+		}
+	case state.alerted:
+		sendMessage(ownerID, fmt.Sprintf("✅ Бот %s снова получает обновления", maskToken(botToken)))
+		state.alerted = false
+	}
+
+	webhookMu.Lock()
+	webhookStates[botID] = state
+	webhookMu.Unlock()
+}
+
+// deactivateRejected отключает бота, если Telegram отклонил его токен.
+// Вебхук такого бота больше не проверяется.
+func deactivateRejected(botID int64, err error) {
+	if !sender.IsUnauthorized(err) {
+		return
+	}
+	if _, err := deactivateBot(botID, err.Error()); err != nil {
+		log.Printf("Error deactivating bot %d: %v", botID, err)
+		return
+	}
+	webhookMu.Lock()
+	delete(webhookStates, botID)
+	for token := range webhookClients {
+		if botIDFromToken(token) == botID {
+			delete(webhookClients, token)
+		}
+	}
+	webhookMu.Unlock()
+}
+
+// diagnoseWebhook описывает проблему вебхука для владельца или возвращает
+// пустую строку, если вебхук в порядке.
+func diagnoseWebhook(info tgbotapi.WebhookInfo, expectedURL string, prev *webhookHealth) string {
+	if info.URL == "" {
+		return "вебхук не установлен, бот не получает обновления"
+	}
+	if info.URL != expectedURL {
+		return "вебхук указывает на другой адрес, бот не получает обновления"
+	}
+
+	// Ошибка важна, только если случилась после прошлой проверки
+	since := time.Now().Add(-webhookCheckInterval)
+	if prev != nil {
+		since = prev.CheckedAt
+	}
+	if info.LastErrorDate > 0 && time.Unix(int64(info.LastErrorDate), 0).After(since) {
+		return "Telegram не может доставить обновления: " + info.LastErrorMessage
+	}
+
+	if prev != nil && info.PendingUpdateCount >= stuckPendingUpdates &&
+		info.PendingUpdateCount >= prev.Info.PendingUpdateCount {
+		return fmt.Sprintf("обновления не забираются, в очереди %d", info.PendingUpdateCount)
+	}
+	return ""
+}
+
+// setBotWebhook регистрирует вебхук бота. allowed_updates не передаются:
+// Telegram сохраняет список, который задал воркер. В режиме polling
+// ничего не делает, вебхук снимает воркер.
+func setBotWebhook(client *tgbotapi.BotAPI, botToken string) error {
+	if botsPolling() {
+		return nil
+	}
+	wh, err := tgbotapi.NewWebhook(webhookURLFor(botToken))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook config: %v", err)
+	}
+	_, err = client.Request(wh)
+	return err
+}
+
+// describeWebhookHealth описывает последнюю проверку вебхука для карточки
+// бота. Пустая строка — бот ещё не проверялся.
+func describeWebhookHealth(botID int64) string {
+	webhookMu.Lock()
+	state := webhookStates[botID]
+	webhookMu.Unlock()
+	if state == nil {
+		return ""
+	}
+
+	text := fmt.Sprintf("\nВебхук (%s): ", state.CheckedAt.Format("15:04"))
+	if state.Problem != "" {
+		text += "⚠️ " + state.Problem
+	} else {
+		text += fmt.Sprintf("✅ в порядке, в очереди %d", state.Info.PendingUpdateCount)
+	}
+	if state.Info.LastErrorDate > 0 {
+		text += fmt.Sprintf("\nПоследняя ошибка доставки (%s): %s",
+			time.Unix(int64(state.Info.LastErrorDate), 0).Format("02.01 15:04"), state.Info.LastErrorMessage)
+	}
+	return text
+}
@@ -0,0 +1,31 @@
+CREATE TABLE IF NOT EXISTS chat_states (
+    id BIGSERIAL PRIMARY KEY,
+    chat_id BIGINT NOT NULL,
+    bot_id BIGINT NOT NULL,
+    current_node VARCHAR(100),
+    state_data JSONB,
+    last_active TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_chat_states_bot_chat ON chat_states(bot_id, chat_id);
+CREATE INDEX IF NOT EXISTS idx_chat_states_last_active ON chat_states(last_active);
+
+CREATE TABLE IF NOT EXISTS outbox_messages (
+    id BIGSERIAL PRIMARY KEY,
+    bot_id BIGINT NOT NULL,
+    chat_id BIGINT NOT NULL,
+    method VARCHAR(64) NOT NULL,
+    params JSONB NOT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sent', 'failed')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    sent_at TIMESTAMP WITH TIME ZONE,
+    owner_notified_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_messages_pending ON outbox_messages(next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_outbox_messages_failed ON outbox_messages(bot_id) WHERE status = 'failed' AND owner_notified_at IS NULL;
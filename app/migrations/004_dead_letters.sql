@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS dead_letters (
+    id BIGSERIAL PRIMARY KEY,
+    bot_id BIGINT NOT NULL,
+    update_id BIGINT NOT NULL,
+    payload JSONB,
+    raw_payload TEXT,
+    stage VARCHAR(32) NOT NULL,
+    error TEXT NOT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'new' CHECK (status IN ('new', 'replay', 'replayed', 'discarded')),
+    attempts INTEGER NOT NULL DEFAULT 1,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    resolved_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_dead_letters_bot_status ON dead_letters(bot_id, status);
@@ -0,0 +1,4 @@
+ALTER TABLE bot_templates
+    ADD COLUMN IF NOT EXISTS parse_mode VARCHAR(16) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS media_type VARCHAR(16) NOT NULL DEFAULT '' CHECK (media_type IN ('', 'photo', 'video', 'document', 'animation')),
+    ADD COLUMN IF NOT EXISTS media_file_id TEXT NOT NULL DEFAULT '';
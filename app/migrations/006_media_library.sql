@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS media_files (
+    id BIGSERIAL PRIMARY KEY,
+    owner_id BIGINT NOT NULL,
+    kind VARCHAR(16) NOT NULL CHECK (kind IN ('photo', 'video', 'document', 'animation')),
+    file_name VARCHAR(255) NOT NULL DEFAULT '',
+    mime_type VARCHAR(127) NOT NULL DEFAULT '',
+    size BIGINT NOT NULL DEFAULT 0,
+    storage_key VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    UNIQUE (owner_id, storage_key)
+);
+
+CREATE TABLE IF NOT EXISTS media_bot_files (
+    media_id BIGINT NOT NULL REFERENCES media_files(id) ON DELETE CASCADE,
+    bot_id BIGINT NOT NULL,
+    file_id TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (media_id, bot_id)
+);
+
+ALTER TABLE bot_templates ADD COLUMN IF NOT EXISTS media_id BIGINT REFERENCES media_files(id);
+CREATE INDEX IF NOT EXISTS idx_bot_templates_media ON bot_templates(media_id);
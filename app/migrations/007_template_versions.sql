@@ -0,0 +1,28 @@
+ALTER TABLE bot_templates ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS template_versions (
+    id BIGSERIAL PRIMARY KEY,
+    template_id BIGINT NOT NULL REFERENCES bot_templates(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    content TEXT NOT NULL DEFAULT '',
+    keyboard BYTEA,
+    parse_mode VARCHAR(16) NOT NULL DEFAULT '',
+    media_type VARCHAR(16) NOT NULL DEFAULT '',
+    media_file_id TEXT NOT NULL DEFAULT '',
+    media_id BIGINT REFERENCES media_files(id),
+    author_id BIGINT NOT NULL,
+    note VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    UNIQUE (template_id, version)
+);
+
+-- Текущее содержимое существующих шаблонов становится их первой версией
+INSERT INTO template_versions
+    (template_id, version, name, content, keyboard, parse_mode, media_type, media_file_id, media_id, author_id, note, created_at)
+SELECT t.id, 1, t.name, COALESCE(t.content, ''), t.keyboard, t.parse_mode, t.media_type, t.media_file_id, t.media_id,
+       t.user_id, 'Исходная версия', COALESCE(t.updated_at, t.created_at, NOW())
+FROM bot_templates t
+WHERE NOT EXISTS (SELECT 1 FROM template_versions v WHERE v.template_id = t.id);
+
+UPDATE bot_templates SET version = 1 WHERE version = 0;
@@ -0,0 +1,16 @@
+-- Черновик шаблона. bot_templates хранит опубликованную версию, которую
+-- отдаёт worker-bot, изменения попадают в черновик до публикации.
+CREATE TABLE IF NOT EXISTS template_drafts (
+    template_id BIGINT PRIMARY KEY REFERENCES bot_templates(id) ON DELETE CASCADE,
+    content TEXT NOT NULL DEFAULT '',
+    keyboard BYTEA,
+    parse_mode VARCHAR(16) NOT NULL DEFAULT '',
+    media_type VARCHAR(16) NOT NULL DEFAULT '' CHECK (media_type IN ('', 'photo', 'video', 'document', 'animation')),
+    media_file_id TEXT NOT NULL DEFAULT '',
+    media_id BIGINT REFERENCES media_files(id),
+    author_id BIGINT NOT NULL,
+    publish_at TIMESTAMP WITH TIME ZONE,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_template_drafts_publish_at ON template_drafts(publish_at) WHERE publish_at IS NOT NULL;
@@ -0,0 +1,7 @@
+-- Бот отключается сам, когда Telegram отклоняет его токен (401/404).
+-- Причина показывается владельцу, уведомление отправляется один раз.
+ALTER TABLE bots ADD COLUMN IF NOT EXISTS deactivated_reason TEXT NOT NULL DEFAULT '';
+ALTER TABLE bots ADD COLUMN IF NOT EXISTS deactivated_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE bots ADD COLUMN IF NOT EXISTS owner_notified_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_bots_deactivated ON bots(deactivated_at) WHERE deactivated_at IS NOT NULL AND owner_notified_at IS NULL;
@@ -0,0 +1,9 @@
+-- Вид ошибки доставки. Блокировку бота пользователем обрабатывает воркер,
+-- владельцу о ней не сообщается.
+ALTER TABLE outbox_messages ADD COLUMN IF NOT EXISTS error_kind VARCHAR(16) NOT NULL DEFAULT '';
+
+UPDATE outbox_messages SET error_kind = 'blocked'
+WHERE status = 'failed' AND error_kind = '' AND last_error LIKE 'bot was blocked by the user%';
+
+DROP INDEX IF EXISTS idx_outbox_messages_failed;
+CREATE INDEX IF NOT EXISTS idx_outbox_messages_failed ON outbox_messages(bot_id) WHERE status = 'failed' AND owner_notified_at IS NULL AND error_kind <> 'blocked';
@@ -0,0 +1,2 @@
+-- Диспетчер проверяет, нет ли в чате более раннего отложенного сообщения.
+CREATE INDEX IF NOT EXISTS idx_outbox_messages_pending_chat ON outbox_messages(bot_id, chat_id, id) WHERE status = 'pending';
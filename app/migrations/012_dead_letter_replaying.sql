@@ -0,0 +1,8 @@
+-- Повторяемое обновление переводится в replaying на время обработки.
+-- claimed_at показывает, когда повтор начался: зависшие повторы
+-- возвращаются администратору.
+ALTER TABLE dead_letters ADD COLUMN IF NOT EXISTS claimed_at TIMESTAMP WITH TIME ZONE;
+
+ALTER TABLE dead_letters DROP CONSTRAINT IF EXISTS dead_letters_status_check;
+ALTER TABLE dead_letters ADD CONSTRAINT dead_letters_status_check
+    CHECK (status IN ('new', 'replay', 'replaying', 'replayed', 'discarded'));
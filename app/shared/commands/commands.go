@@ -0,0 +1,126 @@
+package commands
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// MaxCommands — сколько команд Telegram принимает в одном setMyCommands
+	MaxCommands = 100
+
+	maxCommandLength     = 32
+	maxDescriptionLength = 256
+)
+
+// Template — шаблон владельца, на который может указывать имя в кнопке
+// или команде.
+type Template struct {
+	ID     int64
+	Active bool
+}
+
+// Prefer решает, какой из шаблонов владельца с одним именем открывается
+// по этому имени: только активный, а из активных — с наименьшим ID.
+// Возвращает true, если t должен заменить выбранный ранее chosen (нулевой
+// chosen — ещё ничего не выбрано). По этому правилу воркер переходит по
+// кнопкам и командам, а admin-bot строит меню: иначе меню показывало бы
+// шаблоны, которые воркер не откроет или откроет другими.
+func Prefer(t, chosen Template) bool {
+	return t.Active && (chosen.ID == 0 || t.ID < chosen.ID)
+}
+
+// Command — команда меню бота, открывающая шаблон потока.
+type Command struct {
+	Command  string
+	Template string
+}
+
+// Description возвращает описание команды для меню: имя шаблона,
+// обрезанное до лимита Telegram.
+func (c Command) Description() string {
+	if utf8.RuneCountInString(c.Template) <= maxDescriptionLength {
+		return c.Template
+	}
+	return string([]rune(c.Template)[:maxDescriptionLength])
+}
+
+// reserved — команды, которые воркер обрабатывает сам
+var reserved = map[string]bool{"start": true, "auth": true}
+
+// Build строит команды меню по шаблонам потока. flow — имена шаблонов в
+// порядке обхода от стартового, стартовый открывается командой /start.
+// admin-bot и воркер строят команды одной функцией, поэтому воркер находит
+// шаблон команды тем же обходом потока.
+func Build(flow []string) []Command {
+	if len(flow) == 0 {
+		return nil
+	}
+
+	result := []Command{{Command: "start", Template: flow[0]}}
+	seen := map[string]bool{}
+	for _, name := range flow[1:] {
+		command := Name(name)
+		if command == "" || reserved[command] || seen[command] {
+			continue
+		}
+		seen[command] = true
+		result = append(result, Command{Command: command, Template: name})
+		if len(result) == MaxCommands {
+			break
+		}
+	}
+	return result
+}
+
+// Find возвращает шаблон, который открывает команда, или пустую строку.
+func Find(flow []string, command string) string {
+	for _, c := range Build(flow) {
+		if c.Command == command {
+			return c.Template
+		}
+	}
+	return ""
+}
+
+// Name переводит имя шаблона в имя команды: латиница в нижнем регистре,
+// цифры и подчёркивания, не длиннее 32 символов. Кириллица
+// транслитерируется. Пустая строка — из имени команду не получить.
+func Name(template string) string {
+	var b strings.Builder
+	underscore := false
+	for _, r := range strings.ToLower(template) {
+		var part string
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			part = string(r)
+		case translit[r] != "":
+			part = translit[r]
+		case r == 'ъ' || r == 'ь':
+			continue
+		default:
+			// Пробелы, знаки и прочие символы становятся одним подчёркиванием
+			if b.Len() > 0 && !underscore {
+				b.WriteByte('_')
+				underscore = true
+			}
+			continue
+		}
+		b.WriteString(part)
+		underscore = false
+	}
+
+	name := strings.Trim(b.String(), "_")
+	if len(name) > maxCommandLength {
+		name = strings.TrimRight(name[:maxCommandLength], "_")
+	}
+	return name
+}
+
+var translit = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e",
+	'ж': "zh", 'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m",
+	'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u",
+	'ф': "f", 'х': "h", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "sch", 'ы': "y",
+	'э': "e", 'ю': "yu", 'я': "ya", 'і': "i", 'ї': "yi", 'є': "ye", 'ґ': "g",
+}
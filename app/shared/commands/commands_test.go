@@ -0,0 +1,163 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestName(t *testing.T) {
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{template: "help", want: "help"},
+		{template: "Help Me", want: "help_me"},
+		{template: "Каталог", want: "katalog"},
+		{template: "Шаг 2: оплата", want: "shag_2_oplata"},
+		{template: "Объявление", want: "obyavlenie"},
+		{template: "Щука, ёж и Юля", want: "schuka_ezh_i_yulya"},
+		{template: "  --FAQ--  ", want: "faq"},
+		{template: "a   b", want: "a_b"},
+		{template: "🎁 Подарки", want: "podarki"},
+		{template: "!!!", want: ""},
+		{template: "", want: ""},
+		{template: strings.Repeat("ab", 20), want: strings.Repeat("ab", 16)},
+		// Обрезка до 32 символов не оставляет подчёркивание в конце
+		{template: strings.Repeat("a", 31) + " b", want: strings.Repeat("a", 31)},
+		// Транслитерация удлиняет имя, обрезаются байты, а не руны
+		{template: strings.Repeat("щ", 11), want: strings.Repeat("sch", 10) + "sc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			got := Name(tt.template)
+			if got != tt.want {
+				t.Errorf("Name(%q) = %q, want %q", tt.template, got, tt.want)
+			}
+			if len(got) > maxCommandLength {
+				t.Errorf("Name(%q) is %d bytes long", tt.template, len(got))
+			}
+		})
+	}
+}
+
+func TestBuild(t *testing.T) {
+	tests := []struct {
+		name string
+		flow []string
+		want string
+	}{
+		{name: "empty flow", flow: nil, want: ""},
+		{name: "start only", flow: []string{"Главная"}, want: "start=Главная"},
+		{
+			name: "commands after start",
+			flow: []string{"Главная", "Каталог", "Помощь"},
+			want: "start=Главная katalog=Каталог pomosch=Помощь",
+		},
+		{
+			name: "reserved names are skipped",
+			flow: []string{"Главная", "Start", "auth", "Контакты"},
+			want: "start=Главная kontakty=Контакты",
+		},
+		{
+			name: "first template wins a command",
+			flow: []string{"Главная", "FAQ", "faq!", "Каталог"},
+			want: "start=Главная faq=FAQ katalog=Каталог",
+		},
+		{
+			name: "names without a command are skipped",
+			flow: []string{"Главная", "???", "Каталог"},
+			want: "start=Главная katalog=Каталог",
+		},
+		{
+			name: "start template may repeat later",
+			flow: []string{"Главная", "Главная"},
+			want: "start=Главная glavnaya=Главная",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var parts []string
+			for _, c := range Build(tt.flow) {
+				parts = append(parts, c.Command+"="+c.Template)
+			}
+			if got := strings.Join(parts, " "); got != tt.want {
+				t.Errorf("Build(%q) = %q, want %q", tt.flow, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildLimit(t *testing.T) {
+	flow := []string{"Главная"}
+	for i := 0; i < MaxCommands+10; i++ {
+		flow = append(flow, fmt.Sprintf("step %d", i))
+	}
+	got := Build(flow)
+	if len(got) != MaxCommands {
+		t.Fatalf("Build() returned %d commands, want %d", len(got), MaxCommands)
+	}
+	if last := got[len(got)-1]; last.Command != fmt.Sprintf("step_%d", MaxCommands-2) {
+		t.Errorf("last command = %q", last.Command)
+	}
+}
+
+func TestFind(t *testing.T) {
+	flow := []string{"Главная", "Каталог", "FAQ"}
+	tests := []struct {
+		command string
+		want    string
+	}{
+		{command: "start", want: "Главная"},
+		{command: "katalog", want: "Каталог"},
+		{command: "faq", want: "FAQ"},
+		{command: "help", want: ""},
+	}
+	for _, tt := range tests {
+		if got := Find(flow, tt.command); got != tt.want {
+			t.Errorf("Find(%q) = %q, want %q", tt.command, got, tt.want)
+		}
+	}
+}
+
+func TestPrefer(t *testing.T) {
+	tests := []struct {
+		name      string
+		candidate Template
+		chosen    Template
+		want      bool
+	}{
+		{name: "first active", candidate: Template{ID: 5, Active: true}, want: true},
+		{name: "first inactive", candidate: Template{ID: 5}, want: false},
+		{name: "lower active id", candidate: Template{ID: 3, Active: true}, chosen: Template{ID: 5, Active: true}, want: true},
+		{name: "higher active id", candidate: Template{ID: 7, Active: true}, chosen: Template{ID: 5, Active: true}, want: false},
+		{name: "inactive never wins", candidate: Template{ID: 1}, chosen: Template{ID: 5, Active: true}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Prefer(tt.candidate, tt.chosen); got != tt.want {
+				t.Errorf("Prefer(%+v, %+v) = %v, want %v", tt.candidate, tt.chosen, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDescription(t *testing.T) {
+	long := strings.Repeat("я", maxDescriptionLength+5)
+	tests := []struct {
+		template string
+		want     int
+	}{
+		{template: "Каталог", want: 7},
+		{template: long, want: maxDescriptionLength},
+	}
+	for _, tt := range tests {
+		got := Command{Command: "x", Template: tt.template}.Description()
+		if n := utf8.RuneCountInString(got); n != tt.want || !utf8.ValidString(got) {
+			t.Errorf("Description() has %d runes, want %d", n, tt.want)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package content
+
+import (
+	"encoding/json"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Типы медиа, которые можно прикрепить к шаблону.
+const (
+	MediaPhoto     = "photo"
+	MediaVideo     = "video"
+	MediaDocument  = "document"
+	MediaAnimation = "animation"
+)
+
+// Content — содержимое шаблона: текст (или подпись к медиа) в выбранном
+// режиме разметки и необязательное медиа.
+type Content struct {
+	Text        string
+	ParseMode   string
+	MediaType   string
+	MediaFileID string
+
+	// FileName и MimeType нужны, чтобы сохранить медиа в медиатеку
+	FileName string
+	MimeType string
+}
+
+// FromMessage сохраняет сообщение владельца вместе с форматированием.
+// Сущности переводятся в HTML, текст без сущностей хранится как есть.
+// Кастомные эмодзи сохраняет только FromRawMessage.
+func FromMessage(msg *tgbotapi.Message) Content {
+	return fromMessage(msg, wrapEntities(msg.Entities), wrapEntities(msg.CaptionEntities))
+}
+
+// FromRawMessage — FromMessage, которая берёт сущности из исходного JSON
+// сообщения raw, чтобы сохранить кастомные эмодзи.
+func FromRawMessage(msg *tgbotapi.Message, raw json.RawMessage) Content {
+	var parsed struct {
+		Entities        []Entity `json:"entities"`
+		CaptionEntities []Entity `json:"caption_entities"`
+	}
+	if len(raw) == 0 || json.Unmarshal(raw, &parsed) != nil {
+		return FromMessage(msg)
+	}
+	return fromMessage(msg, parsed.Entities, parsed.CaptionEntities)
+}
+
+func wrapEntities(entities []tgbotapi.MessageEntity) []Entity {
+	wrapped := make([]Entity, len(entities))
+	for i, e := range entities {
+		wrapped[i] = Entity{MessageEntity: e}
+	}
+	return wrapped
+}
+
+func fromMessage(msg *tgbotapi.Message, textEntities, captionEntities []Entity) Content {
+	var c Content
+	text, entities := msg.Text, textEntities
+
+	switch {
+	case msg.Animation != nil:
+		c.MediaType, c.MediaFileID = MediaAnimation, msg.Animation.FileID
+		c.FileName, c.MimeType = msg.Animation.FileName, msg.Animation.MimeType
+	case len(msg.Photo) > 0:
+		// Последний размер — самый большой.
+		c.MediaType, c.MediaFileID = MediaPhoto, msg.Photo[len(msg.Photo)-1].FileID
+		c.FileName, c.MimeType = "photo.jpg", "image/jpeg"
+	case msg.Video != nil:
+		c.MediaType, c.MediaFileID = MediaVideo, msg.Video.FileID
+		c.FileName, c.MimeType = msg.Video.FileName, msg.Video.MimeType
+	case msg.Document != nil:
+		c.MediaType, c.MediaFileID = MediaDocument, msg.Document.FileID
+		c.FileName, c.MimeType = msg.Document.FileName, msg.Document.MimeType
+	}
+	if c.MediaType != "" {
+		text, entities = msg.Caption, captionEntities
+	}
+
+	if len(entities) > 0 {
+		c.Text = EntitiesToHTML(text, entities)
+		c.ParseMode = tgbotapi.ModeHTML
+	} else {
+		c.Text = text
+	}
+	return c
+}
+
+// Empty сообщает, что в сообщении не было ни текста, ни поддерживаемого медиа.
+func (c Content) Empty() bool {
+	return c.Text == "" && c.MediaType == ""
+}
+
+// MediaMethod возвращает метод Bot API и имя параметра для отправки медиа.
+func MediaMethod(mediaType string) (method, field string, ok bool) {
+	switch mediaType {
+	case MediaPhoto:
+		return "sendPhoto", "photo", true
+	case MediaVideo:
+		return "sendVideo", "video", true
+	case MediaDocument:
+		return "sendDocument", "document", true
+	case MediaAnimation:
+		return "sendAnimation", "animation", true
+	}
+	return "", "", false
+}
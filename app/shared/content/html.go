@@ -0,0 +1,157 @@
+package content
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"sort"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Entity — сущность сообщения Telegram. tgbotapi v5.5.1 не знает поля
+// custom_emoji_id, поэтому сущности с ним читаются из исходного JSON
+// сообщения (см. FromRawMessage).
+type Entity struct {
+	tgbotapi.MessageEntity
+	CustomEmojiID string `json:"custom_emoji_id,omitempty"`
+}
+
+func (e Entity) end() int {
+	return e.Offset + e.Length
+}
+
+// EntitiesToHTML переводит текст с сущностями Telegram в HTML для
+// parse_mode=HTML. Смещения сущностей считаются в единицах UTF-16.
+// Автоматические сущности (ссылки, упоминания, хэштеги) Telegram
+// распознаёт сам, поэтому они остаются обычным текстом. Кастомный эмодзи
+// без идентификатора сохраняется своим обычным эмодзи.
+//
+// Сущности могут пересекаться частично (жирный 0–5, курсив 3–8), а теги
+// HTML — только вкладываться. Поэтому, когда закрывается сущность, открытые
+// внутри неё теги закрываются и сразу открываются снова.
+func EntitiesToHTML(text string, entities []Entity) string {
+	sorted := append([]Entity(nil), entities...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Offset == sorted[j].Offset {
+			return sorted[i].Length > sorted[j].Length
+		}
+		return sorted[i].Offset < sorted[j].Offset
+	})
+
+	var (
+		sb   strings.Builder
+		open []Entity
+		next int
+		pos  int
+	)
+	closeEnded := func(pos int) {
+		first := -1
+		for i, e := range open {
+			if e.end() <= pos {
+				first = i
+				break
+			}
+		}
+		if first < 0 {
+			return
+		}
+		for i := len(open) - 1; i >= first; i-- {
+			sb.WriteString(closeTag(open[i]))
+		}
+		inner := open[first:]
+		open = open[:first]
+		for _, e := range inner {
+			if e.end() > pos {
+				sb.WriteString(openTag(e))
+				open = append(open, e)
+			}
+		}
+	}
+
+	for _, r := range text {
+		closeEnded(pos)
+		for next < len(sorted) && sorted[next].Offset <= pos {
+			e := sorted[next]
+			next++
+			if tag := openTag(e); tag != "" && e.Length > 0 {
+				sb.WriteString(tag)
+				open = append(open, e)
+			}
+		}
+		sb.WriteString(html.EscapeString(string(r)))
+		if r >= 0x10000 {
+			pos += 2
+		} else {
+			pos++
+		}
+	}
+	closeEnded(math.MaxInt)
+
+	return sb.String()
+}
+
+func openTag(e Entity) string {
+	switch e.Type {
+	case "bold":
+		return "<b>"
+	case "italic":
+		return "<i>"
+	case "underline":
+		return "<u>"
+	case "strikethrough":
+		return "<s>"
+	case "spoiler":
+		return "<tg-spoiler>"
+	case "code":
+		return "<code>"
+	case "pre":
+		if e.Language != "" {
+			return fmt.Sprintf(`<pre><code class="language-%s">`, html.EscapeString(e.Language))
+		}
+		return "<pre>"
+	case "blockquote":
+		return "<blockquote>"
+	case "text_link":
+		return fmt.Sprintf(`<a href="%s">`, html.EscapeString(e.URL))
+	case "text_mention":
+		if e.User != nil {
+			return fmt.Sprintf(`<a href="tg://user?id=%d">`, e.User.ID)
+		}
+	case "custom_emoji":
+		if e.CustomEmojiID != "" {
+			return fmt.Sprintf(`<tg-emoji emoji-id="%s">`, html.EscapeString(e.CustomEmojiID))
+		}
+	}
+	return ""
+}
+
+func closeTag(e Entity) string {
+	switch e.Type {
+	case "bold":
+		return "</b>"
+	case "italic":
+		return "</i>"
+	case "underline":
+		return "</u>"
+	case "strikethrough":
+		return "</s>"
+	case "spoiler":
+		return "</tg-spoiler>"
+	case "code":
+		return "</code>"
+	case "pre":
+		if e.Language != "" {
+			return "</code></pre>"
+		}
+		return "</pre>"
+	case "blockquote":
+		return "</blockquote>"
+	case "text_link", "text_mention":
+		return "</a>"
+	case "custom_emoji":
+		return "</tg-emoji>"
+	}
+	return ""
+}
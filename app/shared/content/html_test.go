@@ -0,0 +1,122 @@
+package content
+
+import (
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func entity(typ string, offset, length int) Entity {
+	return Entity{MessageEntity: tgbotapi.MessageEntity{Type: typ, Offset: offset, Length: length}}
+}
+
+func TestEntitiesToHTML(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		entities []Entity
+		want     string
+	}{
+		{name: "plain text is escaped", text: `a < b & "c"`, want: "a &lt; b &amp; &#34;c&#34;"},
+		{name: "single entity", text: "hello world", entities: []Entity{entity("bold", 0, 5)}, want: "<b>hello</b> world"},
+		{name: "entity at the end", text: "hello world", entities: []Entity{entity("italic", 6, 5)}, want: "hello <i>world</i>"},
+		{
+			name:     "nested",
+			text:     "hello world",
+			entities: []Entity{entity("bold", 0, 11), entity("italic", 6, 5)},
+			want:     "<b>hello <i>world</i></b>",
+		},
+		{
+			name:     "same range, longer first",
+			text:     "hello",
+			entities: []Entity{entity("italic", 0, 3), entity("bold", 0, 5)},
+			want:     "<b><i>hel</i>lo</b>",
+		},
+		{
+			name:     "partial overlap reopens inner tag",
+			text:     "abcdefgh",
+			entities: []Entity{entity("bold", 0, 5), entity("italic", 3, 5)},
+			want:     "<b>abc<i>de</i></b><i>fgh</i>",
+		},
+		{
+			name:     "offsets in UTF-16 after emoji",
+			text:     "😀 hi",
+			entities: []Entity{entity("bold", 3, 2)},
+			want:     "😀 <b>hi</b>",
+		},
+		{
+			name:     "emoji inside entity",
+			text:     "a😀b",
+			entities: []Entity{entity("underline", 1, 2)},
+			want:     "a<u>😀</u>b",
+		},
+		{
+			name:     "cyrillic counts as one unit",
+			text:     "привет мир",
+			entities: []Entity{entity("strikethrough", 7, 3)},
+			want:     "привет <s>мир</s>",
+		},
+		{
+			name:     "automatic entities stay text",
+			text:     "see https://example.com #tag",
+			entities: []Entity{entity("url", 4, 19), entity("hashtag", 24, 4)},
+			want:     "see https://example.com #tag",
+		},
+		{
+			name: "text link escapes url",
+			text: "link",
+			entities: []Entity{{MessageEntity: tgbotapi.MessageEntity{
+				Type: "text_link", Offset: 0, Length: 4, URL: `https://example.com/?a=1&b="2"`,
+			}}},
+			want: `<a href="https://example.com/?a=1&amp;b=&#34;2&#34;">link</a>`,
+		},
+		{
+			name: "text mention",
+			text: "Иван",
+			entities: []Entity{{MessageEntity: tgbotapi.MessageEntity{
+				Type: "text_mention", Offset: 0, Length: 4, User: &tgbotapi.User{ID: 42},
+			}}},
+			want: `<a href="tg://user?id=42">Иван</a>`,
+		},
+		{
+			name: "pre with language",
+			text: "x := 1",
+			entities: []Entity{{MessageEntity: tgbotapi.MessageEntity{
+				Type: "pre", Offset: 0, Length: 6, Language: "go",
+			}}},
+			want: `<pre><code class="language-go">x := 1</code></pre>`,
+		},
+		{
+			name:     "custom emoji",
+			text:     "👍 ok",
+			entities: []Entity{{MessageEntity: tgbotapi.MessageEntity{Type: "custom_emoji", Offset: 0, Length: 2}, CustomEmojiID: "5368324170671202286"}},
+			want:     `<tg-emoji emoji-id="5368324170671202286">👍</tg-emoji> ok`,
+		},
+		{
+			name:     "custom emoji without id",
+			text:     "👍 ok",
+			entities: []Entity{entity("custom_emoji", 0, 2)},
+			want:     "👍 ok",
+		},
+		{
+			name:     "zero length entity is skipped",
+			text:     "abc",
+			entities: []Entity{entity("bold", 1, 0)},
+			want:     "abc",
+		},
+		{
+			name:     "entity past the end is closed",
+			text:     "abc",
+			entities: []Entity{entity("bold", 1, 10)},
+			want:     "a<b>bc</b>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EntitiesToHTML(tt.text, tt.entities); got != tt.want {
+				t.Errorf("EntitiesToHTML() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package content
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	// В образах alpine нет базы часовых поясов
+	_ "time/tzdata"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Vars — значения переменных шаблона.
+type Vars map[string]string
+
+// ChatVarPrefix отмечает переменные чата: ответ пользователя в шаблоне
+// name доступен как {{var.name}}.
+const ChatVarPrefix = "var."
+
+// StandardVars — переменные, которые worker-bot заполняет сам.
+var StandardVars = []string{
+	"first_name", "last_name", "full_name", "username", "user_id",
+	"bot_username", "bot_name",
+	"date", "time", "datetime", "weekday",
+}
+
+// placeholderRe находит {{name}} и {{name|значение по умолчанию}}.
+var placeholderRe = regexp.MustCompile(`\{\{\s*([^{}|]+?)\s*(?:\|([^{}]*))?\}\}`)
+
+type Placeholder struct {
+	Name    string
+	Default string
+}
+
+// Placeholders возвращает переменные, использованные в тексте.
+func Placeholders(text string) []Placeholder {
+	var result []Placeholder
+	for _, m := range placeholderRe.FindAllStringSubmatch(text, -1) {
+		result = append(result, Placeholder{Name: m[1], Default: m[2]})
+	}
+	return result
+}
+
+// CheckPlaceholders проверяет, что все переменные известны и скобки
+// закрыты. Ошибки адресованы владельцу шаблона.
+func CheckPlaceholders(text string) error {
+	rest := placeholderRe.ReplaceAllString(text, "")
+	if strings.Contains(rest, "{{") || strings.Contains(rest, "}}") {
+		return errors.New("незакрытая или пустая переменная: используйте {{имя}} или {{имя|значение по умолчанию}}")
+	}
+
+	known := make(map[string]bool, len(StandardVars))
+	for _, name := range StandardVars {
+		known[name] = true
+	}
+
+	var unknown []string
+	for _, p := range Placeholders(text) {
+		if known[p.Name] || (strings.HasPrefix(p.Name, ChatVarPrefix) && len(p.Name) > len(ChatVarPrefix)) {
+			continue
+		}
+		unknown = append(unknown, "{{"+p.Name+"}}")
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("неизвестные переменные: %s. Доступны: {{%s}} и {{%sимя шаблона}}",
+			strings.Join(unknown, ", "), strings.Join(StandardVars, "}}, {{"), ChatVarPrefix)
+	}
+	return nil
+}
+
+// Render подставляет значения переменных. Значения экранируются для
+// parseMode, значения по умолчанию уже записаны в разметке шаблона и
+// вставляются как есть. Неизвестная переменная без значения по умолчанию
+// заменяется пустой строкой.
+func Render(text, parseMode string, vars Vars) string {
+	return placeholderRe.ReplaceAllStringFunc(text, func(match string) string {
+		m := placeholderRe.FindStringSubmatch(match)
+		if value := vars[m[1]]; value != "" {
+			return Escape(value, parseMode)
+		}
+		return m[2]
+	})
+}
+
+// Escape экранирует значение для режима разметки Bot API.
+func Escape(value, parseMode string) string {
+	switch parseMode {
+	case tgbotapi.ModeHTML:
+		return html.EscapeString(value)
+	case tgbotapi.ModeMarkdownV2:
+		return markdownV2Replacer.Replace(value)
+	case tgbotapi.ModeMarkdown:
+		return markdownReplacer.Replace(value)
+	}
+	return value
+}
+
+var markdownV2Replacer = strings.NewReplacer(
+	`\`, `\\`, "_", `\_`, "*", `\*`, "[", `\[`, "]", `\]`, "(", `\(`, ")", `\)`,
+	"~", `\~`, "`", "\\`", ">", `\>`, "#", `\#`, "+", `\+`, "-", `\-`,
+	"=", `\=`, "|", `\|`, "{", `\{`, "}", `\}`, ".", `\.`, "!", `\!`,
+)
+
+var markdownReplacer = strings.NewReplacer("_", `\_`, "*", `\*`, "`", "\\`", "[", `\[`)
+
+// UserVars заполняет переменные пользователя.
+func UserVars(vars Vars, user *tgbotapi.User) {
+	if user == nil {
+		return
+	}
+	vars["first_name"] = user.FirstName
+	vars["last_name"] = user.LastName
+	vars["full_name"] = strings.TrimSpace(user.FirstName + " " + user.LastName)
+	vars["username"] = user.UserName
+	vars["user_id"] = strconv.FormatInt(user.ID, 10)
+}
+
+// BotVars заполняет переменные бота.
+func BotVars(vars Vars, bot *tgbotapi.User) {
+	if bot == nil {
+		return
+	}
+	vars["bot_username"] = bot.UserName
+	vars["bot_name"] = bot.FirstName
+}
+
+// DefaultZone — часовой пояс по умолчанию: системный пояс контейнеров —
+// UTC, а владельцы ботов ждут московское время.
+const DefaultZone = "Europe/Moscow"
+
+// ZoneFromEnv возвращает часовой пояс из TIMEZONE. По нему admin-bot
+// планирует публикации, а admin-bot и воркер подставляют дату и время в
+// шаблоны. Для неизвестного пояса вместе с ошибкой возвращается UTC.
+func ZoneFromEnv() (*time.Location, error) {
+	name := os.Getenv("TIMEZONE")
+	if name == "" {
+		name = DefaultZone
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.UTC, fmt.Errorf("unknown TIMEZONE %q: %w", name, err)
+	}
+	return loc, nil
+}
+
+var weekdays = [...]string{"воскресенье", "понедельник", "вторник", "среда", "четверг", "пятница", "суббота"}
+
+// DateVars заполняет переменные даты и времени. now должен быть уже в
+// поясе ZoneFromEnv.
+func DateVars(vars Vars, now time.Time) {
+	vars["date"] = now.Format("02.01.2006")
+	vars["time"] = now.Format("15:04")
+	vars["datetime"] = now.Format("02.01.2006 15:04")
+	vars["weekday"] = weekdays[now.Weekday()]
+}
+
+// ChatVars добавляет переменные, собранные в диалоге.
+func ChatVars(vars Vars, answers map[string]string) {
+	for name, value := range answers {
+		vars[ChatVarPrefix+name] = value
+	}
+}
@@ -0,0 +1,121 @@
+package content
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestRender(t *testing.T) {
+	vars := Vars{
+		"first_name": "Иван",
+		"username":   "a_b*c",
+		"full_name":  "<Иван>",
+		"var.город":  "Москва",
+	}
+
+	tests := []struct {
+		name      string
+		text      string
+		parseMode string
+		want      string
+	}{
+		{name: "plain", text: "Привет, {{first_name}}!", want: "Привет, Иван!"},
+		{name: "spaces inside braces", text: "{{ first_name }}", want: "Иван"},
+		{name: "chat variable", text: "Город: {{var.город}}", want: "Город: Москва"},
+		{name: "default for empty value", text: "{{last_name|без фамилии}}", want: "без фамилии"},
+		{name: "default ignored when set", text: "{{first_name|друг}}", want: "Иван"},
+		{name: "unknown without default", text: "[{{last_name}}]", want: "[]"},
+		{name: "html escapes value", text: "<b>{{full_name}}</b>", parseMode: tgbotapi.ModeHTML, want: "<b>&lt;Иван&gt;</b>"},
+		{name: "html keeps default markup", text: "{{last_name|<i>нет</i>}}", parseMode: tgbotapi.ModeHTML, want: "<i>нет</i>"},
+		{name: "markdown v2 escapes value", text: "*{{username}}*", parseMode: tgbotapi.ModeMarkdownV2, want: `*a\_b\*c*`},
+		{name: "markdown escapes value", text: "{{username}}", parseMode: tgbotapi.ModeMarkdown, want: `a\_b\*c`},
+		{name: "no parse mode keeps value", text: "{{full_name}}", want: "<Иван>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Render(tt.text, tt.parseMode, vars); got != tt.want {
+				t.Errorf("Render(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckPlaceholders(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		wantErr string
+	}{
+		{name: "no variables", text: "Привет"},
+		{name: "standard variables", text: "{{first_name}} {{date}} {{weekday|сегодня}}"},
+		{name: "chat variable", text: "{{var.имя}}"},
+		{name: "bare chat prefix", text: "{{var.}}", wantErr: "неизвестные переменные: {{var.}}"},
+		{name: "unknown", text: "{{first_name}} {{age}} {{city}}", wantErr: "неизвестные переменные: {{age}}, {{city}}"},
+		{name: "unclosed", text: "Привет, {{first_name", wantErr: "незакрытая"},
+		{name: "stray closing", text: "Привет}}", wantErr: "незакрытая"},
+		{name: "empty", text: "{{}}", wantErr: "незакрытая"},
+		{name: "nested braces", text: "{{first_{{name}}}}", wantErr: "незакрытая"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckPlaceholders(tt.text)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("CheckPlaceholders(%q) error = %v", tt.text, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("CheckPlaceholders(%q) error = %v, want containing %q", tt.text, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDateVars(t *testing.T) {
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 22:30 UTC в воскресенье — уже понедельник в Москве
+	now := time.Date(2025, 3, 16, 22, 30, 0, 0, time.UTC).In(moscow)
+
+	vars := Vars{}
+	DateVars(vars, now)
+	want := Vars{"date": "17.03.2025", "time": "01:30", "datetime": "17.03.2025 01:30", "weekday": "понедельник"}
+	for name, value := range want {
+		if vars[name] != value {
+			t.Errorf("%s = %q, want %q", name, vars[name], value)
+		}
+	}
+}
+
+func TestZoneFromEnv(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{value: "", want: DefaultZone},
+		{value: "Asia/Yekaterinburg", want: "Asia/Yekaterinburg"},
+		{value: "Mars/Olympus", want: "UTC", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv("TIMEZONE", tt.value)
+			loc, err := ZoneFromEnv()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ZoneFromEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if loc.String() != tt.want {
+				t.Errorf("ZoneFromEnv() = %s, want %s", loc, tt.want)
+			}
+		})
+	}
+}
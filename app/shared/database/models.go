@@ -30,6 +30,13 @@ type BotTemplate struct {
 	IsActive  bool            `gorm:"default:true"`
 	CreatedAt time.Time
 	UpdatedAt time.Time
+
+	// ParseMode — режим разметки Content: пусто или HTML
+	ParseMode   string `gorm:"size:16"`
+	MediaType   string `gorm:"size:16"`
+	MediaFileID string `gorm:"type:text"`
+	// MediaID — файл медиатеки, MediaFileID остаётся для старых шаблонов
+	MediaID *uint `gorm:"index"`
 }
 
 type BotAccess struct {
@@ -46,6 +53,7 @@ type User struct {
 	Username    string `gorm:"size:255"`
 	Phone       string `gorm:"size:20;unique"`
 	Role        string `gorm:"size:10;not null;check:role IN ('admin', 'owner', 'client')"`
+	Plan        string `gorm:"size:20;not null;default:free"`
 	IsActive    bool   `gorm:"default:true"`
 	SessionData []byte `gorm:"type:bytea"`
 	LastActive  time.Time
@@ -67,6 +75,40 @@ func (ChatState) TableName() string {
 	return "chat_states"
 }
 
+const (
+	OutboxPending = "pending"
+	OutboxSent    = "sent"
+	OutboxFailed  = "failed"
+)
+
+// Виды ошибок, с которыми сообщение outbox не доставлено.
+const (
+	OutboxErrorBlocked      = "blocked"
+	OutboxErrorChatNotFound = "chat_not_found"
+	OutboxErrorPermanent    = "permanent"
+	OutboxErrorRetries      = "retries"
+)
+
+type OutboxMessage struct {
+	ID              uint           `gorm:"primaryKey"`
+	BotID           int64          `gorm:"index"`
+	ChatID          int64          `gorm:"index"`
+	Method          string         `gorm:"size:64"`
+	Params          datatypes.JSON `gorm:"type:jsonb"`
+	Status          string         `gorm:"size:16;default:pending"`
+	Attempts        int            `gorm:"default:0"`
+	LastError       string         `gorm:"type:text"`
+	ErrorKind       string         `gorm:"size:16;not null;default:''"`
+	NextAttemptAt   time.Time
+	SentAt          *time.Time
+	OwnerNotifiedAt *time.Time
+	CreatedAt       time.Time
+}
+
+func (OutboxMessage) TableName() string {
+	return "outbox_messages"
+}
+
 func (b *Bot) BeforeCreate(tx *gorm.DB) error {
 	now := time.Now()
 	b.CreatedAt = now
@@ -78,3 +120,62 @@ func (b *Bot) BeforeUpdate(tx *gorm.DB) error {
 	b.UpdatedAt = time.Now()
 	return nil
 }
+
+const (
+	DeadLetterNew       = "new"
+	DeadLetterReplay    = "replay"
+	DeadLetterReplaying = "replaying"
+	DeadLetterReplayed  = "replayed"
+	DeadLetterDiscarded = "discarded"
+)
+
+// DeadLetter хранит обновление, которое не удалось обработать, вместе
+// с ошибкой и этапом обработки, на котором она произошла.
+type DeadLetter struct {
+	ID         uint           `gorm:"primaryKey"`
+	BotID      int64          `gorm:"index"`
+	UpdateID   int64          `gorm:"index"`
+	Payload    datatypes.JSON `gorm:"type:jsonb"`
+	RawPayload string         `gorm:"type:text"`
+	Stage      string         `gorm:"size:32"`
+	Error      string         `gorm:"type:text"`
+	Status     string         `gorm:"size:16;default:new"`
+	Attempts   int            `gorm:"default:1"`
+	CreatedAt  time.Time
+	ResolvedAt *time.Time
+	ClaimedAt  *time.Time
+}
+
+func (DeadLetter) TableName() string {
+	return "dead_letters"
+}
+
+// MediaFile — файл медиатеки. Содержимое хранится один раз под ключом
+// StorageKey (sha256), строки ведутся для каждого владельца.
+type MediaFile struct {
+	ID         uint   `gorm:"primaryKey"`
+	OwnerID    int64  `gorm:"index"`
+	Kind       string `gorm:"size:16"`
+	FileName   string `gorm:"size:255"`
+	MimeType   string `gorm:"size:127"`
+	Size       int64
+	StorageKey string `gorm:"size:64"`
+	CreatedAt  time.Time
+}
+
+func (MediaFile) TableName() string {
+	return "media_files"
+}
+
+// MediaBotFile — file_id, под которым бот уже загрузил файл медиатеки.
+// file_id одного бота недействителен для другого.
+type MediaBotFile struct {
+	MediaID   uint   `gorm:"primaryKey"`
+	BotID     int64  `gorm:"primaryKey"`
+	FileID    string `gorm:"type:text"`
+	CreatedAt time.Time
+}
+
+func (MediaBotFile) TableName() string {
+	return "media_bot_files"
+}
@@ -3,6 +3,7 @@ module practis/shared
 go 1.24.4
 
 require (
+	github.com/go-telegram-bot-api/telegram-bot-api/v5 v5.5.1
 	github.com/gotd/td v0.126.0
 	github.com/redis/go-redis/v9 v9.11.0
 	gorm.io/datatypes v1.2.6
@@ -0,0 +1,339 @@
+package keyboard
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Version — текущая версия схемы клавиатуры в bot_templates.keyboard.
+// Версия 1 — прежний формат [][]string, который читается как reply-клавиатура.
+const Version = 2
+
+type Type string
+
+const (
+	TypeReply  Type = "reply"
+	TypeInline Type = "inline"
+)
+
+type ButtonType string
+
+const (
+	ButtonText         ButtonType = "text"
+	ButtonURL          ButtonType = "url"
+	ButtonCallback     ButtonType = "callback"
+	ButtonSwitchInline ButtonType = "switch_inline"
+	ButtonWebApp       ButtonType = "web_app"
+)
+
+const (
+	maxRows          = 100
+	maxButtonsPerRow = 8
+	maxButtonText    = 64
+	maxPlaceholder   = 64
+)
+
+type Keyboard struct {
+	Version     int        `json:"version"`
+	Type        Type       `json:"type"`
+	Rows        [][]Button `json:"rows"`
+	Resize      bool       `json:"resize,omitempty"`
+	OneTime     bool       `json:"one_time,omitempty"`
+	Placeholder string     `json:"placeholder,omitempty"`
+}
+
+type Button struct {
+	// ID не меняется при перестановке кнопок: по нему callback из уже
+	// отправленных сообщений находит свою кнопку. Назначается при сохранении
+	ID   string     `json:"id,omitempty"`
+	Type ButtonType `json:"type"`
+	Text string     `json:"text"`
+	// URL используется кнопками url и web_app
+	URL string `json:"url,omitempty"`
+	// Node — имя шаблона, к которому переходит кнопка callback или text
+	Node string `json:"node,omitempty"`
+	// Query и CurrentChat используются кнопкой switch_inline
+	Query       string `json:"query,omitempty"`
+	CurrentChat bool   `json:"current_chat,omitempty"`
+}
+
+// Parse читает клавиатуру из bot_templates.keyboard. Пустое значение
+// означает отсутствие клавиатуры, массив строк — прежний формат.
+func Parse(raw []byte) (*Keyboard, error) {
+	trimmed := strings.TrimSpace(string(raw))
+	if trimmed == "" || trimmed == "null" {
+		return nil, nil
+	}
+
+	if strings.HasPrefix(trimmed, "[") {
+		var legacy [][]string
+		if err := json.Unmarshal([]byte(trimmed), &legacy); err != nil {
+			return nil, fmt.Errorf("invalid legacy keyboard: %w", err)
+		}
+		return FromLegacy(legacy), nil
+	}
+
+	var kb Keyboard
+	if err := json.Unmarshal([]byte(trimmed), &kb); err != nil {
+		return nil, fmt.Errorf("invalid keyboard: %w", err)
+	}
+	if kb.Version == 0 {
+		kb.Version = Version
+	}
+	if kb.Version > Version {
+		return nil, fmt.Errorf("unsupported keyboard version %d", kb.Version)
+	}
+	return &kb, nil
+}
+
+// FromLegacy переводит клавиатуру формата [][]string в текущую схему.
+func FromLegacy(rows [][]string) *Keyboard {
+	kb := &Keyboard{Version: Version, Type: TypeReply, Resize: true}
+	for _, row := range rows {
+		buttons := make([]Button, 0, len(row))
+		for _, text := range row {
+			buttons = append(buttons, Button{Type: ButtonText, Text: text})
+		}
+		kb.Rows = append(kb.Rows, buttons)
+	}
+	return kb
+}
+
+func (k *Keyboard) Marshal() ([]byte, error) {
+	k.Version = Version
+	k.assignIDs()
+	return json.Marshal(k)
+}
+
+// assignIDs назначает ID callback-кнопкам, у которых его нет или он
+// повторяется, например после импорта.
+func (k *Keyboard) assignIDs() {
+	seen := make(map[string]bool)
+	for i := range k.Rows {
+		for j := range k.Rows[i] {
+			b := &k.Rows[i][j]
+			if b.Type != ButtonCallback {
+				continue
+			}
+			for b.ID == "" || seen[b.ID] {
+				b.ID = newButtonID()
+			}
+			seen[b.ID] = true
+		}
+	}
+}
+
+func newButtonID() string {
+	id := make([]byte, 4)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// Nodes возвращает имена шаблонов, на которые ссылаются кнопки.
+func (k *Keyboard) Nodes() []string {
+	seen := make(map[string]bool)
+	var nodes []string
+	for _, row := range k.Rows {
+		for _, b := range row {
+			if b.Node != "" && !seen[b.Node] {
+				seen[b.Node] = true
+				nodes = append(nodes, b.Node)
+			}
+		}
+	}
+	return nodes
+}
+
+// ButtonRef — кнопка, на которую ссылается callback: ID кнопки или, у
+// клавиатур, сохранённых до появления ID, её позиция.
+type ButtonRef struct {
+	ID       string
+	Row, Col int
+}
+
+// Find возвращает кнопку по ссылке из callback. Позиция принимается,
+// только пока у клавиатуры нет ID: после пересохранения кнопки могли
+// переставить, и старое сообщение открыло бы чужую кнопку.
+func (k *Keyboard) Find(ref ButtonRef) (Button, bool) {
+	if ref.ID == "" {
+		if k.hasIDs() {
+			return Button{}, false
+		}
+		return k.Button(ref.Row, ref.Col)
+	}
+	for _, row := range k.Rows {
+		for _, b := range row {
+			if b.ID == ref.ID {
+				return b, true
+			}
+		}
+	}
+	return Button{}, false
+}
+
+func (k *Keyboard) hasIDs() bool {
+	for _, row := range k.Rows {
+		for _, b := range row {
+			if b.ID != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Button возвращает кнопку по координатам.
+func (k *Keyboard) Button(row, col int) (Button, bool) {
+	if row < 0 || row >= len(k.Rows) || col < 0 || col >= len(k.Rows[row]) {
+		return Button{}, false
+	}
+	return k.Rows[row][col], true
+}
+
+// FindText ищет кнопку reply-клавиатуры по тексту, присланному пользователем.
+func (k *Keyboard) FindText(text string) (Button, bool) {
+	if k.Type != TypeReply {
+		return Button{}, false
+	}
+	for _, row := range k.Rows {
+		for _, b := range row {
+			if b.Type == ButtonText && b.Text == text {
+				return b, true
+			}
+		}
+	}
+	return Button{}, false
+}
+
+func (k *Keyboard) Validate() error {
+	if k.Type != TypeReply && k.Type != TypeInline {
+		return fmt.Errorf("неизвестный тип клавиатуры %q", k.Type)
+	}
+	if len(k.Rows) == 0 {
+		return errors.New("клавиатура не может быть пустой")
+	}
+	if len(k.Rows) > maxRows {
+		return fmt.Errorf("слишком много строк: %d (максимум %d)", len(k.Rows), maxRows)
+	}
+	if utf8.RuneCountInString(k.Placeholder) > maxPlaceholder {
+		return fmt.Errorf("подсказка длиннее %d символов", maxPlaceholder)
+	}
+	if k.Type == TypeInline && (k.Resize || k.OneTime || k.Placeholder != "") {
+		return errors.New("resize, one_time и placeholder доступны только для reply-клавиатуры")
+	}
+
+	for i, row := range k.Rows {
+		if len(row) == 0 {
+			return fmt.Errorf("строка %d пустая", i+1)
+		}
+		if len(row) > maxButtonsPerRow {
+			return fmt.Errorf("в строке %d больше %d кнопок", i+1, maxButtonsPerRow)
+		}
+		for j, b := range row {
+			if err := k.validateButton(b); err != nil {
+				return fmt.Errorf("кнопка %d в строке %d: %w", j+1, i+1, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (k *Keyboard) validateButton(b Button) error {
+	if strings.TrimSpace(b.Text) == "" {
+		return errors.New("текст кнопки не может быть пустым")
+	}
+	if utf8.RuneCountInString(b.Text) > maxButtonText {
+		return fmt.Errorf("текст кнопки длиннее %d символов", maxButtonText)
+	}
+
+	switch b.Type {
+	case ButtonText:
+		if k.Type != TypeReply {
+			return errors.New("текстовые кнопки доступны только в reply-клавиатуре")
+		}
+	case ButtonURL:
+		if k.Type != TypeInline {
+			return errors.New("URL-кнопки доступны только в inline-клавиатуре")
+		}
+		if err := validateURL(b.URL, false); err != nil {
+			return err
+		}
+	case ButtonCallback:
+		if k.Type != TypeInline {
+			return errors.New("callback-кнопки доступны только в inline-клавиатуре")
+		}
+		if strings.TrimSpace(b.Node) == "" {
+			return errors.New("не указан шаблон для перехода")
+		}
+	case ButtonSwitchInline:
+		if k.Type != TypeInline {
+			return errors.New("switch_inline-кнопки доступны только в inline-клавиатуре")
+		}
+	case ButtonWebApp:
+		if err := validateURL(b.URL, true); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("неизвестный тип кнопки %q", b.Type)
+	}
+	return nil
+}
+
+func validateURL(raw string, httpsOnly bool) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("некорректная ссылка %q", raw)
+	}
+	switch {
+	case u.Scheme == "https":
+	case !httpsOnly && (u.Scheme == "http" || u.Scheme == "tg"):
+	default:
+		if httpsOnly {
+			return fmt.Errorf("ссылка WebApp должна начинаться с https://")
+		}
+		return fmt.Errorf("неподдерживаемая схема ссылки %q", u.Scheme)
+	}
+	return nil
+}
+
+// CallbackData кодирует нажатие кнопки шаблона: btn:<шаблон>:<ID кнопки>.
+// Данные ссылаются на кнопку, а не на шаблон перехода, чтобы уложиться в
+// 64 байта. У кнопки без ID вместо него записывается позиция.
+func CallbackData(templateID int64, b Button, row, col int) string {
+	if b.ID != "" {
+		return fmt.Sprintf("btn:%d:%s", templateID, b.ID)
+	}
+	return fmt.Sprintf("btn:%d:%d:%d", templateID, row, col)
+}
+
+// ParseCallbackData разбирает данные, созданные CallbackData.
+func ParseCallbackData(data string) (templateID int64, ref ButtonRef, ok bool) {
+	parts := strings.Split(data, ":")
+	if len(parts) < 3 || len(parts) > 4 || parts[0] != "btn" {
+		return 0, ButtonRef{}, false
+	}
+	templateID, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, ButtonRef{}, false
+	}
+	if len(parts) == 3 {
+		if parts[2] == "" {
+			return 0, ButtonRef{}, false
+		}
+		return templateID, ButtonRef{ID: parts[2]}, true
+	}
+	if ref.Row, err = strconv.Atoi(parts[2]); err != nil {
+		return 0, ButtonRef{}, false
+	}
+	if ref.Col, err = strconv.Atoi(parts[3]); err != nil {
+		return 0, ButtonRef{}, false
+	}
+	return templateID, ref, true
+}
@@ -0,0 +1,254 @@
+package keyboard
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    *Keyboard
+		wantErr bool
+	}{
+		{name: "empty", raw: "", want: nil},
+		{name: "null", raw: " null ", want: nil},
+		{
+			name: "legacy rows",
+			raw:  `[["Да","Нет"],["Назад"]]`,
+			want: &Keyboard{Version: Version, Type: TypeReply, Resize: true, Rows: [][]Button{
+				{{Type: ButtonText, Text: "Да"}, {Type: ButtonText, Text: "Нет"}},
+				{{Type: ButtonText, Text: "Назад"}},
+			}},
+		},
+		{
+			name: "missing version is current",
+			raw:  `{"type":"inline","rows":[[{"type":"url","text":"Сайт","url":"https://example.com"}]]}`,
+			want: &Keyboard{Version: Version, Type: TypeInline, Rows: [][]Button{
+				{{Type: ButtonURL, Text: "Сайт", URL: "https://example.com"}},
+			}},
+		},
+		{name: "newer version", raw: `{"version":3,"type":"reply","rows":[]}`, wantErr: true},
+		{name: "broken legacy", raw: `[["Да"]`, wantErr: true},
+		{name: "broken object", raw: `{"type":`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse([]byte(tt.raw))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !sameKeyboard(got, tt.want) {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func sameKeyboard(a, b *Keyboard) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if a.Version != b.Version || a.Type != b.Type || a.Resize != b.Resize ||
+		a.OneTime != b.OneTime || a.Placeholder != b.Placeholder || len(a.Rows) != len(b.Rows) {
+		return false
+	}
+	for i := range a.Rows {
+		if len(a.Rows[i]) != len(b.Rows[i]) {
+			return false
+		}
+		for j := range a.Rows[i] {
+			if a.Rows[i][j] != b.Rows[i][j] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func TestValidate(t *testing.T) {
+	inline := func(buttons ...Button) *Keyboard {
+		return &Keyboard{Type: TypeInline, Rows: [][]Button{buttons}}
+	}
+	reply := func(buttons ...Button) *Keyboard {
+		return &Keyboard{Type: TypeReply, Rows: [][]Button{buttons}}
+	}
+
+	tests := []struct {
+		name    string
+		kb      *Keyboard
+		wantErr string
+	}{
+		{name: "reply text", kb: reply(Button{Type: ButtonText, Text: "Да"})},
+		{name: "inline callback", kb: inline(Button{Type: ButtonCallback, Text: "Далее", Node: "шаг 2"})},
+		{name: "inline tg link", kb: inline(Button{Type: ButtonURL, Text: "Канал", URL: "tg://resolve?domain=x"})},
+		{name: "link without host", kb: inline(Button{Type: ButtonURL, Text: "Сайт", URL: "example.com"}), wantErr: "некорректная ссылка"},
+		{name: "inline http link", kb: inline(Button{Type: ButtonURL, Text: "Сайт", URL: "http://example.com"})},
+		{name: "web app over http", kb: inline(Button{Type: ButtonWebApp, Text: "App", URL: "http://example.com"}), wantErr: "https://"},
+		{name: "unknown scheme", kb: inline(Button{Type: ButtonURL, Text: "Сайт", URL: "ftp://example.com"}), wantErr: "схема"},
+		{name: "unknown keyboard type", kb: &Keyboard{Type: "grid", Rows: [][]Button{{{Type: ButtonText, Text: "Да"}}}}, wantErr: "тип клавиатуры"},
+		{name: "no rows", kb: &Keyboard{Type: TypeReply}, wantErr: "пустой"},
+		{name: "empty row", kb: &Keyboard{Type: TypeReply, Rows: [][]Button{{}}}, wantErr: "строка 1 пустая"},
+		{name: "blank text", kb: reply(Button{Type: ButtonText, Text: "  "}), wantErr: "текст кнопки"},
+		{name: "text too long", kb: reply(Button{Type: ButtonText, Text: strings.Repeat("я", maxButtonText+1)}), wantErr: "длиннее"},
+		{name: "text button in inline", kb: inline(Button{Type: ButtonText, Text: "Да"}), wantErr: "только в reply"},
+		{name: "callback in reply", kb: reply(Button{Type: ButtonCallback, Text: "Далее", Node: "x"}), wantErr: "только в inline"},
+		{name: "callback without node", kb: inline(Button{Type: ButtonCallback, Text: "Далее"}), wantErr: "не указан шаблон"},
+		{name: "unknown button type", kb: inline(Button{Type: "pay", Text: "Оплатить"}), wantErr: "неизвестный тип кнопки"},
+		{
+			name:    "reply options on inline",
+			kb:      &Keyboard{Type: TypeInline, Resize: true, Rows: [][]Button{{{Type: ButtonCallback, Text: "Далее", Node: "x"}}}},
+			wantErr: "только для reply",
+		},
+		{
+			name:    "too many buttons in row",
+			kb:      reply(make([]Button, maxButtonsPerRow+1)...),
+			wantErr: "больше 8 кнопок",
+		},
+		{
+			name:    "error names the button",
+			kb:      &Keyboard{Type: TypeReply, Rows: [][]Button{{{Type: ButtonText, Text: "Да"}}, {{Type: ButtonText, Text: "Да"}, {Type: ButtonText}}}},
+			wantErr: "кнопка 2 в строке 2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.kb.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Validate() error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCallbackDataRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		button   Button
+		row, col int
+		want     string
+		wantRef  ButtonRef
+	}{
+		{name: "with id", button: Button{ID: "a1b2c3d4"}, row: 1, col: 2, want: "btn:42:a1b2c3d4", wantRef: ButtonRef{ID: "a1b2c3d4"}},
+		{name: "positional", button: Button{}, row: 1, col: 2, want: "btn:42:1:2", wantRef: ButtonRef{Row: 1, Col: 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := CallbackData(42, tt.button, tt.row, tt.col)
+			if data != tt.want {
+				t.Fatalf("CallbackData() = %q, want %q", data, tt.want)
+			}
+			if len(data) > 64 {
+				t.Fatalf("CallbackData() is %d bytes, Telegram allows 64", len(data))
+			}
+			templateID, ref, ok := ParseCallbackData(data)
+			if !ok || templateID != 42 || ref != tt.wantRef {
+				t.Fatalf("ParseCallbackData(%q) = %d, %+v, %v", data, templateID, ref, ok)
+			}
+		})
+	}
+}
+
+func TestParseCallbackDataRejects(t *testing.T) {
+	for _, data := range []string{
+		"",
+		"btn",
+		"btn:42",
+		"btn:42:",
+		"btn:x:a1b2",
+		"btn:42:1:x",
+		"btn:42:x:1",
+		"btn:42:1:2:3",
+		"tpl:42:a1b2",
+	} {
+		if _, _, ok := ParseCallbackData(data); ok {
+			t.Errorf("ParseCallbackData(%q) accepted", data)
+		}
+	}
+}
+
+func TestMarshalAssignsUniqueIDs(t *testing.T) {
+	kb := &Keyboard{Type: TypeInline, Rows: [][]Button{
+		{{Type: ButtonCallback, Text: "A", Node: "a", ID: "same"}, {Type: ButtonCallback, Text: "B", Node: "b", ID: "same"}},
+		{{Type: ButtonCallback, Text: "C", Node: "c"}, {Type: ButtonURL, Text: "Сайт", URL: "https://example.com"}},
+	}}
+	raw, err := kb.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := parsed.Rows[0][0].ID; got != "same" {
+		t.Errorf("first button ID = %q, want it kept", got)
+	}
+	seen := map[string]bool{}
+	for _, b := range []Button{parsed.Rows[0][0], parsed.Rows[0][1], parsed.Rows[1][0]} {
+		if b.ID == "" || seen[b.ID] {
+			t.Errorf("callback button %q has ID %q, want unique non-empty", b.Text, b.ID)
+		}
+		seen[b.ID] = true
+	}
+	if id := parsed.Rows[1][1].ID; id != "" {
+		t.Errorf("URL button got ID %q", id)
+	}
+}
+
+func TestFind(t *testing.T) {
+	legacy := &Keyboard{Type: TypeInline, Rows: [][]Button{
+		{{Type: ButtonCallback, Text: "A", Node: "a"}, {Type: ButtonCallback, Text: "B", Node: "b"}},
+	}}
+	withIDs := &Keyboard{Type: TypeInline, Rows: [][]Button{
+		{{Type: ButtonCallback, Text: "B", Node: "b", ID: "bbbb"}, {Type: ButtonCallback, Text: "A", Node: "a", ID: "aaaa"}},
+	}}
+
+	tests := []struct {
+		name     string
+		kb       *Keyboard
+		ref      ButtonRef
+		wantNode string
+		wantOK   bool
+	}{
+		{name: "position without ids", kb: legacy, ref: ButtonRef{Row: 0, Col: 1}, wantNode: "b", wantOK: true},
+		{name: "position out of range", kb: legacy, ref: ButtonRef{Row: 1, Col: 0}},
+		{name: "negative position", kb: legacy, ref: ButtonRef{Row: -1, Col: 0}},
+		{name: "id after reorder", kb: withIDs, ref: ButtonRef{ID: "aaaa"}, wantNode: "a", wantOK: true},
+		{name: "unknown id", kb: withIDs, ref: ButtonRef{ID: "cccc"}},
+		{name: "stale position after ids", kb: withIDs, ref: ButtonRef{Row: 0, Col: 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, ok := tt.kb.Find(tt.ref)
+			if ok != tt.wantOK || b.Node != tt.wantNode {
+				t.Errorf("Find(%+v) = %q, %v, want %q, %v", tt.ref, b.Node, ok, tt.wantNode, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestNodes(t *testing.T) {
+	kb := &Keyboard{Type: TypeInline, Rows: [][]Button{
+		{{Node: "a"}, {Node: "b"}},
+		{{Node: "a"}, {URL: "https://example.com"}, {Node: "c"}},
+	}}
+	got := strings.Join(kb.Nodes(), ",")
+	if got != "a,b,c" {
+		t.Errorf("Nodes() = %q, want %q", got, "a,b,c")
+	}
+}
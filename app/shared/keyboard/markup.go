@@ -0,0 +1,91 @@
+package keyboard
+
+// Разметка собирается собственными типами: в используемой версии
+// telegram-bot-api нет кнопок WebApp и подсказки поля ввода.
+
+type InlineMarkup struct {
+	InlineKeyboard [][]InlineButton `json:"inline_keyboard"`
+}
+
+type InlineButton struct {
+	Text                         string      `json:"text"`
+	URL                          string      `json:"url,omitempty"`
+	CallbackData                 string      `json:"callback_data,omitempty"`
+	SwitchInlineQuery            *string     `json:"switch_inline_query,omitempty"`
+	SwitchInlineQueryCurrentChat *string     `json:"switch_inline_query_current_chat,omitempty"`
+	WebApp                       *WebAppInfo `json:"web_app,omitempty"`
+}
+
+type ReplyMarkup struct {
+	Keyboard              [][]ReplyButton `json:"keyboard"`
+	ResizeKeyboard        bool            `json:"resize_keyboard,omitempty"`
+	OneTimeKeyboard       bool            `json:"one_time_keyboard,omitempty"`
+	InputFieldPlaceholder string          `json:"input_field_placeholder,omitempty"`
+}
+
+type ReplyButton struct {
+	Text   string      `json:"text"`
+	WebApp *WebAppInfo `json:"web_app,omitempty"`
+}
+
+type WebAppInfo struct {
+	URL string `json:"url"`
+}
+
+// Markup строит reply_markup для шаблона templateID. Возвращает
+// *InlineMarkup или *ReplyMarkup, либо nil, если клавиатуры нет.
+func (k *Keyboard) Markup(templateID int64) interface{} {
+	if k == nil || len(k.Rows) == 0 {
+		return nil
+	}
+
+	if k.Type == TypeInline {
+		markup := &InlineMarkup{}
+		for i, row := range k.Rows {
+			buttons := make([]InlineButton, 0, len(row))
+			for j, b := range row {
+				buttons = append(buttons, inlineButton(b, templateID, i, j))
+			}
+			markup.InlineKeyboard = append(markup.InlineKeyboard, buttons)
+		}
+		return markup
+	}
+
+	markup := &ReplyMarkup{
+		ResizeKeyboard:        k.Resize,
+		OneTimeKeyboard:       k.OneTime,
+		InputFieldPlaceholder: k.Placeholder,
+	}
+	for _, row := range k.Rows {
+		buttons := make([]ReplyButton, 0, len(row))
+		for _, b := range row {
+			button := ReplyButton{Text: b.Text}
+			if b.Type == ButtonWebApp {
+				button.WebApp = &WebAppInfo{URL: b.URL}
+			}
+			buttons = append(buttons, button)
+		}
+		markup.Keyboard = append(markup.Keyboard, buttons)
+	}
+	return markup
+}
+
+func inlineButton(b Button, templateID int64, row, col int) InlineButton {
+	button := InlineButton{Text: b.Text}
+	switch b.Type {
+	case ButtonURL:
+		button.URL = b.URL
+	case ButtonCallback:
+		button.CallbackData = CallbackData(templateID, b, row, col)
+	case ButtonSwitchInline:
+		query := b.Query
+		if b.CurrentChat {
+			button.SwitchInlineQueryCurrentChat = &query
+		} else {
+			button.SwitchInlineQuery = &query
+		}
+	case ButtonWebApp:
+		button.WebApp = &WebAppInfo{URL: b.URL}
+	}
+	return button
+}
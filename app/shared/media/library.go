@@ -0,0 +1,64 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"shared/database"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Library связывает файлы медиатеки с file_id, полученными каждым ботом.
+type Library struct {
+	db      *gorm.DB
+	storage Storage
+}
+
+func NewLibrary(db *gorm.DB, storage Storage) *Library {
+	return &Library{db: db, storage: storage}
+}
+
+// FileID возвращает file_id, под которым бот уже загружал файл, или пустую
+// строку, если бот отправляет его впервые.
+func (l *Library) FileID(ctx context.Context, mediaID, botID int64) (string, error) {
+	var record database.MediaBotFile
+	err := l.db.WithContext(ctx).
+		Where("media_id = ? AND bot_id = ?", mediaID, botID).
+		First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to load media file_id: %w", err)
+	}
+	return record.FileID, nil
+}
+
+// SaveFileID запоминает file_id файла для бота.
+func (l *Library) SaveFileID(ctx context.Context, mediaID, botID int64, fileID string) error {
+	record := database.MediaBotFile{MediaID: uint(mediaID), BotID: botID, FileID: fileID}
+	err := l.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "media_id"}, {Name: "bot_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"file_id"}),
+	}).Create(&record).Error
+	if err != nil {
+		return fmt.Errorf("failed to save media file_id: %w", err)
+	}
+	return nil
+}
+
+// Load возвращает описание файла и его содержимое из хранилища.
+func (l *Library) Load(ctx context.Context, mediaID int64) (*database.MediaFile, []byte, error) {
+	var file database.MediaFile
+	if err := l.db.WithContext(ctx).First(&file, mediaID).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to load media %d: %w", mediaID, err)
+	}
+	data, err := l.storage.Get(ctx, file.StorageKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &file, data, nil
+}
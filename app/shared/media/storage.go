@@ -0,0 +1,110 @@
+package media
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Storage хранит содержимое файлов медиатеки.
+type Storage interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	Get(ctx context.Context, key string) ([]byte, error)
+}
+
+// Key возвращает ключ хранилища для содержимого файла. Одинаковые файлы
+// хранятся один раз.
+func Key(data []byte) string {
+	return sha256Hex(data)
+}
+
+// NewStorageFromEnv выбирает хранилище по MEDIA_STORAGE: local (по
+// умолчанию, каталог MEDIA_DIR) или s3 (S3-совместимое, например MinIO).
+func NewStorageFromEnv() (Storage, error) {
+	switch kind := getEnv("MEDIA_STORAGE", "local"); kind {
+	case "local":
+		storage, err := NewLocalStorage(getEnv("MEDIA_DIR", "/data/media"))
+		if err != nil {
+			return nil, err
+		}
+		return storage, nil
+	case "s3":
+		storage, err := NewS3Storage(S3Config{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+			Region:    getEnv("S3_REGION", "us-east-1"),
+		})
+		if err != nil {
+			return nil, err
+		}
+		return storage, nil
+	default:
+		return nil, fmt.Errorf("unknown media storage %q", kind)
+	}
+}
+
+// LocalStorage хранит файлы в каталоге, общем для admin-bot и worker-bot.
+type LocalStorage struct {
+	dir string
+}
+
+func NewLocalStorage(dir string) (*LocalStorage, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create media dir: %w", err)
+	}
+	return &LocalStorage{dir: dir}, nil
+}
+
+func (s *LocalStorage) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	path := s.path(key)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create media dir: %w", err)
+	}
+
+	// Запись через временный файл, чтобы читатель не увидел файл частично
+	tmp, err := os.CreateTemp(filepath.Dir(path), key+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create media file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write media file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write media file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to store media file: %w", err)
+	}
+	return nil
+}
+
+func (s *LocalStorage) Get(ctx context.Context, key string) ([]byte, error) {
+	data, err := os.ReadFile(s.path(key))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read media file: %w", err)
+	}
+	return data, nil
+}
+
+func (s *LocalStorage) path(key string) string {
+	if len(key) < 2 {
+		return filepath.Join(s.dir, key)
+	}
+	return filepath.Join(s.dir, key[:2], key)
+}
+
+func getEnv(key, defaultValue string) string {
+	if value, exists := os.LookupEnv(key); exists {
+		return value
+	}
+	return defaultValue
+}
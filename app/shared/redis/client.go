@@ -3,6 +3,7 @@ package redis
 import (
 	"context"
 	"fmt"
+	"os"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -15,7 +16,7 @@ var (
 
 func Init() error {
 	Client = redis.NewClient(&redis.Options{
-		Addr:         "redis:6379",
+		Addr:         getEnv("REDIS_HOST", "redis") + ":" + getEnv("REDIS_PORT", "6379"),
 		Password:     "",
 		DB:           0,
 		DialTimeout:  5 * time.Second,
@@ -51,16 +52,9 @@ func chatStateKey(chatID int64, botToken string) string {
 	return fmt.Sprintf("chat:%d:%s:state", chatID, botToken)
 }
 
-func CheckRateLimit(userID int64, limit int, window time.Duration) (bool, error) {
-	key := fmt.Sprintf("rate:%d", userID)
-	count, err := Client.Incr(ctx, key).Result()
-	if err != nil {
-		return false, err
+func getEnv(key, defaultValue string) string {
+	if value, exists := os.LookupEnv(key); exists {
+		return value
 	}
-
-	if count == 1 {
-		Client.Expire(ctx, key, window)
-	}
-
-	return count > int64(limit), nil
+	return defaultValue
 }
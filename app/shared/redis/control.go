@@ -0,0 +1,278 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Команды управления ботами admin-bot пишет в поток ControlStream. Каждый
+// воркер читает поток своей группой и выполняет команды только для ботов,
+// назначенных ему (см. AssignBot). Итог воркер записывает в статус бота,
+// поэтому владелец видит «работает», только когда воркер действительно
+// взял бота.
+const (
+	ControlStream = "bots:control"
+	controlGroup  = "worker:"
+
+	// controlStreamLen ограничивает длину потока: выполненные команды
+	// больше не нужны
+	controlStreamLen = 10000
+)
+
+type Command string
+
+const (
+	CommandStartBot       Command = "start_bot"
+	CommandStopBot        Command = "stop_bot"
+	CommandReloadTemplate Command = "reload_template"
+	// CommandRotateToken — токен бота в базе заменён, воркер перезапускает
+	// бота с новым токеном
+	CommandRotateToken Command = "rotate_token"
+)
+
+// ControlCommand — команда воркерам. Токен в поток не попадает: воркер
+// читает его из базы по ID бота.
+type ControlCommand struct {
+	// ID — ID записи в потоке, по нему admin-bot ждёт подтверждения
+	ID      string
+	Command Command
+	BotID   int64
+}
+
+type BotState string
+
+const (
+	BotRunning BotState = "running"
+	BotStopped BotState = "stopped"
+	BotFailed  BotState = "failed"
+)
+
+// BotStatus — состояние бота по отчёту воркера.
+type BotStatus struct {
+	State  BotState
+	Worker string
+	Error  string
+	// Pending — последнюю отправленную команду ещё не выполнил ни один воркер
+	Pending   bool
+	UpdatedAt time.Time
+
+	// Health — здоровье бота по отчёту супервизора воркера
+	Health BotHealth
+}
+
+// Поля статуса: command пишет admin-bot, остальные — воркер. Так отчёт
+// воркера и новая команда не затирают друг друга.
+const (
+	statusCommand = "command"
+	statusAcked   = "acked"
+	statusState   = "state"
+	statusWorker  = "worker"
+	statusError   = "error"
+	statusUpdated = "updated_at"
+)
+
+func workerGroup(worker string) string {
+	return controlGroup + worker
+}
+
+func botStatusKey(botID int64) string {
+	return "bots:status:" + strconv.FormatInt(botID, 10)
+}
+
+// SendCommand добавляет команду в поток и возвращает её ID.
+func SendCommand(ctx context.Context, cli redis.UniversalClient, command Command, botID int64) (string, error) {
+	id, err := cli.XAdd(ctx, &redis.XAddArgs{
+		Stream: ControlStream,
+		MaxLen: controlStreamLen,
+		Approx: true,
+		Values: map[string]interface{}{
+			"command": string(command),
+			"bot_id":  botID,
+		},
+	}).Result()
+	if err != nil {
+		return "", fmt.Errorf("failed to send %s command: %w", command, err)
+	}
+	if err := cli.HSet(ctx, botStatusKey(botID), statusCommand, id).Err(); err != nil {
+		return "", fmt.Errorf("failed to mark %s command: %w", command, err)
+	}
+	return id, nil
+}
+
+// ReadCommands возвращает команды для воркера. Сначала возвращаются
+// команды, которые воркер прочитал до перезапуска и не подтвердил, затем
+// новые. Без команд ждёт не дольше block.
+func ReadCommands(ctx context.Context, cli redis.UniversalClient, worker string, block time.Duration) ([]ControlCommand, error) {
+	err := cli.XGroupCreateMkStream(ctx, ControlStream, workerGroup(worker), "$").Err()
+	if err != nil && !isBusyGroup(err) {
+		return nil, fmt.Errorf("failed to create control group: %w", err)
+	}
+
+	commands, err := readCommands(ctx, cli, worker, "0", 0)
+	if err != nil || len(commands) > 0 {
+		return commands, err
+	}
+	return readCommands(ctx, cli, worker, ">", block)
+}
+
+func readCommands(ctx context.Context, cli redis.UniversalClient, worker, start string, block time.Duration) ([]ControlCommand, error) {
+	args := &redis.XReadGroupArgs{
+		Group:    workerGroup(worker),
+		Consumer: worker,
+		Streams:  []string{ControlStream, start},
+		Count:    10,
+		Block:    block,
+	}
+	// Для своих неподтверждённых команд Redis не ждёт, Block не нужен
+	if start != ">" {
+		args.Block = -1
+	}
+
+	streams, err := cli.XReadGroup(ctx, args).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read control commands: %w", err)
+	}
+
+	var commands []ControlCommand
+	for _, stream := range streams {
+		for _, msg := range stream.Messages {
+			command, _ := msg.Values["command"].(string)
+			botID, _ := strconv.ParseInt(fmt.Sprint(msg.Values["bot_id"]), 10, 64)
+			commands = append(commands, ControlCommand{
+				ID:      msg.ID,
+				Command: Command(command),
+				BotID:   botID,
+			})
+		}
+	}
+	return commands, nil
+}
+
+// AckCommand записывает итог команды в статус бота и удаляет команду из
+// списка невыполненных.
+func AckCommand(ctx context.Context, cli redis.UniversalClient, command ControlCommand, worker string, state BotState, cause error) error {
+	if err := reportStatus(ctx, cli, command.BotID, worker, state, cause, command.ID); err != nil {
+		return err
+	}
+	return SkipCommand(ctx, cli, command, worker)
+}
+
+// SkipCommand отмечает команду прочитанной без отчёта: её выполняет
+// воркер, которому назначен бот.
+func SkipCommand(ctx context.Context, cli redis.UniversalClient, command ControlCommand, worker string) error {
+	if err := cli.XAck(ctx, ControlStream, workerGroup(worker), command.ID).Err(); err != nil {
+		return fmt.Errorf("failed to ack command %s: %w", command.ID, err)
+	}
+	return nil
+}
+
+// ReportStatus записывает состояние бота, которое изменилось не по
+// команде, например при запуске воркера.
+func ReportStatus(ctx context.Context, cli redis.UniversalClient, botID int64, worker string, state BotState, cause error) error {
+	return reportStatus(ctx, cli, botID, worker, state, cause, "")
+}
+
+func reportStatus(ctx context.Context, cli redis.UniversalClient, botID int64, worker string, state BotState, cause error, commandID string) error {
+	fields := map[string]interface{}{
+		statusState:   string(state),
+		statusWorker:  worker,
+		statusError:   "",
+		statusUpdated: time.Now().Unix(),
+	}
+	if cause != nil {
+		fields[statusError] = cause.Error()
+	}
+	if commandID != "" {
+		fields[statusAcked] = commandID
+	}
+	if err := cli.HSet(ctx, botStatusKey(botID), fields).Err(); err != nil {
+		return fmt.Errorf("failed to report status of bot %d: %w", botID, err)
+	}
+	return nil
+}
+
+// GetBotStatus возвращает статус бота или nil, если о боте ещё не было
+// ни команд, ни отчётов.
+func GetBotStatus(ctx context.Context, cli redis.UniversalClient, botID int64) (*BotStatus, error) {
+	fields, err := cli.HGetAll(ctx, botStatusKey(botID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get status of bot %d: %w", botID, err)
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	command, acked := fields[statusCommand], fields[statusAcked]
+	status := &BotStatus{
+		State:   BotState(fields[statusState]),
+		Worker:  fields[statusWorker],
+		Error:   fields[statusError],
+		Pending: command != "" && (acked == "" || streamIDLess(acked, command)),
+		Health:  parseHealth(fields),
+	}
+	if updated, err := strconv.ParseInt(fields[statusUpdated], 10, 64); err == nil {
+		status.UpdatedAt = time.Unix(updated, 0)
+	}
+	return status, nil
+}
+
+// WaitCommand ждёт, пока воркер выполнит команду id, и возвращает статус
+// бота после неё. Если воркер не успел за timeout, статус возвращается с
+// Pending.
+func WaitCommand(ctx context.Context, cli redis.UniversalClient, botID int64, id string, timeout time.Duration) (*BotStatus, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		acked, err := cli.HGet(ctx, botStatusKey(botID), statusAcked).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return nil, fmt.Errorf("failed to get status of bot %d: %w", botID, err)
+		}
+		// ID в потоке растут, поэтому более новая выполненная команда
+		// означает, что выполнена и эта
+		if acked != "" && !streamIDLess(acked, id) {
+			break
+		}
+		if time.Now().After(deadline) {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(250 * time.Millisecond):
+		}
+	}
+
+	status, err := GetBotStatus(ctx, cli, botID)
+	if err != nil || status != nil {
+		return status, err
+	}
+	return &BotStatus{Pending: true}, nil
+}
+
+// streamIDLess сравнивает ID записей потока вида «миллисекунды-номер».
+func streamIDLess(a, b string) bool {
+	aMs, aSeq := splitStreamID(a)
+	bMs, bSeq := splitStreamID(b)
+	if aMs != bMs {
+		return aMs < bMs
+	}
+	return aSeq < bSeq
+}
+
+func splitStreamID(id string) (uint64, uint64) {
+	var ms, seq uint64
+	fmt.Sscanf(id, "%d-%d", &ms, &seq)
+	return ms, seq
+}
+
+func isBusyGroup(err error) bool {
+	return strings.HasPrefix(err.Error(), "BUSYGROUP")
+}
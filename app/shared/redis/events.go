@@ -0,0 +1,50 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// TemplateEventsChannel — канал, в который admin-bot сообщает worker-bot
+// об изменениях шаблонов и привязок ботов.
+const TemplateEventsChannel = "templates:events"
+
+type TemplateEventKind string
+
+const (
+	// EventTemplateChanged — шаблон создан, опубликован или откачен.
+	// TemplateID пуст, если изменилось сразу несколько шаблонов владельца.
+	EventTemplateChanged TemplateEventKind = "template"
+	// EventBindingChanged — боту назначен другой стартовый шаблон.
+	EventBindingChanged TemplateEventKind = "binding"
+)
+
+type TemplateEvent struct {
+	Kind       TemplateEventKind `json:"kind"`
+	OwnerID    int64             `json:"owner_id,omitempty"`
+	TemplateID int64             `json:"template_id,omitempty"`
+	// BotID — ID бота в Telegram, токен в канал не попадает
+	BotID int64 `json:"bot_id,omitempty"`
+}
+
+func PublishTemplateEvent(ctx context.Context, cli redis.UniversalClient, event TemplateEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if err := cli.Publish(ctx, TemplateEventsChannel, payload).Err(); err != nil {
+		return fmt.Errorf("failed to publish template event: %w", err)
+	}
+	return nil
+}
+
+func ParseTemplateEvent(payload string) (TemplateEvent, error) {
+	var event TemplateEvent
+	if err := json.Unmarshal([]byte(payload), &event); err != nil {
+		return event, fmt.Errorf("invalid template event: %w", err)
+	}
+	return event, nil
+}
@@ -0,0 +1,73 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type HealthState string
+
+const (
+	HealthOK HealthState = "ok"
+	// HealthDegraded — были сбои подряд, но меньше порога
+	HealthDegraded HealthState = "degraded"
+	// HealthOpen — цепь разомкнута: бот не обрабатывает обновления до
+	// перезапуска в RetryAt
+	HealthOpen HealthState = "open"
+	// HealthRecovering — бот перезапущен после сбоев и ждёт первого
+	// успешного обновления
+	HealthRecovering HealthState = "recovering"
+)
+
+// BotHealth — здоровье бота на воркере, который его обслуживает.
+type BotHealth struct {
+	State     HealthState `json:"state"`
+	Failures  int         `json:"failures"`
+	Restarts  int         `json:"restarts"`
+	LastError string      `json:"last_error,omitempty"`
+	RetryAt   time.Time   `json:"retry_at,omitempty"`
+}
+
+const (
+	healthState    = "health"
+	healthFailures = "failures"
+	healthRestarts = "restarts"
+	healthError    = "health_error"
+	healthRetryAt  = "retry_at"
+)
+
+// ReportHealth записывает здоровье бота рядом с его статусом.
+func ReportHealth(ctx context.Context, cli redis.UniversalClient, botID int64, health BotHealth) error {
+	var retryAt int64
+	if !health.RetryAt.IsZero() {
+		retryAt = health.RetryAt.Unix()
+	}
+	err := cli.HSet(ctx, botStatusKey(botID), map[string]interface{}{
+		healthState:    string(health.State),
+		healthFailures: health.Failures,
+		healthRestarts: health.Restarts,
+		healthError:    health.LastError,
+		healthRetryAt:  retryAt,
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to report health of bot %d: %w", botID, err)
+	}
+	return nil
+}
+
+func parseHealth(fields map[string]string) BotHealth {
+	health := BotHealth{
+		State:     HealthState(fields[healthState]),
+		LastError: fields[healthError],
+	}
+	health.Failures, _ = strconv.Atoi(fields[healthFailures])
+	health.Restarts, _ = strconv.Atoi(fields[healthRestarts])
+	if retryAt, _ := strconv.ParseInt(fields[healthRetryAt], 10, 64); retryAt > 0 {
+		health.RetryAt = time.Unix(retryAt, 0)
+	}
+	return health
+}
@@ -0,0 +1,141 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type RateScope string
+
+const (
+	ScopeBot   RateScope = "bot"
+	ScopeChat  RateScope = "chat"
+	ScopeAdmin RateScope = "admin"
+)
+
+type Plan string
+
+const (
+	PlanFree     Plan = "free"
+	PlanPro      Plan = "pro"
+	PlanBusiness Plan = "business"
+)
+
+type RateLimit struct {
+	Limit  int
+	Window time.Duration
+}
+
+// PlanLimits задаёт лимиты по умолчанию. Любое значение можно переопределить
+// переменной окружения RATE_LIMIT_<SCOPE>_<PLAN>, например RATE_LIMIT_CHAT_FREE=20/1m.
+var PlanLimits = map[Plan]map[RateScope]RateLimit{
+	PlanFree: {
+		ScopeBot:   {Limit: 600, Window: time.Minute},
+		ScopeChat:  {Limit: 20, Window: time.Minute},
+		ScopeAdmin: {Limit: 30, Window: time.Minute},
+	},
+	PlanPro: {
+		ScopeBot:   {Limit: 3000, Window: time.Minute},
+		ScopeChat:  {Limit: 40, Window: time.Minute},
+		ScopeAdmin: {Limit: 120, Window: time.Minute},
+	},
+	PlanBusiness: {
+		ScopeBot:   {Limit: 10000, Window: time.Minute},
+		ScopeChat:  {Limit: 60, Window: time.Minute},
+		ScopeAdmin: {Limit: 300, Window: time.Minute},
+	},
+}
+
+// LimitFor возвращает лимит области для тарифа. Неизвестный тариф
+// получает лимиты бесплатного.
+func LimitFor(plan Plan, scope RateScope) RateLimit {
+	envKey := fmt.Sprintf("RATE_LIMIT_%s_%s", strings.ToUpper(string(scope)), strings.ToUpper(string(plan)))
+	if value, exists := os.LookupEnv(envKey); exists {
+		if limit, err := ParseRateLimit(value); err == nil {
+			return limit
+		}
+	}
+
+	limits, ok := PlanLimits[plan]
+	if !ok {
+		limits = PlanLimits[PlanFree]
+	}
+	return limits[scope]
+}
+
+// ParseRateLimit разбирает лимит в формате "<количество>/<окно>", например "30/1m".
+func ParseRateLimit(value string) (RateLimit, error) {
+	countStr, windowStr, ok := strings.Cut(strings.TrimSpace(value), "/")
+	if !ok {
+		return RateLimit{}, fmt.Errorf("invalid rate limit %q", value)
+	}
+	count, err := strconv.Atoi(countStr)
+	if err != nil || count <= 0 {
+		return RateLimit{}, fmt.Errorf("invalid rate limit count %q", countStr)
+	}
+	window, err := time.ParseDuration(windowStr)
+	if err != nil || window <= 0 {
+		return RateLimit{}, fmt.Errorf("invalid rate limit window %q", windowStr)
+	}
+	return RateLimit{Limit: count, Window: window}, nil
+}
+
+// slidingWindowScript хранит отметки запросов в ZSET и за один вызов
+// чистит устаревшие, считает оставшиеся и добавляет новую отметку.
+// Возвращает {1, 0} если запрос разрешён и {0, retry_ms} если нет.
+var slidingWindowScript = redis.NewScript(`
+local key = KEYS[1]
+local window = tonumber(ARGV[1])
+local limit = tonumber(ARGV[2])
+local member = ARGV[3]
+
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+redis.call('ZREMRANGEBYSCORE', key, '-inf', now - window)
+if redis.call('ZCARD', key) < limit then
+	redis.call('ZADD', key, now, member)
+	redis.call('PEXPIRE', key, window)
+	return {1, 0}
+end
+
+local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+local retry = window
+if oldest[2] then
+	retry = tonumber(oldest[2]) + window - now
+end
+return {0, retry}
+`)
+
+type RateLimiter struct {
+	cli redis.Scripter
+}
+
+func NewRateLimiter(cli redis.Scripter) *RateLimiter {
+	return &RateLimiter{cli: cli}
+}
+
+// Allow атомарно учитывает запрос в скользящем окне области и сообщает,
+// укладывается ли он в лимит. Если нет, возвращается время до освобождения слота.
+func (l *RateLimiter) Allow(ctx context.Context, scope RateScope, key string, limit RateLimit) (bool, time.Duration, error) {
+	redisKey := fmt.Sprintf("rate:%s:%s", scope, key)
+	member := strconv.FormatInt(time.Now().UnixNano(), 36) + "-" + strconv.FormatInt(rand.Int63(), 36)
+
+	res, err := slidingWindowScript.Run(ctx, l.cli, []string{redisKey},
+		limit.Window.Milliseconds(), limit.Limit, member).Int64Slice()
+	if err != nil {
+		return false, 0, fmt.Errorf("rate limit check failed: %w", err)
+	}
+	if len(res) != 2 {
+		return false, 0, fmt.Errorf("unexpected rate limit reply: %v", res)
+	}
+
+	return res[0] == 1, time.Duration(res[1]) * time.Millisecond, nil
+}
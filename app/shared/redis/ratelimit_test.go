@@ -0,0 +1,89 @@
+package redis
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    RateLimit
+		wantErr bool
+	}{
+		{value: "30/1m", want: RateLimit{Limit: 30, Window: time.Minute}},
+		{value: " 5/10s ", want: RateLimit{Limit: 5, Window: 10 * time.Second}},
+		{value: "1000/1h30m", want: RateLimit{Limit: 1000, Window: 90 * time.Minute}},
+		{value: "", wantErr: true},
+		{value: "30", wantErr: true},
+		{value: "30/", wantErr: true},
+		{value: "/1m", wantErr: true},
+		{value: "0/1m", wantErr: true},
+		{value: "-5/1m", wantErr: true},
+		{value: "x/1m", wantErr: true},
+		{value: "30/1", wantErr: true},
+		{value: "30/0s", wantErr: true},
+		{value: "30/-1m", wantErr: true},
+		{value: "30 / 1m", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseRateLimit(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRateLimit(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseRateLimit(%q) = %+v, want %+v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLimitFor(t *testing.T) {
+	tests := []struct {
+		name  string
+		plan  Plan
+		scope RateScope
+		env   map[string]string
+		want  RateLimit
+	}{
+		{name: "default", plan: PlanPro, scope: ScopeChat, want: PlanLimits[PlanPro][ScopeChat]},
+		{name: "unknown plan falls back to free", plan: "gold", scope: ScopeBot, want: PlanLimits[PlanFree][ScopeBot]},
+		{
+			name: "env override",
+			plan: PlanFree, scope: ScopeChat,
+			env:  map[string]string{"RATE_LIMIT_CHAT_FREE": "5/10s"},
+			want: RateLimit{Limit: 5, Window: 10 * time.Second},
+		},
+		{
+			name: "override of another plan is ignored",
+			plan: PlanBusiness, scope: ScopeChat,
+			env:  map[string]string{"RATE_LIMIT_CHAT_FREE": "5/10s"},
+			want: PlanLimits[PlanBusiness][ScopeChat],
+		},
+		{
+			name: "invalid override keeps default",
+			plan: PlanFree, scope: ScopeAdmin,
+			env:  map[string]string{"RATE_LIMIT_ADMIN_FREE": "fast"},
+			want: PlanLimits[PlanFree][ScopeAdmin],
+		},
+		{
+			name: "override for unknown plan",
+			plan: "gold", scope: ScopeBot,
+			env:  map[string]string{"RATE_LIMIT_BOT_GOLD": "100/1s"},
+			want: RateLimit{Limit: 100, Window: time.Second},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			if got := LimitFor(tt.plan, tt.scope); got != tt.want {
+				t.Errorf("LimitFor(%s, %s) = %+v, want %+v", tt.plan, tt.scope, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Реестр воркеров: каждый воркер раз в HeartbeatInterval обновляет время
+// в workersKey. Воркер, который не отмечался дольше WorkerTTL, считается
+// мёртвым, и его боты переходят к остальным.
+const (
+	HeartbeatInterval = 5 * time.Second
+	WorkerTTL         = 3 * HeartbeatInterval
+
+	workersKey     = "workers:alive"
+	workersAddrKey = "workers:addr"
+)
+
+// Worker — живой экземпляр worker-bot. Addr — адрес, по которому другие
+// воркеры пересылают ему обновления его ботов.
+type Worker struct {
+	ID   string
+	Addr string
+}
+
+// Heartbeat отмечает воркер живым.
+func Heartbeat(ctx context.Context, cli redis.UniversalClient, w Worker) error {
+	_, err := cli.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, workersKey, redis.Z{Score: float64(time.Now().UnixMilli()), Member: w.ID})
+		pipe.HSet(ctx, workersAddrKey, w.ID, w.Addr)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send heartbeat: %w", err)
+	}
+	return nil
+}
+
+// LiveWorkers возвращает живые воркеры, упорядоченные по ID, и удаляет из
+// реестра мёртвые вместе с их группами в потоке команд.
+func LiveWorkers(ctx context.Context, cli redis.UniversalClient) ([]Worker, error) {
+	cutoff := strconv.FormatInt(time.Now().Add(-WorkerTTL).UnixMilli(), 10)
+
+	dead, err := cli.ZRangeByScore(ctx, workersKey, &redis.ZRangeBy{Min: "-inf", Max: "(" + cutoff}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dead workers: %w", err)
+	}
+	for _, id := range dead {
+		// ZRem вернёт 0, если мёртвый воркер уже удалил другой воркер
+		if n, err := cli.ZRem(ctx, workersKey, id).Result(); err != nil || n == 0 {
+			continue
+		}
+		cli.HDel(ctx, workersAddrKey, id)
+		cli.XGroupDestroy(ctx, ControlStream, workerGroup(id))
+	}
+
+	ids, err := cli.ZRangeByScore(ctx, workersKey, &redis.ZRangeBy{Min: cutoff, Max: "+inf"}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list workers: %w", err)
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	addrs, err := cli.HMGet(ctx, workersAddrKey, ids...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get worker addresses: %w", err)
+	}
+
+	workers := make([]Worker, len(ids))
+	for i, id := range ids {
+		addr, _ := addrs[i].(string)
+		workers[i] = Worker{ID: id, Addr: addr}
+	}
+	sort.Slice(workers, func(i, j int) bool { return workers[i].ID < workers[j].ID })
+	return workers, nil
+}
+
+// Deregister удаляет воркер из реестра при остановке, чтобы его боты сразу
+// перешли к остальным.
+func Deregister(ctx context.Context, cli redis.UniversalClient, id string) error {
+	if err := cli.ZRem(ctx, workersKey, id).Err(); err != nil {
+		return fmt.Errorf("failed to deregister worker: %w", err)
+	}
+	cli.HDel(ctx, workersAddrKey, id)
+	return nil
+}
+
+// AssignBot выбирает воркер для бота rendezvous-хешированием: у каждой пары
+// бот–воркер свой вес, бот достаётся воркеру с наибольшим. Когда воркер
+// появляется или пропадает, переезжают только боты, которые он получает
+// или теряет, остальные остаются на месте.
+func AssignBot(botID int64, workers []Worker) (Worker, bool) {
+	var (
+		best   Worker
+		weight uint64
+		found  bool
+	)
+	for _, w := range workers {
+		h := fnv.New64a()
+		h.Write([]byte(w.ID))
+		h.Write([]byte{0})
+		h.Write([]byte(strconv.FormatInt(botID, 10)))
+		if s := mix64(h.Sum64()); !found || s > weight {
+			best, weight, found = w, s, true
+		}
+	}
+	return best, found
+}
+
+// mix64 перемешивает биты хеша: у FNV близкие ключи дают близкие значения,
+// и без перемешивания боты распределялись бы неравномерно.
+func mix64(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
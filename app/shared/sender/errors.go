@@ -0,0 +1,105 @@
+package sender
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+var (
+	ErrBlocked      = errors.New("bot was blocked by the user")
+	ErrChatNotFound = errors.New("chat not found")
+	ErrUnauthorized = errors.New("bot token is invalid or revoked")
+	ErrPermanent    = errors.New("permanent send error")
+)
+
+// retryableError описывает временную ошибку, после которой отправку
+// можно повторить. RetryAfter заполняется только для ответов 429.
+type retryableError struct {
+	err        error
+	retryAfter time.Duration
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryableError) Unwrap() error {
+	return e.err
+}
+
+// Classify приводит ошибку Bot API к одной из постоянных ошибок пакета
+// или помечает её как временную.
+func Classify(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var apiErr *tgbotapi.Error
+	if !errors.As(err, &apiErr) {
+		if isTransient(err) {
+			return &retryableError{err: err}
+		}
+		// Ошибки подготовки запроса повтор не исправит
+		return fmt.Errorf("%w: %w", ErrPermanent, err)
+	}
+
+	switch {
+	case apiErr.Code == 429:
+		return &retryableError{
+			err:        err,
+			retryAfter: time.Duration(apiErr.RetryAfter) * time.Second,
+		}
+	case apiErr.Code >= 500:
+		return &retryableError{err: err}
+	case apiErr.Code == 401, apiErr.Code == 404:
+		return fmt.Errorf("%w: %s", ErrUnauthorized, apiErr.Message)
+	case apiErr.Code == 403:
+		return fmt.Errorf("%w: %s", ErrBlocked, apiErr.Message)
+	case apiErr.Code == 400 && strings.Contains(strings.ToLower(apiErr.Message), "chat not found"):
+		return fmt.Errorf("%w: %s", ErrChatNotFound, apiErr.Message)
+	default:
+		return fmt.Errorf("%w: %s", ErrPermanent, apiErr.Message)
+	}
+}
+
+// isTransient отличает сбой сети или обрыв ответа от ошибок, которые
+// повторятся при каждой попытке: неверных параметров, ошибок кодирования.
+//
+// Ответ, который не разбирается как JSON, тоже временный: так отвечают
+// прокси и Telegram при 5xx, а tgbotapi код статуса не возвращает.
+func isTransient(err error) bool {
+	var netErr net.Error
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	return errors.As(err, &netErr) ||
+		errors.As(err, &syntaxErr) ||
+		errors.As(err, &typeErr) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, os.ErrDeadlineExceeded) ||
+		errors.Is(err, context.DeadlineExceeded)
+}
+
+// IsPermanent сообщает, что повторная отправка не поможет.
+func IsPermanent(err error) bool {
+	return errors.Is(err, ErrBlocked) ||
+		errors.Is(err, ErrChatNotFound) ||
+		errors.Is(err, ErrUnauthorized) ||
+		errors.Is(err, ErrPermanent)
+}
+
+// IsUnauthorized сообщает, что Telegram отклонил токен бота: токен отозван
+// в BotFather или бот удалён. Подходят и ошибки Sender, и ошибки прямых
+// вызовов Bot API.
+func IsUnauthorized(err error) bool {
+	return errors.Is(err, ErrUnauthorized) || errors.Is(Classify(err), ErrUnauthorized)
+}
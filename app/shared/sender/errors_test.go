@@ -0,0 +1,111 @@
+package sender
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func apiError(code int, message string) error {
+	return &tgbotapi.Error{Code: code, Message: message}
+}
+
+// decodeError возвращает ошибку, с которой tgbotapi разбирает ответ не в
+// JSON, например страницу 502 от прокси.
+func decodeError() error {
+	return json.Unmarshal([]byte("<html>502 Bad Gateway</html>"), &tgbotapi.APIResponse{})
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantIs     error
+		retryable  bool
+		retryAfter time.Duration
+	}{
+		{
+			name: "flood wait",
+			err: &tgbotapi.Error{Code: 429, Message: "Too Many Requests: retry after 7",
+				ResponseParameters: tgbotapi.ResponseParameters{RetryAfter: 7}},
+			retryable:  true,
+			retryAfter: 7 * time.Second,
+		},
+		{name: "server error", err: apiError(502, "Bad Gateway"), retryable: true},
+		{name: "unauthorized", err: apiError(401, "Unauthorized"), wantIs: ErrUnauthorized},
+		{name: "bot deleted", err: apiError(404, "Not Found"), wantIs: ErrUnauthorized},
+		{name: "blocked", err: apiError(403, "Forbidden: bot was blocked by the user"), wantIs: ErrBlocked},
+		{name: "chat not found", err: apiError(400, "Bad Request: chat not found"), wantIs: ErrChatNotFound},
+		{name: "bad request", err: apiError(400, "Bad Request: message text is empty"), wantIs: ErrPermanent},
+		{name: "network error", err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}, retryable: true},
+		{name: "timeout", err: fmt.Errorf("request: %w", os.ErrDeadlineExceeded), retryable: true},
+		{name: "context deadline", err: context.DeadlineExceeded, retryable: true},
+		{name: "cut response", err: io.ErrUnexpectedEOF, retryable: true},
+		{name: "empty response", err: io.EOF, retryable: true},
+		{name: "non-JSON response", err: decodeError(), retryable: true},
+		{name: "unexpected JSON", err: &json.UnmarshalTypeError{Value: "string", Type: reflect.TypeOf(0)}, retryable: true},
+		{name: "encoding params", err: &json.UnsupportedTypeError{Type: reflect.TypeOf(func() {})}, wantIs: ErrPermanent},
+		{name: "other error", err: errors.New("file too big"), wantIs: ErrPermanent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Classify(tt.err)
+			var apiErr *tgbotapi.Error
+			if !errors.As(tt.err, &apiErr) && !errors.Is(got, tt.err) {
+				t.Errorf("Classify() = %v, lost the original error", got)
+			}
+
+			var retryable *retryableError
+			isRetryable := errors.As(got, &retryable)
+			if isRetryable != tt.retryable {
+				t.Fatalf("Classify() = %v, retryable %v, want %v", got, isRetryable, tt.retryable)
+			}
+			if isRetryable {
+				if IsPermanent(got) {
+					t.Errorf("retryable error %v is permanent", got)
+				}
+				if retryable.retryAfter != tt.retryAfter {
+					t.Errorf("retryAfter = %s, want %s", retryable.retryAfter, tt.retryAfter)
+				}
+				return
+			}
+			if !errors.Is(got, tt.wantIs) || !IsPermanent(got) {
+				t.Errorf("Classify() = %v, want permanent %v", got, tt.wantIs)
+			}
+		})
+	}
+
+	if Classify(nil) != nil {
+		t.Error("Classify(nil) != nil")
+	}
+}
+
+func TestIsUnauthorized(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "raw 401", err: apiError(401, "Unauthorized"), want: true},
+		{name: "classified", err: Classify(apiError(404, "Not Found")), want: true},
+		{name: "blocked", err: apiError(403, "Forbidden"), want: false},
+		{name: "network", err: io.ErrUnexpectedEOF, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsUnauthorized(tt.err); got != tt.want {
+				t.Errorf("IsUnauthorized(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package sender
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// limiter выдаёт слоты не чаще одного за interval. Ожидающие вызовы
+// выстраиваются в очередь по времени обращения.
+type limiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func newLimiter(interval time.Duration) *limiter {
+	return &limiter{interval: interval}
+}
+
+func (l *limiter) wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+
+	return sleep(ctx, delay)
+}
+
+// pause откладывает следующий слот, например по retry_after из ответа 429.
+func (l *limiter) pause(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until := time.Now().Add(d); until.After(l.next) {
+		l.next = until
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,223 @@
+package sender
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Лимиты Bot API: около 30 сообщений в секунду на бота, одно сообщение
+// в секунду в личный чат и 20 сообщений в минуту в группу.
+const (
+	botInterval   = time.Second / 30
+	chatInterval  = time.Second
+	groupInterval = time.Minute / 20
+
+	maxAttempts = 5
+	baseBackoff = 500 * time.Millisecond
+	maxBackoff  = 30 * time.Second
+
+	maxIdleChats = 10000
+	chatIdleTTL  = 10 * time.Minute
+)
+
+type chatQueue struct {
+	// mu держится на всё время отправки, чтобы сообщения в один чат
+	// уходили в порядке вызова
+	mu       sync.Mutex
+	limiter  *limiter
+	lastUsed time.Time
+}
+
+// Sender отправляет сообщения от имени одного бота с учётом лимитов
+// Telegram, повторяет временные ошибки и классифицирует постоянные.
+type Sender struct {
+	bot    *tgbotapi.BotAPI
+	global *limiter
+	mu     sync.Mutex
+	chats  map[int64]*chatQueue
+}
+
+func New(bot *tgbotapi.BotAPI) *Sender {
+	return &Sender{
+		bot:    bot,
+		global: newLimiter(botInterval),
+		chats:  make(map[int64]*chatQueue),
+	}
+}
+
+// Bot возвращает клиента Bot API, через которого идёт отправка.
+func (s *Sender) Bot() *tgbotapi.BotAPI {
+	return s.bot
+}
+
+// Send ставит сообщение в очередь бота и чата и отправляет его. Ошибка,
+// если она есть, уже прошла через Classify.
+func (s *Sender) Send(ctx context.Context, c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	var msg tgbotapi.Message
+	err := s.do(ctx, chatIDOf(c), func() error {
+		var err error
+		msg, err = s.bot.Send(c)
+		return err
+	})
+	return msg, err
+}
+
+// Request аналогичен Send для методов, которые не возвращают сообщение.
+func (s *Sender) Request(ctx context.Context, c tgbotapi.Chattable) (*tgbotapi.APIResponse, error) {
+	var resp *tgbotapi.APIResponse
+	err := s.do(ctx, chatIDOf(c), func() error {
+		var err error
+		resp, err = s.bot.Request(c)
+		return err
+	})
+	return resp, err
+}
+
+// Call выполняет произвольный метод Bot API с готовыми параметрами.
+// Используется там, где запрос хранится в сериализованном виде.
+func (s *Sender) Call(ctx context.Context, chatID int64, method string, params tgbotapi.Params) (*tgbotapi.APIResponse, error) {
+	var resp *tgbotapi.APIResponse
+	err := s.do(ctx, chatID, func() error {
+		var err error
+		resp, err = s.bot.MakeRequest(method, params)
+		return err
+	})
+	return resp, err
+}
+
+// Upload выполняет метод Bot API с загрузкой файлов. Файлы передаются
+// как FileBytes, чтобы запрос можно было повторить.
+func (s *Sender) Upload(ctx context.Context, chatID int64, method string, params tgbotapi.Params, files []tgbotapi.RequestFile) (*tgbotapi.APIResponse, error) {
+	var resp *tgbotapi.APIResponse
+	err := s.do(ctx, chatID, func() error {
+		var err error
+		resp, err = s.bot.UploadFiles(method, params, files)
+		return err
+	})
+	return resp, err
+}
+
+func (s *Sender) do(ctx context.Context, chatID int64, call func() error) error {
+	var chat *chatQueue
+	if chatID != 0 {
+		chat = s.chat(chatID)
+		chat.mu.Lock()
+		defer chat.mu.Unlock()
+	}
+
+	for attempt := 1; ; attempt++ {
+		if chat != nil {
+			if err := chat.limiter.wait(ctx); err != nil {
+				return err
+			}
+		}
+		if err := s.global.wait(ctx); err != nil {
+			return err
+		}
+
+		err := Classify(call())
+		if err == nil {
+			return nil
+		}
+
+		var retryable *retryableError
+		if !errors.As(err, &retryable) {
+			return err
+		}
+		if attempt >= maxAttempts {
+			return fmt.Errorf("send failed after %d attempts: %w", attempt, err)
+		}
+
+		delay := retryable.retryAfter
+		if delay > 0 {
+			// 429 означает и общий лимит бота: пока он не снят, остальные
+			// чаты получили бы тот же ответ
+			if chat != nil {
+				chat.limiter.pause(delay)
+			}
+			s.global.pause(delay)
+		} else {
+			delay = backoff(attempt)
+		}
+
+		log.Printf("Send to chat %d failed (attempt %d), retrying in %s: %v", chatID, attempt, delay, err)
+		if err := sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Sender) chat(chatID int64) *chatQueue {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if len(s.chats) > maxIdleChats {
+		for id, q := range s.chats {
+			if now.Sub(q.lastUsed) > chatIdleTTL {
+				delete(s.chats, id)
+			}
+		}
+	}
+
+	q, ok := s.chats[chatID]
+	if !ok {
+		interval := chatInterval
+		if chatID < 0 {
+			interval = groupInterval
+		}
+		q = &chatQueue{limiter: newLimiter(interval)}
+		s.chats[chatID] = q
+	}
+	q.lastUsed = now
+	return q
+}
+
+func backoff(attempt int) time.Duration {
+	d := baseBackoff << (attempt - 1)
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// chatIDOf достаёт идентификатор чата из распространённых конфигураций.
+// Для остальных вызовов действует только общий лимит бота.
+func chatIDOf(c tgbotapi.Chattable) int64 {
+	switch v := c.(type) {
+	case tgbotapi.MessageConfig:
+		return v.ChatID
+	case tgbotapi.PhotoConfig:
+		return v.ChatID
+	case tgbotapi.VideoConfig:
+		return v.ChatID
+	case tgbotapi.DocumentConfig:
+		return v.ChatID
+	case tgbotapi.AnimationConfig:
+		return v.ChatID
+	case tgbotapi.AudioConfig:
+		return v.ChatID
+	case tgbotapi.VoiceConfig:
+		return v.ChatID
+	case tgbotapi.StickerConfig:
+		return v.ChatID
+	case tgbotapi.MediaGroupConfig:
+		return v.ChatID
+	case tgbotapi.EditMessageTextConfig:
+		return v.ChatID
+	case tgbotapi.EditMessageCaptionConfig:
+		return v.ChatID
+	case tgbotapi.EditMessageReplyMarkupConfig:
+		return v.ChatID
+	case tgbotapi.ChatActionConfig:
+		return v.ChatID
+	}
+	return 0
+}
@@ -1,12 +1,25 @@
 package config
 
 import (
+	"net"
 	"os"
 	"strconv"
 	"strings"
+	"time"
+)
+
+// Режимы получения обновлений ботами.
+const (
+	ModeWebhook = "webhook"
+	// ModePolling — getUpdates для каждого бота, для локальной разработки
+	// без публичного адреса
+	ModePolling = "polling"
 )
 
 type Config struct {
+	// Mode — ModeWebhook или ModePolling, задаётся MODE
+	Mode string
+
 	Redis      RedisConfig
 	Webhook    WebhookConfig
 	MTProto    MTProtoConfig
@@ -36,6 +49,18 @@ type PanelConfig struct {
 type WorkerBotsConfig struct {
 	DefaultRefCode string
 	BlockedPrefix  string
+	// Plan — тариф бота из BOT_PLAN, у которого нет владельца
+	Plan string
+
+	// TemplateRefresh — как часто шаблоны перечитываются из базы, если
+	// уведомление admin-bot об изменении не дошло
+	TemplateRefresh time.Duration
+
+	// WorkerID отличает воркер в реестре и в потоке команд admin-bot.
+	// Должен сохраняться между перезапусками
+	WorkerID string
+	// WorkerAddr — внутренний адрес воркера для пересылки обновлений
+	WorkerAddr string
 }
 
 type MTProtoConfig struct {
@@ -46,6 +71,7 @@ type MTProtoConfig struct {
 
 func Load() (*Config, error) {
 	cfg := &Config{
+		Mode: getEnv("MODE", ModeWebhook),
 		Redis: RedisConfig{
 			URL:      getEnv("REDIS_URL", "redis://localhost:6379"),
 			Password: getEnv("REDIS_PASSWORD", ""),
@@ -69,9 +95,18 @@ func Load() (*Config, error) {
 		WorkerBots: WorkerBotsConfig{
 			DefaultRefCode: getEnv("DEFAULT_REF_CODE", generateDefaultRefCode()),
 			BlockedPrefix:  getEnv("BLOCKED_PREFIX", "blocked:"),
+			Plan:           getEnv("BOT_PLAN", "free"),
+
+			TemplateRefresh: time.Duration(getEnvAsInt("TEMPLATE_CACHE_REFRESH", 60)) * time.Second,
+			WorkerID:        getEnv("WORKER_ID", hostname()),
+			WorkerAddr:      getEnv("WORKER_ADDR", ""),
 		},
 	}
 
+	if cfg.WorkerBots.WorkerAddr == "" {
+		cfg.WorkerBots.WorkerAddr = defaultWorkerAddr(cfg.Webhook.ListenAddr)
+	}
+
 	if err := validateConfig(cfg); err != nil {
 		return nil, err
 	}
@@ -81,11 +116,20 @@ func Load() (*Config, error) {
 
 func validateConfig(cfg *Config) error {
 	required := map[string]string{
-		"BOT_TOKEN":   cfg.Webhook.Token,
-		"WEBHOOK_URL": cfg.Webhook.URL,
-		"API_ID":      strconv.Itoa(cfg.MTProto.APIID),
-		"API_HASH":    cfg.MTProto.APIHash,
-		"PANEL_URL":   cfg.Panel.URL,
+		"BOT_TOKEN": cfg.Webhook.Token,
+		"API_ID":    strconv.Itoa(cfg.MTProto.APIID),
+		"API_HASH":  cfg.MTProto.APIHash,
+	}
+
+	switch cfg.Mode {
+	case ModeWebhook:
+		required["WEBHOOK_URL"] = cfg.Webhook.URL
+		required["PANEL_URL"] = cfg.Panel.URL
+	case ModePolling:
+		// Локально воркер не принимает запросов извне: ни вебхук, ни
+		// панель не нужны
+	default:
+		return newConfigError("MODE", "должен быть "+ModeWebhook+" или "+ModePolling)
 	}
 
 	for field, value := range required {
@@ -94,7 +138,7 @@ func validateConfig(cfg *Config) error {
 		}
 	}
 
-	if cfg.Webhook.SecretToken == "" {
+	if cfg.Mode == ModeWebhook && cfg.Webhook.SecretToken == "" {
 		return newConfigError("WEBHOOK_SECRET", "секретный токен обязателен для безопасности")
 	}
 
@@ -136,6 +180,27 @@ func getEnvAsInt(key string, defaultValue int) int {
 	return value
 }
 
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil {
+		return "worker"
+	}
+	return name
+}
+
+// defaultWorkerAddr строит адрес воркера из имени хоста и порта, который
+// он слушает.
+func defaultWorkerAddr(listenAddr string) string {
+	host, port, err := net.SplitHostPort(listenAddr)
+	if err != nil {
+		return ""
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = hostname()
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
+
 func generateDefaultRefCode() string {
 	return "ref_" + strconv.FormatInt(int64(os.Getpid()), 36)
 }
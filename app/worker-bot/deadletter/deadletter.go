@@ -0,0 +1,77 @@
+package deadletter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"shared/database"
+
+	"gorm.io/gorm"
+)
+
+// Этапы обработки обновления, на которых может произойти сбой.
+const (
+	StageDecode      = "decode"
+	StageLoadState   = "load_state"
+	StageHandle      = "handle"
+	StageCommitState = "commit_state"
+	// StagePanic — обработчик упал с паникой
+	StagePanic = "panic"
+)
+
+// StageError помечает ошибку этапом обработки.
+type StageError struct {
+	Stage string
+	Err   error
+}
+
+func (e *StageError) Error() string {
+	return e.Stage + ": " + e.Err.Error()
+}
+
+func (e *StageError) Unwrap() error {
+	return e.Err
+}
+
+func WithStage(stage string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &StageError{Stage: stage, Err: err}
+}
+
+// StageOf возвращает этап, на котором возникла ошибка.
+func StageOf(err error) string {
+	var stageErr *StageError
+	if errors.As(err, &stageErr) {
+		return stageErr.Stage
+	}
+	return StageHandle
+}
+
+// Save сохраняет необработанное обновление. Если payload не является
+// корректным JSON, он сохраняется как есть в raw_payload.
+func Save(ctx context.Context, db *gorm.DB, botID int64, updateID int, payload []byte, cause error) error {
+	letter := database.DeadLetter{
+		BotID:     botID,
+		UpdateID:  int64(updateID),
+		Stage:     StageOf(cause),
+		Error:     cause.Error(),
+		Status:    database.DeadLetterNew,
+		Attempts:  1,
+		CreatedAt: time.Now(),
+	}
+	if json.Valid(payload) {
+		letter.Payload = payload
+	} else {
+		letter.RawPayload = string(payload)
+	}
+
+	if err := db.WithContext(ctx).Create(&letter).Error; err != nil {
+		return fmt.Errorf("failed to save dead letter: %w", err)
+	}
+	return nil
+}
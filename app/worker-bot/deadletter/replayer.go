@@ -0,0 +1,166 @@
+package deadletter
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"shared/database"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	replayInterval  = 10 * time.Second
+	replayBatchSize = 20
+
+	// replayLeaseTime — сколько обновление может оставаться в replaying,
+	// прежде чем повтор считается прерванным
+	replayLeaseTime = 10 * time.Minute
+)
+
+// Replayer повторно обрабатывает обновления, которые администратор
+// отметил для повтора.
+type Replayer struct {
+	db     *gorm.DB
+	owns   func(botID int64) bool
+	handle func(ctx context.Context, botID int64, update tgbotapi.Update) error
+
+	// Bots, если задан, возвращает ботов этого процесса: повторы чужих
+	// ботов не выбираются.
+	Bots func() []int64
+}
+
+// NewReplayer создаёт Replayer. owns сообщает, обслуживает ли процесс бота,
+// handle прогоняет обновление через обычный конвейер обработки.
+func NewReplayer(db *gorm.DB, owns func(botID int64) bool, handle func(ctx context.Context, botID int64, update tgbotapi.Update) error) *Replayer {
+	return &Replayer{db: db, owns: owns, handle: handle}
+}
+
+func (r *Replayer) Run(ctx context.Context) {
+	ticker := time.NewTicker(replayInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.replayBatch(ctx); err != nil {
+			log.Printf("Dead letter replay error: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// replayBatch захватывает пачку обновлений и повторяет их. Захват —
+// короткая транзакция, переводящая обновления в replaying; обработчик
+// работает вне неё, результат каждого обновления сохраняется отдельно.
+func (r *Replayer) replayBatch(ctx context.Context) error {
+	if err := r.resetStale(ctx); err != nil {
+		return err
+	}
+	batch, err := r.claim(ctx)
+	if err != nil || len(batch) == 0 {
+		return err
+	}
+
+	// Результат сохраняется и после отмены ctx: обработанное обновление
+	// не должно повториться
+	saveCtx := context.WithoutCancel(ctx)
+	for i := range batch {
+		letter := &batch[i]
+		if ctx.Err() == nil {
+			r.replay(ctx, letter)
+		} else {
+			letter.Status = database.DeadLetterReplay
+		}
+		letter.ClaimedAt = nil
+		if err := r.db.WithContext(saveCtx).Save(letter).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// claim выбирает отмеченные для повтора обновления ботов этого процесса и
+// переводит их в replaying.
+func (r *Replayer) claim(ctx context.Context) ([]database.DeadLetter, error) {
+	var batch []database.DeadLetter
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		query := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ?", database.DeadLetterReplay)
+		if r.Bots != nil {
+			query = query.Where("bot_id IN ?", r.Bots())
+		}
+		var found []database.DeadLetter
+		err := query.
+			Order("id").
+			Limit(replayBatchSize).
+			Find(&found).Error
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		ids := make([]uint, 0, len(found))
+		for _, letter := range found {
+			if !r.owns(letter.BotID) {
+				continue
+			}
+			letter.Status = database.DeadLetterReplaying
+			letter.ClaimedAt = &now
+			batch = append(batch, letter)
+			ids = append(ids, letter.ID)
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		return tx.Model(&database.DeadLetter{}).
+			Where("id IN ?", ids).
+			Updates(map[string]any{"status": database.DeadLetterReplaying, "claimed_at": now}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return batch, nil
+}
+
+// resetStale возвращает администратору обновления, повтор которых
+// прервался: процесс упал или не смог сохранить результат. Повторять их
+// автоматически нельзя — обработчик мог уже отправить ответ.
+func (r *Replayer) resetStale(ctx context.Context) error {
+	return r.db.WithContext(ctx).Exec(`
+        UPDATE dead_letters
+        SET status = ?, error = ?, claimed_at = NULL
+        WHERE status = ? AND claimed_at < ?`,
+		database.DeadLetterNew, "replay interrupted, the update may have been partly processed",
+		database.DeadLetterReplaying, time.Now().Add(-replayLeaseTime)).Error
+}
+
+func (r *Replayer) replay(ctx context.Context, letter *database.DeadLetter) {
+	var update tgbotapi.Update
+	err := json.Unmarshal(letter.Payload, &update)
+	if err != nil {
+		err = WithStage(StageDecode, err)
+	} else {
+		err = r.handle(ctx, letter.BotID, update)
+	}
+
+	if err != nil {
+		log.Printf("Replay of dead letter %d failed: %v", letter.ID, err)
+		letter.Status = database.DeadLetterNew
+		letter.Stage = StageOf(err)
+		letter.Error = err.Error()
+		letter.Attempts++
+		return
+	}
+
+	now := time.Now()
+	letter.Status = database.DeadLetterReplayed
+	letter.ResolvedAt = &now
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"log"
+	"shared/database"
 	"worker-bot/config"
 	"worker-bot/models"
 	mtproto "worker-bot/mt-proto"
@@ -24,6 +25,15 @@ func main() {
 		}
 	}()
 
+	if err := database.Init(); err != nil {
+		log.Fatalf("Database init error: %v", err)
+	}
+	defer func() {
+		if err := database.Close(); err != nil {
+			log.Printf("Error closing database connection: %v", err)
+		}
+	}()
+
 	mtProtoConfig := mtproto.MTProtoConfig{
 		APIID:      cfg.MTProto.APIID,
 		APIHash:    cfg.MTProto.APIHash,
@@ -39,8 +49,17 @@ func main() {
 		Token:      cfg.Webhook.Token,
 		URL:        cfg.Webhook.URL,
 		ListenAddr: cfg.Webhook.ListenAddr,
+		Plan:       cfg.WorkerBots.Plan,
+
+		TemplateRefresh: cfg.WorkerBots.TemplateRefresh,
+		WorkerID:        cfg.WorkerBots.WorkerID,
+		WorkerAddr:      cfg.WorkerBots.WorkerAddr,
+
+		Polling: cfg.Mode == config.ModePolling,
 	}
 
 	log.Printf("Starting worker bot with config: %+v", cfg)
-	webhook.Start(webhookConfig, redis, mtpClient)
+	if err := webhook.Start(webhookConfig, redis, database.DB, mtpClient); err != nil {
+		log.Fatalf("Worker stopped: %v", err)
+	}
 }
@@ -15,6 +15,11 @@ const (
 	KeyBotState    = "bot:%d:state"
 	KeyBlockedBots = "blocked:bots:%d"
 	KeyUserSession = "user:%d:session:%s"
+	KeyBotUpdates  = "bot:%d:updates"
+	KeyUpdateClaim = "bot:%d:update:%d:claim"
+	KeyFloodNotice = "bot:%d:flood:%d"
+	// KeyChatState — кэш состояния диалога пользователя с ботом
+	KeyChatState = "bot:%d:chat:%d:state"
 )
 
 var (
@@ -47,6 +52,24 @@ type BotState struct {
 	RefCode     string    `json:"ref_code"`
 	LastActive  time.Time `json:"last_active"`
 	IsBlocked   bool      `json:"is_blocked"`
+	TemplateID  int64     `json:"template_id,omitempty"`
+
+	// Последний ответ пользователя и шаг, на котором он был принят.
+	// Нужны, чтобы повторно обработать ответ, если его отредактировали.
+	LastMessageID int    `json:"last_message_id,omitempty"`
+	LastInputStep string `json:"last_input_step,omitempty"`
+
+	// Vars — ответы пользователя в шаблонах по имени шаблона. Доступны в
+	// тексте шаблонов как {{var.имя}}.
+	Vars map[string]string `json:"vars,omitempty"`
+}
+
+// SetVar запоминает ответ пользователя в шаблоне name.
+func (s *BotState) SetVar(name, value string) {
+	if s.Vars == nil {
+		s.Vars = make(map[string]string)
+	}
+	s.Vars[name] = value
 }
 
 func (r *RedisStorage) SaveState(ctx context.Context, botID int64, state *BotState) error {
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"shared/database"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LoadChatState читает сохранённое в Postgres состояние пользователя.
+// Используется, когда в Redis нет актуальной копии.
+func LoadChatState(ctx context.Context, db *gorm.DB, botID, userID int64) (*BotState, error) {
+	var record database.ChatState
+	err := db.WithContext(ctx).
+		Where("bot_id = ? AND chat_id = ?", botID, userID).
+		First(&record).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to load chat state: %w", err)
+	}
+
+	var state BotState
+	if err := json.Unmarshal(record.StateData, &state); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal chat state: %w", err)
+	}
+	return &state, nil
+}
+
+// SaveChatState записывает состояние пользователя в Postgres. Вызывается
+// внутри транзакции вместе с записью исходящих сообщений.
+func SaveChatState(tx *gorm.DB, botID int64, state *BotState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to marshal chat state: %w", err)
+	}
+
+	now := time.Now()
+	record := database.ChatState{
+		ChatID:      state.UserID,
+		BotID:       uint(botID),
+		CurrentNode: state.CurrentStep,
+		StateData:   datatypes.JSON(data),
+		LastActive:  now,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "bot_id"}, {Name: "chat_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"current_node", "state_data", "last_active", "updated_at"}),
+	}).Create(&record).Error
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"strconv"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -24,8 +23,11 @@ func NewRedisClient(url string) (*RedisClient, error) {
 	}, nil
 }
 
-func (r *RedisClient) GetBotState(ctx context.Context, userID int64) (*BotState, error) {
-	key := "bot_state:" + strconv.FormatInt(userID, 10)
+// GetBotState возвращает закэшированное состояние диалога пользователя
+// userID с ботом botID. Состояние у каждого бота своё: пользователь может
+// одновременно проходить сценарии разных ботов.
+func (r *RedisClient) GetBotState(ctx context.Context, botID, userID int64) (*BotState, error) {
+	key := fmt.Sprintf(KeyChatState, botID, userID)
 	data, err := r.Get(ctx, key).Bytes()
 	if err != nil {
 		if err == redis.Nil {
@@ -42,7 +44,17 @@ func (r *RedisClient) GetBotState(ctx context.Context, userID int64) (*BotState,
 	return &state, nil
 }
 
-func (r *RedisClient) SaveBotState(ctx context.Context, state *BotState) error {
+// InvalidateBotState удаляет закэшированное состояние, чтобы следующее
+// чтение пошло в Postgres.
+func (r *RedisClient) InvalidateBotState(ctx context.Context, botID, userID int64) error {
+	key := fmt.Sprintf(KeyChatState, botID, userID)
+	if err := r.Del(ctx, key).Err(); err != nil {
+		return fmt.Errorf("failed to invalidate state in Redis: %w", err)
+	}
+	return nil
+}
+
+func (r *RedisClient) SaveBotState(ctx context.Context, botID int64, state *BotState) error {
 	state.LastActive = time.Now()
 
 	data, err := json.Marshal(state)
@@ -50,7 +62,7 @@ func (r *RedisClient) SaveBotState(ctx context.Context, state *BotState) error {
 		return fmt.Errorf("failed to marshal bot state: %w", err)
 	}
 
-	key := "bot_state:" + strconv.FormatInt(state.UserID, 10)
+	key := fmt.Sprintf(KeyChatState, botID, state.UserID)
 	if err := r.Set(ctx, key, data, 7*24*time.Hour).Err(); err != nil {
 		return fmt.Errorf("failed to save state to Redis: %w", err)
 	}
@@ -58,8 +70,8 @@ func (r *RedisClient) SaveBotState(ctx context.Context, state *BotState) error {
 	return nil
 }
 
-func (r *RedisClient) BlockUser(ctx context.Context, userID int64) error {
-	state, err := r.GetBotState(ctx, userID)
+func (r *RedisClient) BlockUser(ctx context.Context, botID, userID int64) error {
+	state, err := r.GetBotState(ctx, botID, userID)
 	if err != nil {
 		return err
 	}
@@ -74,5 +86,5 @@ func (r *RedisClient) BlockUser(ctx context.Context, userID int64) error {
 		state.IsBlocked = true
 	}
 
-	return r.SaveBotState(ctx, state)
+	return r.SaveBotState(ctx, botID, state)
 }
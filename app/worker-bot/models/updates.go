@@ -0,0 +1,85 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// UpdateDedupWindow покрывает срок, в течение которого Telegram хранит
+// и повторно доставляет неподтверждённые обновления.
+const UpdateDedupWindow = 24 * time.Hour
+
+// UpdateClaimTimeout — сколько обновление считается обрабатываемым. Если
+// процесс упал посреди обработки, повтор от Telegram будет принят после
+// этого срока.
+const UpdateClaimTimeout = 2 * time.Minute
+
+// UpdateClaim — результат ClaimUpdate.
+type UpdateClaim int
+
+const (
+	// UpdateClaimed — обновление взято в обработку
+	UpdateClaimed UpdateClaim = iota
+	// UpdateDone — обновление уже обработано
+	UpdateDone
+	// UpdateInProgress — обновление обрабатывает другой запрос
+	UpdateInProgress
+)
+
+// claimUpdateScript атомарно проверяет окно обработанных обновлений и
+// ставит отметку об обработке.
+var claimUpdateScript = redis.NewScript(`
+if redis.call('ZSCORE', KEYS[1], ARGV[1]) then
+    return 1
+end
+if redis.call('SET', KEYS[2], '1', 'NX', 'PX', ARGV[2]) then
+    return 0
+end
+return 2
+`)
+
+// ClaimUpdate берёт обновление в обработку. Отметка снимается MarkUpdate
+// после обработки или ReleaseUpdate, если обновление должно прийти снова.
+func (r *RedisClient) ClaimUpdate(ctx context.Context, botID int64, updateID int) (UpdateClaim, error) {
+	keys := []string{fmt.Sprintf(KeyBotUpdates, botID), fmt.Sprintf(KeyUpdateClaim, botID, updateID)}
+	res, err := claimUpdateScript.Run(ctx, r, keys, updateID, UpdateClaimTimeout.Milliseconds()).Int()
+	if err != nil {
+		return 0, fmt.Errorf("failed to claim update %d: %w", updateID, err)
+	}
+	return UpdateClaim(res), nil
+}
+
+// ReleaseUpdate снимает отметку об обработке, не записывая обновление в
+// обработанные.
+func (r *RedisClient) ReleaseUpdate(ctx context.Context, botID int64, updateID int) error {
+	if err := r.Del(ctx, fmt.Sprintf(KeyUpdateClaim, botID, updateID)).Err(); err != nil {
+		return fmt.Errorf("failed to release update %d: %w", updateID, err)
+	}
+	return nil
+}
+
+// MarkUpdate добавляет update_id в скользящее окно обработанных обновлений
+// бота и снимает отметку об обработке.
+func (r *RedisClient) MarkUpdate(ctx context.Context, botID int64, updateID int) error {
+	key := fmt.Sprintf(KeyBotUpdates, botID)
+	now := time.Now()
+
+	_, err := r.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRemRangeByScore(ctx, key, "-inf", strconv.FormatInt(now.Add(-UpdateDedupWindow).UnixMilli(), 10))
+		pipe.ZAdd(ctx, key, redis.Z{
+			Score:  float64(now.UnixMilli()),
+			Member: updateID,
+		})
+		pipe.Expire(ctx, key, UpdateDedupWindow)
+		pipe.Del(ctx, fmt.Sprintf(KeyUpdateClaim, botID, updateID))
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to mark update %d: %w", updateID, err)
+	}
+	return nil
+}
@@ -0,0 +1,316 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"shared/content"
+	"shared/database"
+	"shared/media"
+	"shared/sender"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	pollInterval = 5 * time.Second
+	batchSize    = 50
+	maxAttempts  = 8
+	maxRetryWait = 30 * time.Minute
+
+	// leaseTime — на сколько захваченные сообщения скрываются от других
+	// диспетчеров. Должно хватать на отправку пачки с повторами и загрузкой
+	// медиа
+	leaseTime = 10 * time.Minute
+)
+
+// Dispatcher доставляет сообщения из outbox. Несколько экземпляров могут
+// работать параллельно: строки захватываются через SKIP LOCKED и аренду.
+type Dispatcher struct {
+	db      *gorm.DB
+	senders func(botID int64) *sender.Sender
+	wake    chan struct{}
+
+	// OnBlocked вызывается, когда пользователь заблокировал бота.
+	OnBlocked func(ctx context.Context, botID, chatID int64)
+
+	// OnUnauthorized вызывается, когда Telegram отклонил токен бота.
+	OnUnauthorized func(ctx context.Context, botID int64, err error)
+
+	// Media нужна для сообщений, созданных FromStoredMedia.
+	Media *media.Library
+
+	// Bots, если задан, возвращает ботов этого процесса: диспетчер выбирает
+	// только их сообщения и не упирается в чужие.
+	Bots func() []int64
+}
+
+// NewDispatcher создаёт диспетчер. senders возвращает отправителя для бота
+// или nil, если бот обслуживается не этим процессом.
+func NewDispatcher(db *gorm.DB, senders func(botID int64) *sender.Sender) *Dispatcher {
+	return &Dispatcher{
+		db:      db,
+		senders: senders,
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// Wake запускает внеочередной проход, не дожидаясь таймера.
+func (d *Dispatcher) Wake() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		d.dispatch(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+func (d *Dispatcher) dispatch(ctx context.Context) {
+	for {
+		processed, err := d.dispatchBatch(ctx)
+		if err != nil {
+			log.Printf("Outbox dispatch error: %v", err)
+			return
+		}
+		if processed < batchSize {
+			return
+		}
+	}
+}
+
+// dispatchBatch захватывает пачку сообщений и доставляет их. Захват —
+// короткая транзакция, которая откладывает next_attempt_at на leaseTime:
+// другие диспетчеры эти сообщения не выберут, а сообщения упавшего
+// процесса вернутся в очередь, когда аренда истечёт. Отправка идёт вне
+// транзакции, результат каждого сообщения сохраняется отдельно.
+func (d *Dispatcher) dispatchBatch(ctx context.Context) (int, error) {
+	batch, leased, err := d.claim(ctx)
+	if err != nil || len(batch) == 0 {
+		return 0, err
+	}
+
+	// Результат сохраняется и после отмены ctx: отправленное сообщение
+	// не должно уйти повторно
+	saveCtx := context.WithoutCancel(ctx)
+
+	// После неудачи остальные сообщения того же чата возвращаются в
+	// очередь, но claim не выберет их раньше отложенного сообщения
+	stalled := make(map[int64]bool)
+	processed := 0
+	for i := range batch {
+		m := &batch[i]
+		out := d.senders(m.BotID)
+		if stalled[m.ChatID] || out == nil || ctx.Err() != nil {
+			if err := d.release(saveCtx, m, leased[m.ID]); err != nil {
+				return processed, err
+			}
+			continue
+		}
+
+		d.deliver(ctx, out, m)
+		if m.Status != database.OutboxSent {
+			stalled[m.ChatID] = true
+		}
+		if err := d.db.WithContext(saveCtx).Save(m).Error; err != nil {
+			return processed, err
+		}
+		processed++
+	}
+	return processed, nil
+}
+
+// claim выбирает готовые к отправке сообщения и берёт их в аренду.
+// Возвращает и прежние next_attempt_at, чтобы вернуть неотправленные.
+//
+// Сообщение не выбирается, пока в его чате есть более раннее сообщение,
+// которое ждёт повтора или взято в аренду: иначе оно обогнало бы
+// отложенное после ошибки.
+func (d *Dispatcher) claim(ctx context.Context) ([]database.OutboxMessage, map[uint]time.Time, error) {
+	var batch []database.OutboxMessage
+	leased := make(map[uint]time.Time)
+	err := d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		query := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", database.OutboxPending, now).
+			Where(`NOT EXISTS (
+                SELECT 1 FROM outbox_messages earlier
+                WHERE earlier.bot_id = outbox_messages.bot_id
+                  AND earlier.chat_id = outbox_messages.chat_id
+                  AND earlier.id < outbox_messages.id
+                  AND earlier.status = ?
+                  AND earlier.next_attempt_at > ?)`, database.OutboxPending, now)
+		if d.Bots != nil {
+			query = query.Where("bot_id IN ?", d.Bots())
+		}
+		err := query.
+			Order("id").
+			Limit(batchSize).
+			Find(&batch).Error
+		if err != nil || len(batch) == 0 {
+			return err
+		}
+
+		ids := make([]uint, len(batch))
+		for i, m := range batch {
+			ids[i] = m.ID
+			leased[m.ID] = m.NextAttemptAt
+		}
+		return tx.Model(&database.OutboxMessage{}).
+			Where("id IN ?", ids).
+			Update("next_attempt_at", now.Add(leaseTime)).Error
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return batch, leased, nil
+}
+
+// release возвращает неотправленное сообщение в очередь с прежним временем.
+func (d *Dispatcher) release(ctx context.Context, m *database.OutboxMessage, at time.Time) error {
+	return d.db.WithContext(ctx).Model(m).Update("next_attempt_at", at).Error
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, out *sender.Sender, m *database.OutboxMessage) {
+	m.Attempts++
+
+	var params tgbotapi.Params
+	err := json.Unmarshal(m.Params, &params)
+	if err != nil {
+		err = fmt.Errorf("%w: invalid params: %w", sender.ErrPermanent, err)
+	} else {
+		if _, ok := params[mediaIDParam]; ok {
+			err = d.sendStored(ctx, out, m, params)
+		} else {
+			_, err = out.Call(ctx, m.ChatID, m.Method, params)
+		}
+	}
+
+	now := time.Now()
+	switch {
+	case err == nil:
+		m.Status = database.OutboxSent
+		m.SentAt = &now
+		m.LastError = ""
+	case errors.Is(err, sender.ErrUnauthorized):
+		// Сообщение ждёт нового токена: бот отключается, и его сообщения
+		// не выбираются, пока бота не запустят снова. Попытка не считается
+		m.LastError = err.Error()
+		m.NextAttemptAt = now.Add(retryDelay(m.Attempts))
+		m.Attempts--
+		if d.OnUnauthorized != nil {
+			d.OnUnauthorized(ctx, m.BotID, err)
+		}
+	case sender.IsPermanent(err) || m.Attempts >= maxAttempts:
+		m.Status = database.OutboxFailed
+		m.LastError = err.Error()
+		m.ErrorKind = errorKind(err)
+		log.Printf("Outbox message %d to chat %d failed permanently: %v", m.ID, m.ChatID, err)
+		if errors.Is(err, sender.ErrBlocked) && d.OnBlocked != nil {
+			d.OnBlocked(ctx, m.BotID, m.ChatID)
+		}
+	default:
+		m.LastError = err.Error()
+		m.NextAttemptAt = now.Add(retryDelay(m.Attempts))
+	}
+}
+
+// sendStored отправляет файл медиатеки. Если бот отправляет файл впервые,
+// файл загружается из хранилища, а полученный file_id запоминается для бота.
+func (d *Dispatcher) sendStored(ctx context.Context, out *sender.Sender, m *database.OutboxMessage, params tgbotapi.Params) error {
+	if d.Media == nil {
+		return fmt.Errorf("%w: media library is not configured", sender.ErrPermanent)
+	}
+
+	mediaID, err := strconv.ParseInt(params[mediaIDParam], 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: invalid media id %q", sender.ErrPermanent, params[mediaIDParam])
+	}
+	_, field, ok := content.MediaMethod(params[mediaTypeParam])
+	if !ok {
+		return fmt.Errorf("%w: unsupported media type %q", sender.ErrPermanent, params[mediaTypeParam])
+	}
+	delete(params, mediaIDParam)
+	delete(params, mediaTypeParam)
+
+	fileID, err := d.Media.FileID(ctx, mediaID, m.BotID)
+	if err != nil {
+		return err
+	}
+	if fileID != "" {
+		params[field] = fileID
+		_, err = out.Call(ctx, m.ChatID, m.Method, params)
+		return err
+	}
+
+	file, data, err := d.Media.Load(ctx, mediaID)
+	if err != nil {
+		return err
+	}
+	name := file.FileName
+	if name == "" {
+		name = file.Kind
+	}
+
+	resp, err := out.Upload(ctx, m.ChatID, m.Method, params, []tgbotapi.RequestFile{{
+		Name: field,
+		Data: tgbotapi.FileBytes{Name: name, Bytes: data},
+	}})
+	if err != nil {
+		return err
+	}
+
+	var sent tgbotapi.Message
+	if err := json.Unmarshal(resp.Result, &sent); err != nil {
+		log.Printf("Error decoding uploaded media %d: %v", mediaID, err)
+		return nil
+	}
+	if fileID := content.FromMessage(&sent).MediaFileID; fileID != "" {
+		if err := d.Media.SaveFileID(ctx, mediaID, m.BotID, fileID); err != nil {
+			log.Printf("Error caching media %d for bot %d: %v", mediaID, m.BotID, err)
+		}
+	}
+	return nil
+}
+
+// errorKind определяет вид ошибки недоставленного сообщения.
+func errorKind(err error) string {
+	switch {
+	case errors.Is(err, sender.ErrBlocked):
+		return database.OutboxErrorBlocked
+	case errors.Is(err, sender.ErrChatNotFound):
+		return database.OutboxErrorChatNotFound
+	case sender.IsPermanent(err):
+		return database.OutboxErrorPermanent
+	default:
+		return database.OutboxErrorRetries
+	}
+}
+
+func retryDelay(attempt int) time.Duration {
+	d := 10 * time.Second << (attempt - 1)
+	if d > maxRetryWait || d <= 0 {
+		d = maxRetryWait
+	}
+	return d
+}
@@ -0,0 +1,173 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"shared/content"
+	"shared/database"
+	"worker-bot/models"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"gorm.io/gorm"
+)
+
+// Message — отложенный вызов Bot API в сериализуемом виде.
+type Message struct {
+	ChatID int64
+	Method string
+	Params tgbotapi.Params
+}
+
+// FromMessage переводит конфигурацию текстового сообщения в параметры sendMessage.
+func FromMessage(msg tgbotapi.MessageConfig) (Message, error) {
+	params := make(tgbotapi.Params)
+	if err := params.AddFirstValid("chat_id", msg.ChatID, msg.ChannelUsername); err != nil {
+		return Message{}, err
+	}
+	params.AddNonEmpty("text", msg.Text)
+	params.AddNonEmpty("parse_mode", msg.ParseMode)
+	params.AddBool("disable_web_page_preview", msg.DisableWebPagePreview)
+	params.AddBool("disable_notification", msg.DisableNotification)
+	params.AddNonZero("reply_to_message_id", msg.ReplyToMessageID)
+	if err := params.AddInterface("entities", msg.Entities); err != nil {
+		return Message{}, err
+	}
+	if err := params.AddInterface("reply_markup", msg.ReplyMarkup); err != nil {
+		return Message{}, err
+	}
+
+	return Message{ChatID: msg.ChatID, Method: "sendMessage", Params: params}, nil
+}
+
+// FromMedia переводит отправку медиа по file_id в параметры sendPhoto,
+// sendVideo, sendDocument или sendAnimation.
+func FromMedia(chatID int64, mediaType, fileID, caption, parseMode string, markup interface{}) (Message, error) {
+	method, field, ok := content.MediaMethod(mediaType)
+	if !ok {
+		return Message{}, fmt.Errorf("unsupported media type %q", mediaType)
+	}
+
+	params := make(tgbotapi.Params)
+	params.AddNonZero64("chat_id", chatID)
+	params.AddNonEmpty(field, fileID)
+	params.AddNonEmpty("caption", caption)
+	params.AddNonEmpty("parse_mode", parseMode)
+	if err := params.AddInterface("reply_markup", markup); err != nil {
+		return Message{}, err
+	}
+
+	return Message{ChatID: chatID, Method: method, Params: params}, nil
+}
+
+// mediaIDParam и mediaTypeParam отмечают сообщение с файлом медиатеки.
+// Dispatcher заменяет их на file_id бота или загружает файл.
+const (
+	mediaIDParam   = "media_id"
+	mediaTypeParam = "media_type"
+)
+
+// FromStoredMedia готовит отправку файла медиатеки. Сам файл или file_id
+// подставляется при доставке, потому что загрузка зависит от бота.
+func FromStoredMedia(chatID int64, mediaType string, mediaID int64, caption, parseMode string, markup interface{}) (Message, error) {
+	method, _, ok := content.MediaMethod(mediaType)
+	if !ok {
+		return Message{}, fmt.Errorf("unsupported media type %q", mediaType)
+	}
+
+	params := make(tgbotapi.Params)
+	params.AddNonZero64("chat_id", chatID)
+	params.AddNonZero64(mediaIDParam, mediaID)
+	params.AddNonEmpty(mediaTypeParam, mediaType)
+	params.AddNonEmpty("caption", caption)
+	params.AddNonEmpty("parse_mode", parseMode)
+	if err := params.AddInterface("reply_markup", markup); err != nil {
+		return Message{}, err
+	}
+
+	return Message{ChatID: chatID, Method: method, Params: params}, nil
+}
+
+// FromEdit переводит конфигурацию изменения текста в параметры editMessageText.
+func FromEdit(edit tgbotapi.EditMessageTextConfig) (Message, error) {
+	params := make(tgbotapi.Params)
+	if edit.InlineMessageID == "" {
+		if err := params.AddFirstValid("chat_id", edit.ChatID, edit.ChannelUsername); err != nil {
+			return Message{}, err
+		}
+		params.AddNonZero("message_id", edit.MessageID)
+	} else {
+		params.AddNonEmpty("inline_message_id", edit.InlineMessageID)
+	}
+	params.AddNonEmpty("text", edit.Text)
+	params.AddNonEmpty("parse_mode", edit.ParseMode)
+	params.AddBool("disable_web_page_preview", edit.DisableWebPagePreview)
+	if err := params.AddInterface("entities", edit.Entities); err != nil {
+		return Message{}, err
+	}
+	if err := params.AddInterface("reply_markup", edit.ReplyMarkup); err != nil {
+		return Message{}, err
+	}
+
+	return Message{ChatID: edit.ChatID, Method: "editMessageText", Params: params}, nil
+}
+
+// FromEditMarkup переводит конфигурацию изменения клавиатуры в параметры
+// editMessageReplyMarkup.
+func FromEditMarkup(edit tgbotapi.EditMessageReplyMarkupConfig) (Message, error) {
+	params := make(tgbotapi.Params)
+	if err := params.AddFirstValid("chat_id", edit.ChatID, edit.ChannelUsername); err != nil {
+		return Message{}, err
+	}
+	params.AddNonZero("message_id", edit.MessageID)
+	params.AddNonEmpty("inline_message_id", edit.InlineMessageID)
+	if err := params.AddInterface("reply_markup", edit.ReplyMarkup); err != nil {
+		return Message{}, err
+	}
+
+	return Message{ChatID: edit.ChatID, Method: "editMessageReplyMarkup", Params: params}, nil
+}
+
+// Commit сохраняет состояние пользователя и его исходящие сообщения в одной
+// транзакции. Сообщения отправит Dispatcher, даже если процесс упадёт сразу
+// после коммита.
+func Commit(ctx context.Context, db *gorm.DB, botID int64, state *models.BotState, msgs []Message) error {
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := models.SaveChatState(tx, botID, state); err != nil {
+			return err
+		}
+		return Enqueue(tx, botID, msgs)
+	})
+}
+
+// Enqueue добавляет сообщения в outbox в рамках переданной транзакции.
+func Enqueue(tx *gorm.DB, botID int64, msgs []Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	rows := make([]database.OutboxMessage, 0, len(msgs))
+	for _, m := range msgs {
+		params, err := json.Marshal(m.Params)
+		if err != nil {
+			return fmt.Errorf("failed to marshal outbox params: %w", err)
+		}
+		rows = append(rows, database.OutboxMessage{
+			BotID:         botID,
+			ChatID:        m.ChatID,
+			Method:        m.Method,
+			Params:        params,
+			Status:        database.OutboxPending,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+		})
+	}
+
+	if err := tx.Create(&rows).Error; err != nil {
+		return fmt.Errorf("failed to enqueue outbox messages: %w", err)
+	}
+	return nil
+}
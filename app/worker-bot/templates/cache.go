@@ -0,0 +1,168 @@
+package templates
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	sharedredis "shared/redis"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// cache хранит загруженные шаблоны, чтобы не обращаться к Postgres на
+// каждое обновление. admin-bot сбрасывает записи через Redis pub/sub, а
+// refresh ограничивает возраст записи, если уведомление потерялось.
+type cache struct {
+	mu      sync.Mutex
+	refresh time.Duration
+	// generation растёт при каждом сбросе: загрузка, начатая до сброса,
+	// не должна вернуть в кэш устаревший шаблон
+	generation uint64
+
+	byID   map[int64]cacheEntry
+	byName map[nameKey]cacheEntry
+	bound  map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	// template равен nil, если шаблона нет: отсутствие тоже кэшируется
+	template *Template
+	loadedAt time.Time
+}
+
+type nameKey struct {
+	userID int64
+	name   string
+}
+
+var templateCache = &cache{
+	byID:   make(map[int64]cacheEntry),
+	byName: make(map[nameKey]cacheEntry),
+	bound:  make(map[string]cacheEntry),
+}
+
+// EnableCache включает кэш шаблонов. Записи старше refresh загружаются
+// заново.
+func EnableCache(refresh time.Duration) {
+	templateCache.mu.Lock()
+	defer templateCache.mu.Unlock()
+	templateCache.refresh = refresh
+}
+
+// Watch сбрасывает кэш по событиям admin-bot до отмены ctx. После
+// (пере)подключения к Redis кэш сбрасывается целиком: события за время
+// разрыва потеряны.
+func Watch(ctx context.Context, cli *redis.Client) {
+	pubsub := cli.Subscribe(ctx, sharedredis.TemplateEventsChannel)
+	defer pubsub.Close()
+
+	for {
+		msg, err := pubsub.Receive(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("Template events subscription error: %v", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+
+		switch m := msg.(type) {
+		case *redis.Subscription:
+			templateCache.flush()
+		case *redis.Message:
+			event, err := sharedredis.ParseTemplateEvent(m.Payload)
+			if err != nil {
+				log.Printf("Skipping template event: %v", err)
+				continue
+			}
+			templateCache.invalidate(event)
+		}
+	}
+}
+
+// cached возвращает шаблон из кэша или загружает его через load.
+func cached[K comparable](c *cache, entries func() map[K]cacheEntry, key K, load func() (*Template, error)) (*Template, error) {
+	c.mu.Lock()
+	if c.refresh > 0 {
+		if entry, ok := entries()[key]; ok && time.Since(entry.loadedAt) <= c.refresh {
+			c.mu.Unlock()
+			return entry.template, nil
+		}
+	}
+	generation := c.generation
+	c.mu.Unlock()
+
+	template, err := load()
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	if c.refresh > 0 && generation == c.generation {
+		entries()[key] = cacheEntry{template: template, loadedAt: time.Now()}
+	}
+	c.mu.Unlock()
+	return template, nil
+}
+
+// Invalidate сбрасывает записи, которые могло затронуть событие, так же
+// как уведомление admin-bot.
+func Invalidate(event sharedredis.TemplateEvent) {
+	templateCache.invalidate(event)
+}
+
+func (c *cache) flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	c.byID = make(map[int64]cacheEntry)
+	c.byName = make(map[nameKey]cacheEntry)
+	c.bound = make(map[string]cacheEntry)
+}
+
+// invalidate сбрасывает записи, которые могло затронуть событие. Шаблоны
+// ссылаются друг на друга по имени, поэтому изменение шаблона сбрасывает
+// все шаблоны владельца.
+func (c *cache) invalidate(event sharedredis.TemplateEvent) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+
+	switch event.Kind {
+	case sharedredis.EventBindingChanged:
+		prefix := strconv.FormatInt(event.BotID, 10) + ":"
+		for token := range c.bound {
+			if strings.HasPrefix(token, prefix) {
+				delete(c.bound, token)
+			}
+		}
+	default:
+		owned := func(e cacheEntry) bool {
+			return e.template == nil || e.template.UserID == event.OwnerID || e.template.ID == event.TemplateID
+		}
+		for id, e := range c.byID {
+			if id == event.TemplateID || owned(e) {
+				delete(c.byID, id)
+			}
+		}
+		for key := range c.byName {
+			if key.userID == event.OwnerID {
+				delete(c.byName, key)
+			}
+		}
+		for token, e := range c.bound {
+			if owned(e) {
+				delete(c.bound, token)
+			}
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package templates
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"shared/database"
+	"shared/keyboard"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"gorm.io/gorm"
+)
+
+type Template struct {
+	ID       int64
+	UserID   int64
+	Name     string
+	Content  string
+	Keyboard *keyboard.Keyboard
+
+	ParseMode   string
+	MediaType   string
+	MediaFileID string
+	// MediaID — файл медиатеки, 0 у шаблонов без медиа и старых шаблонов
+	MediaID int64
+}
+
+// Bound возвращает шаблон, выбранный для бота при его создании.
+func Bound(ctx context.Context, db *gorm.DB, botToken string) (*Template, error) {
+	return cached(templateCache, func() map[string]cacheEntry { return templateCache.bound }, botToken, func() (*Template, error) {
+		return find(db.WithContext(ctx).
+			Joins("JOIN bots ON bots.template_id = bot_templates.id").
+			Where("bots.bot_token = ?", botToken))
+	})
+}
+
+func ByID(ctx context.Context, db *gorm.DB, id int64) (*Template, error) {
+	return cached(templateCache, func() map[int64]cacheEntry { return templateCache.byID }, id, func() (*Template, error) {
+		return find(db.WithContext(ctx).Where("bot_templates.id = ?", id))
+	})
+}
+
+// ByName ищет шаблон владельца по имени. Так кнопки ссылаются на шаблоны,
+// к которым ведут. Из одноимённых шаблонов выбирается активный с
+// наименьшим ID — по тому же правилу admin-bot строит меню команд
+// (см. commands.Prefer).
+func ByName(ctx context.Context, db *gorm.DB, userID int64, name string) (*Template, error) {
+	return cached(templateCache, func() map[nameKey]cacheEntry { return templateCache.byName }, nameKey{userID, name}, func() (*Template, error) {
+		return find(db.WithContext(ctx).
+			Where("bot_templates.user_id = ? AND bot_templates.name = ? AND bot_templates.is_active", userID, name).
+			Order("bot_templates.id"))
+	})
+}
+
+func find(query *gorm.DB) (*Template, error) {
+	var record database.BotTemplate
+	if err := query.First(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to load template: %w", err)
+	}
+
+	kb, err := keyboard.Parse(record.Keyboard)
+	if err != nil {
+		return nil, fmt.Errorf("template %d: %w", record.ID, err)
+	}
+
+	var mediaID int64
+	if record.MediaID != nil {
+		mediaID = int64(*record.MediaID)
+	}
+
+	return &Template{
+		ID:       int64(record.ID),
+		UserID:   record.UserID,
+		Name:     record.Name,
+		Content:  record.Content,
+		Keyboard: kb,
+
+		ParseMode:   record.ParseMode,
+		MediaType:   record.MediaType,
+		MediaFileID: record.MediaFileID,
+		MediaID:     mediaID,
+	}, nil
+}
+
+// Message строит текстовое сообщение шаблона для чата. Шаблоны с медиа
+// отправляются через outbox.FromStoredMedia.
+func (t *Template) Message(chatID int64) tgbotapi.MessageConfig {
+	msg := tgbotapi.NewMessage(chatID, t.Content)
+	msg.ParseMode = t.ParseMode
+	if markup := t.Keyboard.Markup(t.ID); markup != nil {
+		msg.ReplyMarkup = markup
+	}
+	return msg
+}
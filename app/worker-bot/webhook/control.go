@@ -0,0 +1,67 @@
+package webhook
+
+import (
+	"context"
+	"log"
+	sharedredis "shared/redis"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// controlBlock — сколько воркер ждёт новых команд за один запрос к Redis.
+const controlBlock = 5 * time.Second
+
+// runControl выполняет команды admin-bot для ботов, назначенных воркеру,
+// до отмены ctx и подтверждает каждую статусом бота.
+func runControl(ctx context.Context, bots *fleet, cli *redis.Client, worker string) {
+	for {
+		// Пока воркер не знает состава воркеров, он не знает и своих ботов
+		if !bots.ready() {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+
+		commands, err := sharedredis.ReadCommands(ctx, cli, worker, controlBlock)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("Control commands error: %v", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+
+		for _, command := range commands {
+			if !bots.assigned(command.BotID) {
+				// Команду выполнит воркер бота. Остановку выполняют все:
+				// бот мог ещё не уехать отсюда
+				if command.Command == sharedredis.CommandStopBot {
+					bots.stop(command.BotID)
+				}
+				if err := sharedredis.SkipCommand(ctx, cli, command, worker); err != nil {
+					log.Printf("Error skipping command %s: %v", command.ID, err)
+				}
+				continue
+			}
+
+			state, err := bots.execute(ctx, command)
+			if err != nil {
+				log.Printf("Command %s for bot %d failed: %v", command.Command, command.BotID, err)
+			} else {
+				log.Printf("Command %s for bot %d done, bot is %s", command.Command, command.BotID, state)
+			}
+			if err := sharedredis.AckCommand(ctx, cli, command, worker, state, err); err != nil {
+				log.Printf("Error acking command %s: %v", command.ID, err)
+			}
+		}
+	}
+}
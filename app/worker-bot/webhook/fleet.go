@@ -0,0 +1,374 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	sharedredis "shared/redis"
+	"shared/sender"
+	"strconv"
+	"strings"
+	"sync"
+	"worker-bot/templates"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// forwardedHeader помечает обновление, которое другой воркер переслал
+// воркеру бота. Пересланное обновление дальше не пересылается.
+const forwardedHeader = "X-Worker-Forwarded"
+
+var errBotInactive = errors.New("bot is disabled or deleted")
+
+// fleet — боты, которые обслуживает воркер. admin-bot регистрирует вебхук
+// ботов владельцев как /webhook/<токен>, по токену выбирается обработчик.
+// Каждый бот назначен одному живому воркеру (см. sharedredis.AssignBot),
+// обновления чужих ботов пересылаются их воркеру.
+type fleet struct {
+	mu      sync.RWMutex
+	byID    map[int64]*processor
+	byToken map[string]*processor
+	// workers — живые воркеры по последнему опросу реестра
+	workers []sharedredis.Worker
+	// health — супервизоры ботов, переживают перезапуски обработчиков
+	health map[int64]*supervisor
+
+	// base — обработчик без бота: общие зависимости, которые копируются
+	// в обработчик каждого бота
+	base *processor
+	cli  *redis.Client
+	self sharedredis.Worker
+	// webhookURL — общий адрес, на который Telegram шлёт обновления ботов
+	webhookURL string
+	// polling — боты получают обновления через getUpdates, а не вебхук
+	polling bool
+	// pinned — бот из BOT_TOKEN, его обслуживает каждый воркер
+	pinned      int64
+	pinnedToken string
+	// pinnedHooked — этот воркер настроил получение обновлений бота из
+	// BOT_TOKEN: его вебхук ставит только воркер, которому бот назначен
+	pinnedHooked bool
+}
+
+func newFleet(base *processor, cli *redis.Client, self sharedredis.Worker, webhookURL string, polling bool) *fleet {
+	return &fleet{
+		byID:       make(map[int64]*processor),
+		byToken:    make(map[string]*processor),
+		health:     make(map[int64]*supervisor),
+		base:       base,
+		cli:        cli,
+		self:       self,
+		webhookURL: webhookURL,
+		polling:    polling,
+	}
+}
+
+// botRecord — строка таблицы bots, нужная воркеру.
+type botRecord struct {
+	UserID   int64
+	BotToken string
+	IsActive bool
+}
+
+func loadBot(ctx context.Context, db *gorm.DB, botID int64) (*botRecord, error) {
+	var records []botRecord
+	err := db.WithContext(ctx).Raw(`
+        SELECT user_id, bot_token, is_active FROM bots
+        WHERE split_part(bot_token, ':', 1)::bigint = ?`, botID).Scan(&records).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load bot %d: %w", botID, err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	return &records[0], nil
+}
+
+// pin назначает бота из BOT_TOKEN. Он не назначается воркерам, не
+// останавливается командами и получает обновления на /webhook.
+func (f *fleet) pin(token string) int64 {
+	botID, _ := strconv.ParseInt(strings.SplitN(token, ":", 2)[0], 10, 64)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pinned = botID
+	f.pinnedToken = token
+	return botID
+}
+
+func (f *fleet) get(botID int64) *processor {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.byID[botID]
+}
+
+func (f *fleet) owns(botID int64) bool {
+	return f.get(botID) != nil
+}
+
+// running возвращает ботов, которых сейчас обслуживает воркер.
+func (f *fleet) running() []int64 {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	ids := make([]int64, 0, len(f.byID))
+	for id := range f.byID {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// sender возвращает отправителя бота для outbox.
+func (f *fleet) sender(botID int64) *sender.Sender {
+	if p := f.get(botID); p != nil {
+		return p.out
+	}
+	return nil
+}
+
+// ownerOf возвращает воркер, которому назначен бот.
+func (f *fleet) ownerOf(botID int64) (sharedredis.Worker, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return sharedredis.AssignBot(botID, f.workers)
+}
+
+// ready сообщает, прочитан ли реестр воркеров.
+func (f *fleet) ready() bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return len(f.workers) > 0
+}
+
+// assigned сообщает, назначен ли бот этому воркеру.
+func (f *fleet) assigned(botID int64) bool {
+	owner, ok := f.ownerOf(botID)
+	return ok && owner.ID == f.self.ID
+}
+
+// start запускает бота и сообщает результат его супервизору. Если бот уже
+// работает с тем же токеном, обработчик заменяется, только когда force.
+// Бот с отклонённым токеном отключается: перезапуск ему не поможет.
+func (f *fleet) start(ctx context.Context, botID int64, force bool) error {
+	s := f.supervisor(botID)
+	if err := f.launch(ctx, botID, force); err != nil {
+		if sender.IsUnauthorized(err) && botID != f.pinned {
+			f.revoke(ctx, botID, err)
+			return err
+		}
+		s.startFailed(err)
+		return err
+	}
+	s.started()
+	return nil
+}
+
+// launch создаёт обработчик бота с токеном из базы.
+func (f *fleet) launch(ctx context.Context, botID int64, force bool) error {
+	record := &botRecord{BotToken: f.pinnedToken, IsActive: true}
+	path := "/webhook"
+	if botID != f.pinned {
+		var err error
+		if record, err = loadBot(ctx, f.base.db, botID); err != nil {
+			return err
+		}
+		if record == nil || !record.IsActive {
+			return errBotInactive
+		}
+		path += "/" + record.BotToken
+	}
+
+	if p := f.get(botID); p != nil && p.bot.Token == record.BotToken && !force {
+		return nil
+	}
+
+	// NewBotAPI вызывает getMe и заодно проверяет токен
+	bot, err := tgbotapi.NewBotAPI(record.BotToken)
+	if err != nil {
+		return fmt.Errorf("failed to authorize bot %d: %w", botID, err)
+	}
+
+	// Бота из BOT_TOKEN запускает каждый воркер, а вебхук ставит
+	// назначенный: до назначения его поставит reconcile
+	if botID != f.pinned || f.assigned(botID) {
+		if err := f.receiveUpdates(bot, path); err != nil {
+			return fmt.Errorf("failed to set up updates of bot %d: %w", botID, err)
+		}
+		if botID == f.pinned {
+			f.setPinnedHooked(true)
+		}
+	}
+
+	p := *f.base
+	p.bot = bot
+	p.out = sender.New(bot)
+	p.ownerID = record.UserID
+	p.sup = f.supervisor(botID)
+
+	if f.polling {
+		f.startPolling(&p)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if old := f.byID[botID]; old != nil {
+		delete(f.byToken, old.bot.Token)
+		old.halt()
+	}
+	f.byID[botID] = &p
+	f.byToken[bot.Token] = &p
+	return nil
+}
+
+// receiveUpdates настраивает получение обновлений бота. Вебхук ставит
+// воркер, которому назначен бот, поэтому setWebhook вызывает ровно один
+// экземпляр, адрес у всех воркеров общий. Для бота из BOT_TOKEN это
+// обеспечивают launch и hookPinned. В режиме polling вебхук
+// снимается: пока он установлен, getUpdates не работает.
+func (f *fleet) receiveUpdates(bot *tgbotapi.BotAPI, path string) error {
+	if f.polling {
+		_, err := bot.Request(tgbotapi.DeleteWebhookConfig{})
+		return err
+	}
+
+	wh, err := tgbotapi.NewWebhook(f.webhookURL + path)
+	if err != nil {
+		return err
+	}
+	wh.AllowedUpdates = allowedUpdates
+	_, err = bot.Request(wh)
+	return err
+}
+
+func (f *fleet) setPinnedHooked(hooked bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pinnedHooked = hooked
+}
+
+// hookPinned настраивает получение обновлений бота из BOT_TOKEN, когда он
+// назначен этому воркеру. Воркер, у которого бота забрали, поставит
+// вебхук снова, если бот к нему вернётся.
+func (f *fleet) hookPinned() {
+	if !f.assigned(f.pinned) {
+		f.setPinnedHooked(false)
+		return
+	}
+
+	f.mu.RLock()
+	p, hooked := f.byID[f.pinned], f.pinnedHooked
+	f.mu.RUnlock()
+	if p == nil || hooked {
+		// Незапущенного бота запустит супервизор, и launch поставит вебхук
+		return
+	}
+	if err := f.receiveUpdates(p.bot, "/webhook"); err != nil {
+		log.Printf("Error setting up updates of bot %d: %v", f.pinned, err)
+		return
+	}
+	f.setPinnedHooked(true)
+}
+
+// stop отключает бота. Сообщения из outbox для него ждут следующего запуска.
+func (f *fleet) stop(botID int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if botID == f.pinned {
+		return
+	}
+	if p := f.byID[botID]; p != nil {
+		delete(f.byToken, p.bot.Token)
+		delete(f.byID, botID)
+		p.halt()
+	}
+	delete(f.health, botID)
+}
+
+// reload сбрасывает кэш шаблонов бота и его владельца.
+func (f *fleet) reload(botID int64) error {
+	p := f.get(botID)
+	if p == nil {
+		return fmt.Errorf("bot %d is not running", botID)
+	}
+	templates.Invalidate(sharedredis.TemplateEvent{Kind: sharedredis.EventBindingChanged, BotID: botID})
+	templates.Invalidate(sharedredis.TemplateEvent{Kind: sharedredis.EventTemplateChanged, OwnerID: p.ownerID})
+	return nil
+}
+
+// execute выполняет команду admin-bot и возвращает состояние бота после неё.
+func (f *fleet) execute(ctx context.Context, command sharedredis.ControlCommand) (sharedredis.BotState, error) {
+	switch command.Command {
+	case sharedredis.CommandStartBot, sharedredis.CommandRotateToken:
+		if err := f.start(ctx, command.BotID, false); err != nil {
+			return sharedredis.BotFailed, err
+		}
+		return sharedredis.BotRunning, nil
+	case sharedredis.CommandStopBot:
+		f.stop(command.BotID)
+		return sharedredis.BotStopped, nil
+	case sharedredis.CommandReloadTemplate:
+		if err := f.reload(command.BotID); err != nil {
+			return sharedredis.BotStopped, err
+		}
+		return sharedredis.BotRunning, nil
+	}
+
+	state := sharedredis.BotStopped
+	if f.owns(command.BotID) {
+		state = sharedredis.BotRunning
+	}
+	return state, fmt.Errorf("unknown command %q", command.Command)
+}
+
+// ServeHTTP передаёт обновление обработчику бота из пути /webhook/<токен>
+// или пересылает его воркеру, которому назначен бот.
+func (f *fleet) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.URL.Path, "/webhook/")
+
+	f.mu.RLock()
+	p := f.byToken[token]
+	if r.URL.Path == "/webhook" {
+		p = f.byID[f.pinned]
+	}
+	f.mu.RUnlock()
+
+	if p != nil {
+		p.ServeHTTP(w, r)
+		return
+	}
+
+	// Пересылка только одна: если реестры воркеров расходятся, обновление
+	// не будет ходить по кругу
+	if r.Header.Get(forwardedHeader) == "" {
+		botID, _ := strconv.ParseInt(strings.SplitN(token, ":", 2)[0], 10, 64)
+		if owner, ok := f.ownerOf(botID); ok && owner.ID != f.self.ID && owner.Addr != "" {
+			f.forward(w, r, owner)
+			return
+		}
+	}
+
+	// Бот остановлен или переезжает на другой воркер: Telegram повторит
+	// доставку
+	w.WriteHeader(http.StatusServiceUnavailable)
+}
+
+func (f *fleet) forward(w http.ResponseWriter, r *http.Request, owner sharedredis.Worker) {
+	target, err := url.Parse(owner.Addr)
+	if err != nil {
+		log.Printf("Invalid address of worker %s: %v", owner.ID, err)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		log.Printf("Error forwarding update to worker %s: %v", owner.ID, err)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	r.Header.Set(forwardedHeader, f.self.ID)
+	proxy.ServeHTTP(w, r)
+}
@@ -0,0 +1,59 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"log"
+	sharedredis "shared/redis"
+	"shared/sender"
+	"strconv"
+	"time"
+	"worker-bot/models"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// allowMessage применяет защиту от флуда: общий лимит бота и лимит
+// отдельного чата. Превысивший лимит чат получает просьбу подождать
+// не чаще одного раза за окно. При недоступности Redis сообщения пропускаются.
+func allowMessage(ctx context.Context, out *sender.Sender, limiter *sharedredis.RateLimiter, redis *models.RedisClient, plan sharedredis.Plan, chatID int64) bool {
+	botID := out.Bot().Self.ID
+
+	allowed, _, err := limiter.Allow(ctx, sharedredis.ScopeBot, strconv.FormatInt(botID, 10), sharedredis.LimitFor(plan, sharedredis.ScopeBot))
+	if err != nil {
+		log.Printf("Error checking bot rate limit: %v", err)
+		return true
+	}
+	if !allowed {
+		log.Printf("Bot %d rate limit exceeded, dropping message from chat %d", botID, chatID)
+		return false
+	}
+
+	chatKey := fmt.Sprintf("%d:%d", botID, chatID)
+	allowed, retryAfter, err := limiter.Allow(ctx, sharedredis.ScopeChat, chatKey, sharedredis.LimitFor(plan, sharedredis.ScopeChat))
+	if err != nil {
+		log.Printf("Error checking chat rate limit: %v", err)
+		return true
+	}
+	if allowed {
+		return true
+	}
+
+	if retryAfter < time.Second {
+		retryAfter = time.Second
+	}
+	noticeKey := fmt.Sprintf(models.KeyFloodNotice, botID, chatID)
+	first, err := redis.SetNX(ctx, noticeKey, 1, retryAfter).Result()
+	if err != nil {
+		log.Printf("Error saving flood notice: %v", err)
+		return false
+	}
+	if first {
+		reply := tgbotapi.NewMessage(chatID, fmt.Sprintf(
+			"⏳ Слишком много сообщений. Подождите %d сек.", int(retryAfter.Seconds())))
+		if _, err := out.Send(ctx, reply); err != nil {
+			log.Printf("Error sending flood notice: %v", err)
+		}
+	}
+	return false
+}
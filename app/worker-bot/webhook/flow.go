@@ -0,0 +1,126 @@
+package webhook
+
+import (
+	"context"
+	"shared/commands"
+	"shared/keyboard"
+	"worker-bot/models"
+	"worker-bot/templates"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"gorm.io/gorm"
+)
+
+// stepTemplate — шаг диалога, на котором пользователь находится в одном
+// из шаблонов владельца бота.
+const stepTemplate = "template"
+
+// showNode переходит к шаблону name владельца ownerID и отправляет его.
+func showNode(ctx context.Context, db *gorm.DB, resp *response, chatID int64, state *models.BotState, ownerID int64, name string) error {
+	next, err := templates.ByName(ctx, db, ownerID, name)
+	if err != nil {
+		return err
+	}
+	if next == nil {
+		resp.send(tgbotapi.NewMessage(chatID, "Раздел не найден"))
+		return nil
+	}
+
+	state.CurrentStep = stepTemplate
+	state.TemplateID = next.ID
+	resp.sendTemplate(chatID, state, next)
+	return nil
+}
+
+// handleTemplateInput обрабатывает нажатие кнопки reply-клавиатуры текущего
+// шаблона. Возвращает false, если текст не совпал ни с одной кнопкой перехода.
+func handleTemplateInput(ctx context.Context, db *gorm.DB, resp *response, msg *tgbotapi.Message, state *models.BotState) (bool, error) {
+	if state.TemplateID == 0 || msg.Text == "" {
+		return false, nil
+	}
+
+	current, err := templates.ByID(ctx, db, state.TemplateID)
+	if err != nil || current == nil {
+		return false, err
+	}
+
+	// Ответ в шаблоне сохраняется как переменная чата, даже если это
+	// не кнопка перехода.
+	state.SetVar(current.Name, msg.Text)
+	if current.Keyboard == nil {
+		return false, nil
+	}
+
+	button, ok := current.Keyboard.FindText(msg.Text)
+	if !ok || button.Node == "" {
+		return false, nil
+	}
+	return true, showNode(ctx, db, resp, msg.Chat.ID, state, current.UserID, button.Node)
+}
+
+// handleTemplateButton обрабатывает нажатие inline-кнопки шаблона. Переход
+// разрешён только между шаблонами владельца этого бота.
+func handleTemplateButton(ctx context.Context, db *gorm.DB, botToken string, resp *response, chatID int64, state *models.BotState, data string) (bool, error) {
+	templateID, ref, ok := keyboard.ParseCallbackData(data)
+	if !ok {
+		return false, nil
+	}
+
+	current, err := templates.ByID(ctx, db, templateID)
+	if err != nil || current == nil || current.Keyboard == nil {
+		return false, err
+	}
+
+	bound, err := templates.Bound(ctx, db, botToken)
+	if err != nil || bound == nil || bound.UserID != current.UserID {
+		return false, err
+	}
+
+	// Кнопки, удалённые или переставленные после отправки сообщения,
+	// не находятся, и пользователь видит, что кнопка больше не действует
+	button, ok := current.Keyboard.Find(ref)
+	if !ok || button.Type != keyboard.ButtonCallback || button.Node == "" {
+		return false, nil
+	}
+	state.SetVar(current.Name, button.Text)
+	return true, showNode(ctx, db, resp, chatID, state, current.UserID, button.Node)
+}
+
+// handleFlowCommand открывает шаблон по команде из меню бота. admin-bot
+// строит команды по шаблонам, достижимым от стартового, поэтому команда
+// ищется тем же обходом. Возвращает false, если команда не из потока.
+func handleFlowCommand(ctx context.Context, db *gorm.DB, botToken string, resp *response, msg *tgbotapi.Message, state *models.BotState) (bool, error) {
+	root, err := templates.Bound(ctx, db, botToken)
+	if err != nil || root == nil {
+		return false, err
+	}
+
+	flow := []string{root.Name}
+	seen := map[string]bool{root.Name: true}
+	for queue := []*templates.Template{root}; len(queue) > 0; queue = queue[1:] {
+		if queue[0].Keyboard == nil {
+			continue
+		}
+		for _, name := range queue[0].Keyboard.Nodes() {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			next, err := templates.ByName(ctx, db, root.UserID, name)
+			if err != nil {
+				return false, err
+			}
+			if next == nil {
+				continue
+			}
+			flow = append(flow, name)
+			queue = append(queue, next)
+		}
+	}
+
+	name := commands.Find(flow, msg.Command())
+	if name == "" {
+		return false, nil
+	}
+	return true, showNode(ctx, db, resp, msg.Chat.ID, state, root.UserID, name)
+}
@@ -2,65 +2,292 @@ package webhook
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net/http"
+	"shared/content"
+	"shared/keyboard"
+	"shared/media"
+	sharedredis "shared/redis"
 	"time"
+	"worker-bot/deadletter"
 	"worker-bot/models"
 	mtproto "worker-bot/mt-proto"
+	"worker-bot/outbox"
+	"worker-bot/templates"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"gorm.io/gorm"
 )
 
 type WebhookConfig struct {
 	Token      string
 	URL        string
 	ListenAddr string
+	// Plan — тариф бота из BOT_PLAN. Боты владельцев ограничиваются
+	// тарифом владельца из users.plan
+	Plan string
+
+	// TemplateRefresh — наибольший возраст шаблона в кэше, 0 отключает кэш
+	TemplateRefresh time.Duration
+	// WorkerID — имя воркера в реестре и в потоке команд admin-bot
+	WorkerID string
+	// WorkerAddr — адрес, по которому другие воркеры пересылают этому
+	// обновления его ботов
+	WorkerAddr string
+
+	// Polling — получать обновления через getUpdates вместо вебхука. URL
+	// тогда не нужен
+	Polling bool
 }
 
-func Start(cfg WebhookConfig, redis *models.RedisClient, mtp *mtproto.Session) {
-	bot, err := tgbotapi.NewBotAPI(cfg.Token)
+// Start запускает ботов воркера и HTTP-сервер. Сбой одного бота, в том
+// числе бота из BOT_TOKEN, не останавливает остальных: его перезапускает
+// супервизор. Ошибка возвращается, только если воркер не может работать
+// целиком.
+func Start(cfg WebhookConfig, redis *models.RedisClient, db *gorm.DB, mtp *mtproto.Session) error {
+	storage, err := media.NewStorageFromEnv()
 	if err != nil {
-		log.Fatalf("Failed to create bot: %v", err)
+		return fmt.Errorf("failed to init media storage: %w", err)
 	}
 
-	webhookURL := cfg.URL + "/webhook"
-	wh, err := tgbotapi.NewWebhook(webhookURL)
-	if err != nil {
-		log.Fatalf("Failed to create webhook: %v", err)
+	self := sharedredis.Worker{ID: cfg.WorkerID, Addr: cfg.WorkerAddr}
+	bots := newFleet(&processor{
+		limiter: sharedredis.NewRateLimiter(redis.Client),
+		plans:   newPlans(db, sharedredis.Plan(cfg.Plan)),
+		redis:   redis,
+		db:      db,
+		mtp:     mtp,
+	}, redis.Client, self, cfg.URL, cfg.Polling)
+
+	dispatcher := outbox.NewDispatcher(db, bots.sender)
+	dispatcher.OnBlocked = func(ctx context.Context, botID, chatID int64) {
+		if err := setBlocked(ctx, botID, chatID, true, redis, db); err != nil {
+			log.Printf("Error blocking user %d: %v", chatID, err)
+		}
 	}
+	dispatcher.OnUnauthorized = bots.revoke
+	dispatcher.Media = media.NewLibrary(db, storage)
+	dispatcher.Bots = bots.running
+	bots.base.dispatcher = dispatcher
+	go dispatcher.Run(context.Background())
 
-	_, err = bot.Request(wh)
-	if err != nil {
-		log.Fatalf("Failed to set webhook: %v", err)
+	// Бот из BOT_TOKEN работает всегда, остальными управляет admin-bot
+	if err := bots.start(context.Background(), bots.pin(cfg.Token), false); err != nil {
+		log.Printf("Error starting main bot, will retry: %v", err)
 	}
+	go bots.runSupervisor(context.Background())
 
-	http.HandleFunc("/webhook", func(w http.ResponseWriter, r *http.Request) {
-		update, err := bot.HandleUpdate(r)
-		if err != nil {
-			log.Printf("Error handling update: %v", err)
-			return
-		}
+	replayer := deadletter.NewReplayer(db, bots.owns,
+		func(ctx context.Context, botID int64, update tgbotapi.Update) error {
+			p := bots.get(botID)
+			if p == nil || !p.sup.allow() {
+				return fmt.Errorf("bot %d is not running", botID)
+			}
+			return p.process(ctx, update)
+		})
+	replayer.Bots = bots.running
+	go replayer.Run(context.Background())
 
-		if update.Message != nil {
-			handleMessage(bot, update.Message, redis, mtp)
-		}
-	})
+	// Шаблоны кэшируются, admin-bot сбрасывает кэш через Redis pub/sub
+	templates.EnableCache(cfg.TemplateRefresh)
+	go templates.Watch(context.Background(), redis.Client)
+
+	go bots.runRegistry(context.Background())
+	go runControl(context.Background(), bots, redis.Client, cfg.WorkerID)
+
+	http.Handle("/webhook", bots)
+	http.Handle("/webhook/", bots)
+	http.HandleFunc("/health", bots.serveHealth)
 
+	if cfg.Polling {
+		log.Printf("Polling mode: bots receive updates via getUpdates")
+	}
 	log.Printf("Starting server on %s", cfg.ListenAddr)
 	if err := http.ListenAndServe(cfg.ListenAddr, nil); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+		return fmt.Errorf("server stopped: %w", err)
 	}
+	return nil
 }
 
-func handleMessage(bot *tgbotapi.BotAPI, msg *tgbotapi.Message, redis *models.RedisClient, mtp *mtproto.Session) {
-	ctx := context.Background()
-	userID := msg.From.ID
+// response собирает ответы обработчика. Они сохраняются в outbox в одной
+// транзакции с новым состоянием и отправляются диспетчером.
+type response struct {
+	messages []outbox.Message
+
+	// edit — сообщение с inline-кнопкой, из которого пришёл callback.
+	// Первый ответ заменяет его текст вместо отправки нового сообщения.
+	edit *tgbotapi.Message
+
+	// profile — переменные пользователя и бота для текста шаблонов.
+	profile content.Vars
+}
 
-	state, err := redis.GetBotState(ctx, userID)
+func (r *response) send(msg tgbotapi.MessageConfig) {
+	var (
+		m   outbox.Message
+		err error
+	)
+	// У сообщений с медиа нет текста, editMessageText их не изменит.
+	if r.edit != nil && r.edit.Text != "" && isInline(msg.ReplyMarkup) {
+		edit := tgbotapi.NewEditMessageText(r.edit.Chat.ID, r.edit.MessageID, msg.Text)
+		edit.ParseMode = msg.ParseMode
+		edit.Entities = msg.Entities
+		edit.DisableWebPagePreview = msg.DisableWebPagePreview
+		r.edit = nil
+		m, err = outbox.FromEdit(edit)
+		if err == nil {
+			err = m.Params.AddInterface("reply_markup", msg.ReplyMarkup)
+		}
+	} else {
+		m, err = outbox.FromMessage(msg)
+	}
 	if err != nil {
-		log.Printf("Error getting bot state: %v", err)
+		log.Printf("Error preparing message: %v", err)
 		return
 	}
+	r.messages = append(r.messages, m)
+}
+
+// dateZone — часовой пояс даты и времени в шаблонах, тот же TIMEZONE, что
+// у admin-bot: владелец видит в предпросмотре то же, что пользователи.
+var dateZone = loadDateZone()
+
+func loadDateZone() *time.Location {
+	loc, err := content.ZoneFromEnv()
+	if err != nil {
+		log.Printf("Using UTC for template dates: %v", err)
+	}
+	return loc
+}
+
+// sendTemplate отправляет шаблон: текстовый через send, с медиа — новым
+// сообщением, потому что текст нельзя заменить на медиа редактированием.
+// Переменные в тексте заменяются значениями для этого пользователя.
+func (r *response) sendTemplate(chatID int64, state *models.BotState, tmpl *templates.Template) {
+	vars := make(content.Vars)
+	for k, v := range r.profile {
+		vars[k] = v
+	}
+	content.DateVars(vars, time.Now().In(dateZone))
+	content.ChatVars(vars, state.Vars)
+
+	rendered := *tmpl
+	rendered.Content = content.Render(tmpl.Content, tmpl.ParseMode, vars)
+	t := &rendered
+
+	if t.MediaType == "" {
+		r.send(t.Message(chatID))
+		return
+	}
+
+	r.clearKeyboard()
+	var (
+		m   outbox.Message
+		err error
+	)
+	if t.MediaID != 0 {
+		m, err = outbox.FromStoredMedia(chatID, t.MediaType, t.MediaID, t.Content, t.ParseMode, t.Keyboard.Markup(t.ID))
+	} else {
+		// Старые шаблоны хранят file_id, полученный admin-bot
+		m, err = outbox.FromMedia(chatID, t.MediaType, t.MediaFileID, t.Content, t.ParseMode, t.Keyboard.Markup(t.ID))
+	}
+	if err != nil {
+		log.Printf("Error preparing media message: %v", err)
+		return
+	}
+	r.messages = append(r.messages, m)
+}
+
+// clearKeyboard убирает inline-кнопки у исходного сообщения, если ответ
+// пришлось отправить новым сообщением.
+func (r *response) clearKeyboard() {
+	if r.edit == nil {
+		return
+	}
+	edit := tgbotapi.NewEditMessageReplyMarkup(r.edit.Chat.ID, r.edit.MessageID, tgbotapi.InlineKeyboardMarkup{
+		InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{},
+	})
+	r.edit = nil
+
+	m, err := outbox.FromEditMarkup(edit)
+	if err != nil {
+		log.Printf("Error preparing keyboard edit: %v", err)
+		return
+	}
+	r.messages = append(r.messages, m)
+}
+
+// profileVars возвращает переменные шаблона, которые не меняются в
+// течение обработки обновления.
+func profileVars(bot, user *tgbotapi.User) content.Vars {
+	vars := make(content.Vars)
+	content.BotVars(vars, bot)
+	content.UserVars(vars, user)
+	return vars
+}
+
+// isInline сообщает, можно ли показать клавиатуру при редактировании
+// сообщения: editMessageText принимает только inline-клавиатуру.
+func isInline(markup interface{}) bool {
+	switch markup.(type) {
+	case nil, tgbotapi.InlineKeyboardMarkup, *tgbotapi.InlineKeyboardMarkup, *keyboard.InlineMarkup:
+		return true
+	}
+	return false
+}
+
+// senderID возвращает ключ состояния для сообщения. У постов в каналах нет
+// отправителя, поэтому состояние ведётся для самого канала.
+func senderID(msg *tgbotapi.Message) int64 {
+	if msg.From != nil {
+		return msg.From.ID
+	}
+	return msg.Chat.ID
+}
+
+func handleMessage(ctx context.Context, bot *tgbotapi.BotAPI, msg *tgbotapi.Message, redis *models.RedisClient, db *gorm.DB, mtp *mtproto.Session) error {
+	return withState(ctx, bot.Self.ID, senderID(msg), redis, db, nil, func(state *models.BotState, resp *response) error {
+		// Пользователь пишет боту — значит, бот не заблокирован
+		state.IsBlocked = false
+		resp.profile = profileVars(&bot.Self, msg.From)
+		return dispatchMessage(ctx, bot.Token, resp, msg, state, redis, db, mtp)
+	})
+}
+
+func dispatchMessage(ctx context.Context, botToken string, resp *response, msg *tgbotapi.Message, state *models.BotState, redis *models.RedisClient, db *gorm.DB, mtp *mtproto.Session) error {
+	switch {
+	case msg.IsCommand() && msg.Command() == "start":
+		start, err := templates.Bound(ctx, db, botToken)
+		if err != nil {
+			return err
+		}
+		handleStartCommand(resp, msg.Chat.ID, state, redis, start)
+	case msg.IsCommand() && msg.Command() == "auth":
+		handleAuthCommand(resp, msg.Chat.ID, state, redis, mtp)
+	default:
+		if msg.IsCommand() {
+			if handled, err := handleFlowCommand(ctx, db, botToken, resp, msg, state); err != nil || handled {
+				return err
+			}
+		}
+		if handled, err := handleTemplateInput(ctx, db, resp, msg, state); err != nil || handled {
+			return err
+		}
+		state.LastMessageID = msg.MessageID
+		state.LastInputStep = state.CurrentStep
+		handleRegularMessage(resp, msg, state, redis)
+	}
+	return nil
+}
+
+// withState загружает состояние пользователя, вызывает fn и сохраняет новое
+// состояние вместе с ответами. edit задаёт сообщение, которое можно заменить ответом.
+func withState(ctx context.Context, botID, userID int64, redis *models.RedisClient, db *gorm.DB, edit *tgbotapi.Message, fn func(state *models.BotState, resp *response) error) error {
+	state, err := loadState(ctx, botID, userID, redis, db)
+	if err != nil {
+		return deadletter.WithStage(deadletter.StageLoadState, err)
+	}
 	if state == nil {
 		state = &models.BotState{
 			UserID:      userID,
@@ -73,73 +300,90 @@ func handleMessage(bot *tgbotapi.BotAPI, msg *tgbotapi.Message, redis *models.Re
 
 	state.LastActive = time.Now()
 
-	switch {
-	case msg.IsCommand() && msg.Command() == "start":
-		handleStartCommand(bot, msg.Chat.ID, state, redis)
-	case msg.IsCommand() && msg.Command() == "auth":
-		handleAuthCommand(bot, msg.Chat.ID, state, redis, mtp)
-	default:
-		handleRegularMessage(bot, msg, state, redis)
+	resp := &response{edit: edit}
+	if err := fn(state, resp); err != nil {
+		return deadletter.WithStage(deadletter.StageHandle, err)
+	}
+
+	return deadletter.WithStage(deadletter.StageCommitState, commitState(ctx, botID, state, resp, redis, db))
+}
+
+// loadState читает состояние из кэша Redis, а при его отсутствии — из Postgres.
+func loadState(ctx context.Context, botID, userID int64, redis *models.RedisClient, db *gorm.DB) (*models.BotState, error) {
+	state, err := redis.GetBotState(ctx, botID, userID)
+	if err != nil || state != nil {
+		return state, err
+	}
+	return models.LoadChatState(ctx, db, botID, userID)
+}
+
+// commitState сохраняет новое состояние и ответы в Postgres. Кэш в Redis
+// сбрасывается до транзакции: если процесс упадёт после коммита, следующее
+// обновление прочитает состояние из Postgres, а не устаревшую копию.
+func commitState(ctx context.Context, botID int64, state *models.BotState, resp *response, redis *models.RedisClient, db *gorm.DB) error {
+	if err := redis.InvalidateBotState(ctx, botID, state.UserID); err != nil {
+		return err
+	}
+	if err := outbox.Commit(ctx, db, botID, state, resp.messages); err != nil {
+		return fmt.Errorf("failed to commit state: %w", err)
 	}
-	if err := redis.SaveBotState(ctx, state); err != nil {
-		log.Printf("Error saving bot state: %v", err)
+	if err := redis.SaveBotState(ctx, botID, state); err != nil {
+		log.Printf("Error caching bot state: %v", err)
 	}
+	return nil
 }
 
-func handleStartCommand(bot *tgbotapi.BotAPI, chatID int64, state *models.BotState, redis *models.RedisClient) {
+func handleStartCommand(resp *response, chatID int64, state *models.BotState, redis *models.RedisClient, start *templates.Template) {
 	state.CurrentStep = "start"
 
+	if start != nil {
+		state.CurrentStep = stepTemplate
+		state.TemplateID = start.ID
+		resp.sendTemplate(chatID, state, start)
+		return
+	}
+
 	msg := tgbotapi.NewMessage(chatID, "Добро пожаловать! Ваш реферальный код: "+state.RefCode)
 	msg.ReplyMarkup = tgbotapi.NewRemoveKeyboard(true)
-	if _, err := bot.Send(msg); err != nil {
-		log.Printf("Error sending message: %v", err)
-	}
+	resp.send(msg)
 }
 
-func handleAuthCommand(bot *tgbotapi.BotAPI, chatID int64, state *models.BotState, redis *models.RedisClient, mtp *mtproto.Session) {
+func handleAuthCommand(resp *response, chatID int64, state *models.BotState, redis *models.RedisClient, mtp *mtproto.Session) {
 	state.CurrentStep = "waiting_phone"
 
 	msg := tgbotapi.NewMessage(chatID, "Введите номер телефона в формате +71234567890")
-	if _, err := bot.Send(msg); err != nil {
-		log.Printf("Error sending message: %v", err)
-	}
+	resp.send(msg)
 }
 
-func handleRegularMessage(bot *tgbotapi.BotAPI, msg *tgbotapi.Message, state *models.BotState, redis *models.RedisClient) {
+func handleRegularMessage(resp *response, msg *tgbotapi.Message, state *models.BotState, redis *models.RedisClient) {
 	switch state.CurrentStep {
 	case "waiting_phone":
-		handlePhoneInput(bot, msg, state)
+		handlePhoneInput(resp, msg, state)
 	case "waiting_code":
-		handleCodeInput(bot, msg, state)
+		handleCodeInput(resp, msg, state)
 	default:
-		handleUnknownCommand(bot, msg.Chat.ID)
+		handleUnknownCommand(resp, msg.Chat.ID)
 	}
 }
 
-func handlePhoneInput(bot *tgbotapi.BotAPI, msg *tgbotapi.Message, state *models.BotState) {
+func handlePhoneInput(resp *response, msg *tgbotapi.Message, state *models.BotState) {
 	phone := msg.Text
 	state.CurrentStep = "waiting_code"
 	state.RefCode = "ref_" + phone // Просто пример, в реальном коде используйте нормальную генерацию
 
 	reply := tgbotapi.NewMessage(msg.Chat.ID, "Номер принят. Введите код подтверждения")
-	if _, err := bot.Send(reply); err != nil {
-		log.Printf("Error sending message: %v", err)
-	}
+	resp.send(reply)
 }
 
-func handleCodeInput(bot *tgbotapi.BotAPI, msg *tgbotapi.Message, state *models.BotState) {
+func handleCodeInput(resp *response, msg *tgbotapi.Message, state *models.BotState) {
 	code := msg.Text
 	state.CurrentStep = "authenticated"
 
 	reply := tgbotapi.NewMessage(msg.Chat.ID, "Вы успешно авторизованы! Ваш код: "+code)
-	if _, err := bot.Send(reply); err != nil {
-		log.Printf("Error sending message: %v", err)
-	}
+	resp.send(reply)
 }
 
-func handleUnknownCommand(bot *tgbotapi.BotAPI, chatID int64) {
+func handleUnknownCommand(resp *response, chatID int64) {
 	msg := tgbotapi.NewMessage(chatID, "Неизвестная команда. Используйте /start или /auth")
-	if _, err := bot.Send(msg); err != nil {
-		log.Printf("Error sending message: %v", err)
-	}
+	resp.send(msg)
 }
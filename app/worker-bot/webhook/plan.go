@@ -0,0 +1,70 @@
+package webhook
+
+import (
+	"context"
+	"log"
+	sharedredis "shared/redis"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// planTTL — как долго тариф владельца берётся из памяти. Тариф меняется
+// редко, а лимиты проверяются на каждое обновление.
+const planTTL = time.Minute
+
+// plans возвращает тарифы владельцев ботов для лимитов флуда.
+type plans struct {
+	db *gorm.DB
+	// fallback — тариф бота из BOT_PLAN: у него нет владельца, им же
+	// ограничиваются боты, чей тариф не удалось прочитать
+	fallback sharedredis.Plan
+
+	mu      sync.Mutex
+	byOwner map[int64]cachedPlan
+}
+
+type cachedPlan struct {
+	plan     sharedredis.Plan
+	loadedAt time.Time
+}
+
+func newPlans(db *gorm.DB, fallback sharedredis.Plan) *plans {
+	return &plans{db: db, fallback: fallback, byOwner: make(map[int64]cachedPlan)}
+}
+
+// forOwner возвращает тариф из users.plan владельца ownerID. При ошибке
+// базы остаётся прежний тариф из кэша.
+func (c *plans) forOwner(ctx context.Context, ownerID int64) sharedredis.Plan {
+	if ownerID == 0 {
+		return c.fallback
+	}
+
+	c.mu.Lock()
+	cached, ok := c.byOwner[ownerID]
+	c.mu.Unlock()
+	if ok && time.Since(cached.loadedAt) < planTTL {
+		return cached.plan
+	}
+
+	var found []string
+	err := c.db.WithContext(ctx).Raw(`
+        SELECT plan FROM users WHERE telegram_id = ?`, ownerID).Scan(&found).Error
+	if err != nil {
+		log.Printf("Error loading plan of owner %d: %v", ownerID, err)
+		if ok {
+			return cached.plan
+		}
+		return c.fallback
+	}
+
+	plan := c.fallback
+	if len(found) > 0 && found[0] != "" {
+		plan = sharedredis.Plan(found[0])
+	}
+	c.mu.Lock()
+	c.byOwner[ownerID] = cachedPlan{plan: plan, loadedAt: time.Now()}
+	c.mu.Unlock()
+	return plan
+}
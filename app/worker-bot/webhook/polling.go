@@ -0,0 +1,129 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"shared/sender"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// pollTimeout — сколько секунд Telegram держит запрос getUpdates, если
+	// обновлений нет
+	pollTimeout    = 30
+	pollLimit      = 100
+	pollRetryDelay = 3 * time.Second
+)
+
+// startPolling запускает getUpdates для бота. Режим polling нужен для
+// локальной разработки: воркеру не нужен публичный адрес.
+func (f *fleet) startPolling(p *processor) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p.stopPolling = cancel
+	go f.poll(ctx, p)
+}
+
+// poll получает обновления бота и прогоняет их через тот же конвейер, что
+// и вебхук. Обновление подтверждается следующим запросом с offset, поэтому
+// непринятое обновление Telegram отдаст снова.
+func (f *fleet) poll(ctx context.Context, p *processor) {
+	botID := p.bot.Self.ID
+	offset := 0
+	for ctx.Err() == nil {
+		// getUpdates одного бота может вызывать только один процесс, бота
+		// из BOT_TOKEN опрашивает воркер, которому он назначен
+		if botID == f.pinned && f.ready() && !f.assigned(botID) {
+			sleep(ctx, pollRetryDelay)
+			continue
+		}
+		if !p.sup.allow() {
+			sleep(ctx, pollRetryDelay)
+			continue
+		}
+
+		updates, err := getRawUpdates(p.bot, offset)
+		if err != nil {
+			f.pollFailed(ctx, p, err)
+			continue
+		}
+
+		for _, body := range updates {
+			if ctx.Err() != nil || !p.sup.allow() {
+				break
+			}
+			var head struct {
+				UpdateID int `json:"update_id"`
+			}
+			if err := json.Unmarshal(body, &head); err != nil {
+				log.Printf("Error decoding update id of bot %d: %v", botID, err)
+				continue
+			}
+			if err := p.receive(ctx, body); err != nil {
+				sleep(ctx, pollRetryDelay)
+				break
+			}
+			offset = head.UpdateID + 1
+		}
+	}
+}
+
+// getRawUpdates вызывает getUpdates и возвращает обновления в исходном
+// виде: он же сохраняется в очередь необработанных обновлений.
+func getRawUpdates(bot *tgbotapi.BotAPI, offset int) ([]json.RawMessage, error) {
+	params := tgbotapi.Params{}
+	params.AddNonZero("offset", offset)
+	params.AddNonZero("limit", pollLimit)
+	params.AddNonZero("timeout", pollTimeout)
+	if err := params.AddInterface("allowed_updates", allowedUpdates); err != nil {
+		return nil, err
+	}
+
+	resp, err := bot.MakeRequest("getUpdates", params)
+	if err != nil {
+		return nil, err
+	}
+	var updates []json.RawMessage
+	if err := json.Unmarshal(resp.Result, &updates); err != nil {
+		return nil, err
+	}
+	return updates, nil
+}
+
+// pollFailed разбирает ошибку getUpdates. Отклонённый токен отключает бота,
+// вебхук, поставленный в обход воркера, снимается.
+func (f *fleet) pollFailed(ctx context.Context, p *processor, err error) {
+	botID := p.bot.Self.ID
+
+	var apiErr *tgbotapi.Error
+	switch {
+	case errors.As(err, &apiErr) && apiErr.Code == 409 && strings.Contains(apiErr.Message, "webhook"):
+		log.Printf("Bot %d has a webhook, deleting it for polling", botID)
+		if _, err := p.bot.Request(tgbotapi.DeleteWebhookConfig{}); err != nil {
+			log.Printf("Error deleting webhook of bot %d: %v", botID, err)
+		}
+	case sender.IsUnauthorized(err) && botID != f.pinned:
+		// revoke останавливает бота и отменяет ctx этого цикла
+		f.revoke(context.Background(), botID, err)
+		return
+	default:
+		// 409 без вебхука — бота ещё опрашивает прежний обработчик, он
+		// остановится после своего запроса
+		log.Printf("Error getting updates of bot %d: %v", botID, err)
+	}
+	sleep(ctx, pollRetryDelay)
+}
+
+// sleep ждёт d или отмены ctx.
+func sleep(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
@@ -0,0 +1,170 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"runtime/debug"
+	sharedredis "shared/redis"
+	"shared/sender"
+	"worker-bot/deadletter"
+	"worker-bot/models"
+	mtproto "worker-bot/mt-proto"
+	"worker-bot/outbox"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"gorm.io/gorm"
+)
+
+// processor прогоняет обновления одного бота через все этапы обработки.
+type processor struct {
+	bot        *tgbotapi.BotAPI
+	out        *sender.Sender
+	limiter    *sharedredis.RateLimiter
+	plans      *plans
+	redis      *models.RedisClient
+	db         *gorm.DB
+	mtp        *mtproto.Session
+	dispatcher *outbox.Dispatcher
+
+	// ownerID — владелец бота в admin-bot, 0 у бота из BOT_TOKEN
+	ownerID int64
+	sup     *supervisor
+
+	// stopPolling останавливает getUpdates бота в режиме polling
+	stopPolling context.CancelFunc
+}
+
+func (p *processor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !p.sup.allow() {
+		// Бот ждёт перезапуска, Telegram повторит обновление позже
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Printf("Error reading update: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := p.receive(r.Context(), body); err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+}
+
+// receive проводит полученное обновление через проверки и обработку. Так
+// принимаются обновления и из вебхука, и из getUpdates. Ошибка значит, что
+// обновление не принято и Telegram должен отдать его ещё раз; ошибки
+// обработки уходят в очередь необработанных обновлений.
+func (p *processor) receive(ctx context.Context, body []byte) error {
+	var update tgbotapi.Update
+	if err := json.Unmarshal(body, &update); err != nil {
+		log.Printf("Error decoding update: %v", err)
+		return p.deadLetter(context.WithoutCancel(ctx), 0, body, deadletter.WithStage(deadletter.StageDecode, err))
+	}
+
+	botID := p.bot.Self.ID
+	claim, err := p.redis.ClaimUpdate(ctx, botID, update.UpdateID)
+	if err != nil {
+		log.Printf("Error checking update %d: %v", update.UpdateID, err)
+		return err
+	}
+	switch claim {
+	case models.UpdateDone:
+		log.Printf("Skipping duplicate update %d", update.UpdateID)
+		return nil
+	case models.UpdateInProgress:
+		// Telegram повторит обновление, когда первая обработка закончится
+		return fmt.Errorf("update %d is already being processed", update.UpdateID)
+	}
+
+	// Обновление отмечается обработанным, только когда результат сохранён:
+	// обработка или очередь необработанных обновлений. Иначе отметка
+	// снимается, и Telegram доставит обновление снова
+	saveCtx := context.WithoutCancel(ctx)
+	if chatID := updateChatID(update); chatID == 0 || allowMessage(ctx, p.out, p.limiter, p.redis, p.plans.forOwner(ctx, p.ownerID), chatID) {
+		if err := p.process(ctx, update); err != nil {
+			log.Printf("Error handling update %d: %v", update.UpdateID, err)
+			if err := p.deadLetter(saveCtx, update.UpdateID, body, err); err != nil {
+				if err := p.redis.ReleaseUpdate(saveCtx, botID, update.UpdateID); err != nil {
+					log.Printf("Error releasing update %d: %v", update.UpdateID, err)
+				}
+				return err
+			}
+		}
+	}
+
+	if err := p.redis.MarkUpdate(saveCtx, botID, update.UpdateID); err != nil {
+		log.Printf("Error marking update %d: %v", update.UpdateID, err)
+	}
+	return nil
+}
+
+// process обрабатывает обновление под присмотром супервизора: паника
+// превращается в ошибку, результат учитывается в здоровье бота.
+func (p *processor) process(ctx context.Context, update tgbotapi.Update) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Panic handling update %d of bot %d: %v\n%s", update.UpdateID, p.bot.Self.ID, r, debug.Stack())
+			err = deadletter.WithStage(deadletter.StagePanic, fmt.Errorf("panic: %v", r))
+		}
+		if err != nil {
+			p.sup.failure(err)
+		} else {
+			p.sup.success()
+		}
+	}()
+	return p.handleUpdate(ctx, update)
+}
+
+// handleUpdate обрабатывает обновление без проверок на дубликаты и флуд.
+// Через него же проходят повторы из очереди необработанных обновлений.
+func (p *processor) handleUpdate(ctx context.Context, update tgbotapi.Update) error {
+	botID := p.bot.Self.ID
+
+	var err error
+	switch {
+	case update.Message != nil:
+		err = handleMessage(ctx, p.bot, update.Message, p.redis, p.db, p.mtp)
+	case update.EditedMessage != nil:
+		err = handleEditedMessage(ctx, botID, update.EditedMessage, p.redis, p.db)
+	case update.ChannelPost != nil:
+		err = handleChannelPost(ctx, p.bot, update.ChannelPost, p.redis, p.db)
+	case update.CallbackQuery != nil:
+		err = handleCallbackQuery(ctx, botID, p.out, update.CallbackQuery, p.redis, p.db, p.mtp)
+	case update.MyChatMember != nil:
+		err = handleMyChatMember(ctx, botID, update.MyChatMember, p.redis, p.db)
+	default:
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	p.dispatcher.Wake()
+	return nil
+}
+
+// halt останавливает получение обновлений, если бот опрашивается сам.
+func (p *processor) halt() {
+	if p.stopPolling != nil {
+		p.stopPolling()
+	}
+}
+
+func (p *processor) deadLetter(ctx context.Context, updateID int, payload []byte, cause error) error {
+	if err := deadletter.Save(ctx, p.db, p.bot.Self.ID, updateID, payload, cause); err != nil {
+		log.Printf("Error saving dead letter for update %d: %v", updateID, err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package webhook
+
+import (
+	"context"
+	"log"
+	sharedredis "shared/redis"
+	"time"
+)
+
+// reconcileInterval — как часто воркер сверяет своих ботов с базой, даже
+// если состав воркеров не менялся: так подхватываются боты, команды для
+// которых потерялись.
+const reconcileInterval = 30 * time.Second
+
+// runRegistry отмечает воркер живым и перераспределяет ботов, когда
+// воркеры появляются или пропадают.
+func (f *fleet) runRegistry(ctx context.Context) {
+	ticker := time.NewTicker(sharedredis.HeartbeatInterval)
+	defer ticker.Stop()
+
+	var reconciled time.Time
+	for {
+		if changed, err := f.refreshWorkers(ctx); err != nil {
+			log.Printf("Worker registry error: %v", err)
+		} else if changed || time.Since(reconciled) >= reconcileInterval {
+			f.reconcile(ctx)
+			reconciled = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			if err := sharedredis.Deregister(context.Background(), f.cli, f.self.ID); err != nil {
+				log.Printf("Error deregistering worker: %v", err)
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// refreshWorkers отправляет heartbeat и обновляет список живых воркеров.
+// Возвращает true, если состав воркеров изменился.
+func (f *fleet) refreshWorkers(ctx context.Context) (bool, error) {
+	if err := sharedredis.Heartbeat(ctx, f.cli, f.self); err != nil {
+		return false, err
+	}
+	workers, err := sharedredis.LiveWorkers(ctx, f.cli)
+	if err != nil {
+		return false, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	changed := len(workers) != len(f.workers)
+	for i := 0; !changed && i < len(workers); i++ {
+		changed = workers[i] != f.workers[i]
+	}
+	if changed {
+		log.Printf("Live workers changed: %d", len(workers))
+	}
+	f.workers = workers
+	return changed, nil
+}
+
+// reconcile запускает активных ботов, назначенных воркеру, и отдаёт
+// остальных. Отданный бот не отчитывается о статусе: его уже запускает
+// новый воркер.
+func (f *fleet) reconcile(ctx context.Context) {
+	f.hookPinned()
+
+	var ids []int64
+	err := f.base.db.WithContext(ctx).Raw(`
+        SELECT split_part(bot_token, ':', 1)::bigint FROM bots
+        WHERE is_active`).Scan(&ids).Error
+	if err != nil {
+		log.Printf("Error loading active bots: %v", err)
+		return
+	}
+
+	active := make(map[int64]bool, len(ids))
+	for _, botID := range ids {
+		active[botID] = true
+		if botID == f.pinned {
+			continue
+		}
+
+		assigned, running := f.assigned(botID), f.owns(botID)
+		switch {
+		case assigned && !running && !f.failing(botID):
+			// Бота, который не запустился, перезапускает супервизор
+			state := sharedredis.BotRunning
+			err := f.start(ctx, botID, false)
+			if err != nil {
+				log.Printf("Error starting bot %d: %v", botID, err)
+				state = sharedredis.BotFailed
+			}
+			if err := sharedredis.ReportStatus(ctx, f.cli, botID, f.self.ID, state, err); err != nil {
+				log.Printf("Error reporting status of bot %d: %v", botID, err)
+			}
+		case !assigned && running:
+			f.stop(botID)
+			log.Printf("Bot %d moved to another worker", botID)
+		}
+	}
+
+	// Бота могли отключить, пока команды до воркера не доходили
+	for _, botID := range f.running() {
+		if !active[botID] {
+			f.stop(botID)
+		}
+	}
+}
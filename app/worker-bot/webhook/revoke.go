@@ -0,0 +1,38 @@
+package webhook
+
+import (
+	"context"
+	"log"
+	sharedredis "shared/redis"
+)
+
+// revoke отключает бота, чей токен Telegram больше не принимает: токен
+// отозван в BotFather или бот удалён. Бот помечается неактивным с причиной,
+// владельцу об этом сообщит admin-bot. Остальные воркеры не найдут бота
+// среди активных при следующей сверке.
+func (f *fleet) revoke(ctx context.Context, botID int64, cause error) {
+	if botID == f.pinned {
+		// Бот из BOT_TOKEN не хранится в bots, его перезапускает супервизор
+		log.Printf("Main bot token was rejected: %v", cause)
+		return
+	}
+
+	res := f.base.db.WithContext(ctx).Exec(`
+        UPDATE bots SET is_active = false, deactivated_reason = ?, deactivated_at = NOW(),
+               owner_notified_at = NULL, updated_at = NOW()
+        WHERE split_part(bot_token, ':', 1)::bigint = ? AND is_active`, cause.Error(), botID)
+	if res.Error != nil {
+		log.Printf("Error deactivating bot %d: %v", botID, res.Error)
+	}
+
+	// Обработка останавливается, даже если база недоступна: с отозванным
+	// токеном бот всё равно ничего не отправит
+	f.stop(botID)
+	if res.Error == nil && res.RowsAffected == 0 {
+		return
+	}
+	log.Printf("Bot %d deactivated, token rejected by Telegram: %v", botID, cause)
+	if err := sharedredis.ReportStatus(ctx, f.cli, botID, f.self.ID, sharedredis.BotStopped, cause); err != nil {
+		log.Printf("Error reporting status of bot %d: %v", botID, err)
+	}
+}
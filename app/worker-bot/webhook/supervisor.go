@@ -0,0 +1,226 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	sharedredis "shared/redis"
+	"sync"
+	"time"
+)
+
+const (
+	// breakerThreshold — после стольких сбоев подряд цепь размыкается и
+	// бот ждёт перезапуска
+	breakerThreshold = 5
+
+	restartBaseDelay  = time.Second
+	restartMaxDelay   = 5 * time.Minute
+	superviseInterval = time.Second
+)
+
+// supervisor следит за здоровьем одного бота. Сбои обработки и запуска
+// размыкают цепь, бот перезапускается с экспоненциальной задержкой.
+// Сбои одного бота не влияют на остальных.
+type supervisor struct {
+	mu     sync.Mutex
+	health sharedredis.BotHealth
+	delay  time.Duration
+	// changed — здоровье изменилось и ещё не записано в Redis
+	changed bool
+}
+
+// newSupervisor создаёт супервизор здорового бота. Первый отчёт
+// затирает здоровье, оставшееся от прошлого воркера бота.
+func newSupervisor() *supervisor {
+	return &supervisor{
+		health:  sharedredis.BotHealth{State: sharedredis.HealthOK},
+		changed: true,
+	}
+}
+
+// allow сообщает, можно ли обрабатывать обновления бота.
+func (s *supervisor) allow() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.health.State != sharedredis.HealthOpen
+}
+
+func (s *supervisor) success() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.health.State == sharedredis.HealthOK {
+		return
+	}
+	s.health.State = sharedredis.HealthOK
+	s.health.Failures = 0
+	s.health.RetryAt = time.Time{}
+	s.delay = 0
+	s.changed = true
+}
+
+// failure учитывает сбой обработки. После перезапуска хватает одного
+// сбоя, чтобы снова разомкнуть цепь.
+func (s *supervisor) failure(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.health.Failures++
+	s.health.LastError = err.Error()
+	s.changed = true
+	if s.health.State == sharedredis.HealthRecovering || s.health.Failures >= breakerThreshold {
+		s.open()
+		return
+	}
+	s.health.State = sharedredis.HealthDegraded
+}
+
+// startFailed учитывает неудачный запуск: бот без рабочего клиента
+// ждёт следующей попытки.
+func (s *supervisor) startFailed(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.health.Failures++
+	s.health.LastError = err.Error()
+	s.changed = true
+	s.open()
+}
+
+// open размыкает цепь и удваивает задержку перезапуска.
+func (s *supervisor) open() {
+	s.delay *= 2
+	if s.delay < restartBaseDelay {
+		s.delay = restartBaseDelay
+	}
+	if s.delay > restartMaxDelay {
+		s.delay = restartMaxDelay
+	}
+	s.health.State = sharedredis.HealthOpen
+	s.health.RetryAt = time.Now().Add(s.delay)
+}
+
+// started отмечает запуск бота. После сбоев бот обрабатывает обновления,
+// но цепь замкнётся только после первого успешного.
+func (s *supervisor) started() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.health.State != sharedredis.HealthOpen {
+		return
+	}
+	s.health.State = sharedredis.HealthRecovering
+	s.health.Restarts++
+	s.health.RetryAt = time.Time{}
+	s.changed = true
+}
+
+// due сообщает, что пора перезапустить бота.
+func (s *supervisor) due(now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.health.State == sharedredis.HealthOpen && !now.Before(s.health.RetryAt)
+}
+
+func (s *supervisor) isOpen() bool {
+	return !s.allow()
+}
+
+func (s *supervisor) snapshot() sharedredis.BotHealth {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.health
+}
+
+// report возвращает здоровье, если оно изменилось с прошлого отчёта.
+func (s *supervisor) report() (sharedredis.BotHealth, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	changed := s.changed
+	s.changed = false
+	return s.health, changed
+}
+
+// supervisor возвращает супервизор бота, создавая его при первом запуске.
+func (f *fleet) supervisor(botID int64) *supervisor {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s := f.health[botID]
+	if s == nil {
+		s = newSupervisor()
+		f.health[botID] = s
+	}
+	return s
+}
+
+// failing сообщает, что бот ждёт перезапуска у супервизора.
+func (f *fleet) failing(botID int64) bool {
+	f.mu.RLock()
+	s := f.health[botID]
+	f.mu.RUnlock()
+	return s != nil && s.isOpen()
+}
+
+// runSupervisor перезапускает ботов с разомкнутой цепью, когда истекает
+// задержка, и отправляет изменения здоровья в Redis.
+func (f *fleet) runSupervisor(ctx context.Context) {
+	ticker := time.NewTicker(superviseInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		f.mu.RLock()
+		supervisors := make(map[int64]*supervisor, len(f.health))
+		for botID, s := range f.health {
+			supervisors[botID] = s
+		}
+		f.mu.RUnlock()
+
+		now := time.Now()
+		for botID, s := range supervisors {
+			switch {
+			case !s.due(now):
+			case botID != f.pinned && !f.assigned(botID):
+				// Бот переехал на другой воркер, перезапустит его тот
+				f.stop(botID)
+				continue
+			default:
+				state := sharedredis.BotRunning
+				err := f.start(ctx, botID, true)
+				if err != nil {
+					log.Printf("Error restarting bot %d: %v", botID, err)
+					state = sharedredis.BotFailed
+				} else {
+					log.Printf("Bot %d restarted after failures", botID)
+				}
+				if err := sharedredis.ReportStatus(ctx, f.cli, botID, f.self.ID, state, err); err != nil {
+					log.Printf("Error reporting status of bot %d: %v", botID, err)
+				}
+			}
+			if health, changed := s.report(); changed {
+				if err := sharedredis.ReportHealth(ctx, f.cli, botID, health); err != nil {
+					log.Printf("Error reporting health of bot %d: %v", botID, err)
+				}
+			}
+		}
+	}
+}
+
+// serveHealth отдаёт здоровье ботов воркера в JSON.
+func (f *fleet) serveHealth(w http.ResponseWriter, r *http.Request) {
+	f.mu.RLock()
+	bots := make(map[int64]sharedredis.BotHealth, len(f.health))
+	for botID, s := range f.health {
+		bots[botID] = s.snapshot()
+	}
+	f.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Worker string                          `json:"worker"`
+		Bots   map[int64]sharedredis.BotHealth `json:"bots"`
+	}{f.self.ID, bots})
+}
@@ -0,0 +1,140 @@
+package webhook
+
+import (
+	"context"
+	"log"
+	"shared/sender"
+	"worker-bot/models"
+	mtproto "worker-bot/mt-proto"
+	"worker-bot/templates"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"gorm.io/gorm"
+)
+
+// allowedUpdates — типы обновлений, которые обрабатывает воркер. Передаются
+// в setWebhook, чтобы Telegram не присылал остальные.
+var allowedUpdates = []string{
+	tgbotapi.UpdateTypeMessage,
+	tgbotapi.UpdateTypeEditedMessage,
+	tgbotapi.UpdateTypeChannelPost,
+	tgbotapi.UpdateTypeCallbackQuery,
+	tgbotapi.UpdateTypeMyChatMember,
+}
+
+// updateChatID возвращает чат, к которому относится обновление, для
+// проверки флуда. Для прочих обновлений возвращается 0.
+func updateChatID(update tgbotapi.Update) int64 {
+	switch {
+	case update.Message != nil:
+		return update.Message.Chat.ID
+	case update.EditedMessage != nil:
+		return update.EditedMessage.Chat.ID
+	case update.ChannelPost != nil:
+		return update.ChannelPost.Chat.ID
+	case update.CallbackQuery != nil && update.CallbackQuery.Message != nil:
+		return update.CallbackQuery.Message.Chat.ID
+	}
+	return 0
+}
+
+// handleEditedMessage повторно обрабатывает ответ, если пользователь
+// отредактировал своё последнее сообщение: шаг диалога откатывается к тому,
+// на котором ответ был принят. Правки более старых сообщений игнорируются.
+func handleEditedMessage(ctx context.Context, botID int64, msg *tgbotapi.Message, redis *models.RedisClient, db *gorm.DB) error {
+	return withState(ctx, botID, senderID(msg), redis, db, nil, func(state *models.BotState, resp *response) error {
+		if msg.IsCommand() || msg.MessageID != state.LastMessageID || state.LastInputStep == "" {
+			return nil
+		}
+		state.CurrentStep = state.LastInputStep
+		handleRegularMessage(resp, msg, state, redis)
+		return nil
+	})
+}
+
+// handleChannelPost обрабатывает пост в канале, где бот администратор.
+// Обычные посты пишут сами администраторы канала, отвечать на них нечего:
+// бот реагирует только на /start и команды из меню. На незнакомую
+// команду бот тоже молчит, чтобы не писать в канал лишнее.
+func handleChannelPost(ctx context.Context, bot *tgbotapi.BotAPI, post *tgbotapi.Message, redis *models.RedisClient, db *gorm.DB) error {
+	if !post.IsCommand() {
+		return nil
+	}
+	return withState(ctx, bot.Self.ID, post.Chat.ID, redis, db, nil, func(state *models.BotState, resp *response) error {
+		resp.profile = profileVars(&bot.Self, nil)
+		if post.Command() == "start" {
+			start, err := templates.Bound(ctx, db, bot.Token)
+			if err != nil {
+				return err
+			}
+			handleStartCommand(resp, post.Chat.ID, state, redis, start)
+			return nil
+		}
+		_, err := handleFlowCommand(ctx, db, bot.Token, resp, post, state)
+		return err
+	})
+}
+
+// handleCallbackQuery выполняет действие inline-кнопки. Ответ заменяет
+// текст сообщения с кнопкой, а сам callback подтверждается сразу после
+// сохранения состояния.
+func handleCallbackQuery(ctx context.Context, botID int64, out *sender.Sender, callback *tgbotapi.CallbackQuery, redis *models.RedisClient, db *gorm.DB, mtp *mtproto.Session) error {
+	answer := tgbotapi.NewCallback(callback.ID, "")
+	botToken := out.Bot().Token
+
+	if callback.Message != nil {
+		err := withState(ctx, botID, callback.From.ID, redis, db, callback.Message, func(state *models.BotState, resp *response) error {
+			chatID := callback.Message.Chat.ID
+			resp.profile = profileVars(&out.Bot().Self, callback.From)
+			switch callback.Data {
+			case "start":
+				start, err := templates.Bound(ctx, db, botToken)
+				if err != nil {
+					return err
+				}
+				handleStartCommand(resp, chatID, state, redis, start)
+			case "auth":
+				handleAuthCommand(resp, chatID, state, redis, mtp)
+			default:
+				handled, err := handleTemplateButton(ctx, db, botToken, resp, chatID, state, callback.Data)
+				if err != nil {
+					return err
+				}
+				if !handled {
+					answer.Text = "Эта кнопка больше не действует"
+				}
+			}
+			if len(resp.messages) > 0 {
+				resp.clearKeyboard()
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if _, err := out.Request(ctx, answer); err != nil {
+		log.Printf("Error answering callback query: %v", err)
+	}
+	return nil
+}
+
+// handleMyChatMember отмечает, что пользователь заблокировал или
+// разблокировал бота либо удалил его из чата.
+func handleMyChatMember(ctx context.Context, botID int64, member *tgbotapi.ChatMemberUpdated, redis *models.RedisClient, db *gorm.DB) error {
+	switch member.NewChatMember.Status {
+	case "kicked", "left":
+		return setBlocked(ctx, botID, member.Chat.ID, true, redis, db)
+	case "member", "administrator", "creator":
+		return setBlocked(ctx, botID, member.Chat.ID, false, redis, db)
+	}
+	return nil
+}
+
+func setBlocked(ctx context.Context, botID, chatID int64, blocked bool, redis *models.RedisClient, db *gorm.DB) error {
+	return withState(ctx, botID, chatID, redis, db, nil, func(state *models.BotState, resp *response) error {
+		state.IsBlocked = blocked
+		return nil
+	})
+}